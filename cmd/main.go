@@ -1,71 +1,333 @@
 package main
 
 import (
+	"context"
 	"database/sql"
+	"flag"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"strconv"
+	"time"
 
 	"github.com/ellisbywater/http-rock-paper-scissors/internal/domain"
+	"github.com/ellisbywater/http-rock-paper-scissors/internal/events"
 	"github.com/ellisbywater/http-rock-paper-scissors/internal/handler"
+	"github.com/ellisbywater/http-rock-paper-scissors/internal/migrate"
+	"github.com/ellisbywater/http-rock-paper-scissors/internal/realtime"
 	"github.com/ellisbywater/http-rock-paper-scissors/internal/repository"
+	"github.com/ellisbywater/http-rock-paper-scissors/internal/repository/memory"
+	"github.com/ellisbywater/http-rock-paper-scissors/internal/repository/sqlite"
 	"github.com/ellisbywater/http-rock-paper-scissors/internal/service"
+	"github.com/ellisbywater/http-rock-paper-scissors/internal/webhook"
 	"github.com/joho/godotenv"
 	_ "github.com/lib/pq"
 )
 
-func buildGameHandlerDeps(db *sql.DB) handler.GameHandlers {
-	var gameRepo domain.GameRepository = repository.NewGameRepository(db)
-	var gameService service.GameService = *service.NewGameService(gameRepo)
+type repositories struct {
+	players     domain.PlayerRepository
+	games       domain.GameRepository
+	rounds      domain.RoundRepository
+	leaderboard domain.LeaderboardRepository
+	events      domain.GameEventRepository
+	webhooks    domain.WebhookRepository
+}
+
+// storageBackend is an opened backend. db is nil and dialect empty for the
+// memory backend, which has no schema to migrate.
+type storageBackend struct {
+	db      *sql.DB
+	dialect string
+	repos   repositories
+}
+
+func (sb storageBackend) Close() error {
+	if sb.db == nil {
+		return nil
+	}
+	return sb.db.Close()
+}
+
+// openStorage connects to the named backend: "postgres" (the default),
+// "sqlite" or "memory". url is the Postgres DSN or SQLite file and is ignored
+// for memory.
+func openStorage(driver string, url string) (storageBackend, error) {
+	switch driver {
+	case "memory":
+		store := memory.New()
+		return storageBackend{repos: repositories{
+			players:     memory.NewPlayerRepository(store),
+			games:       memory.NewGameRepository(store),
+			rounds:      memory.NewRoundRepository(store),
+			leaderboard: memory.NewLeaderboardRepository(store),
+			events:      memory.NewGameEventRepository(store),
+			webhooks:    memory.NewWebhookRepository(store),
+		}}, nil
+	case "", "postgres":
+		db, err := sql.Open("postgres", url)
+		if err != nil {
+			return storageBackend{}, err
+		}
+		if err := db.Ping(); err != nil {
+			db.Close()
+			return storageBackend{}, fmt.Errorf("error in connection with database %s", err)
+		}
+		return storageBackend{db: db, dialect: migrate.DialectPostgres, repos: repositories{
+			players:     repository.NewPlayerRepository(db, repository.Postgres),
+			games:       repository.NewGameRepository(db, repository.Postgres),
+			rounds:      repository.NewRoundRepository(db, repository.Postgres),
+			leaderboard: repository.NewLeaderboardRepository(db, repository.Postgres),
+			events:      repository.NewGameEventRepository(db, repository.Postgres),
+			webhooks:    repository.NewWebhookRepository(db, repository.Postgres),
+		}}, nil
+	case "sqlite", "sqlite3":
+		if url == "" {
+			url = "rps.db"
+		}
+		db, err := sqlite.Open(url)
+		if err != nil {
+			return storageBackend{}, err
+		}
+		return storageBackend{db: db, dialect: migrate.DialectSQLite, repos: repositories{
+			players:     sqlite.NewPlayerRepository(db),
+			games:       sqlite.NewGameRepository(db),
+			rounds:      sqlite.NewRoundRepository(db),
+			leaderboard: sqlite.NewLeaderboardRepository(db),
+			events:      sqlite.NewGameEventRepository(db),
+			webhooks:    sqlite.NewWebhookRepository(db),
+		}}, nil
+	default:
+		return storageBackend{}, fmt.Errorf("unknown storage %q: use postgres, sqlite or memory", driver)
+	}
+}
+
+// runMigrate implements `main migrate up|down [steps]|status`.
+func runMigrate(ctx context.Context, backend storageBackend, args []string) error {
+	if backend.db == nil {
+		return fmt.Errorf("memory storage has no schema to migrate")
+	}
+	migrator, err := migrate.New(backend.db, backend.dialect)
+	if err != nil {
+		return err
+	}
+	command := "status"
+	if len(args) > 0 {
+		command = args[0]
+	}
+	switch command {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		for _, m := range applied {
+			log.Printf("applied %04d_%s", m.Version, m.Name)
+		}
+		if err == nil && len(applied) == 0 {
+			log.Println("schema is up to date")
+		}
+		return err
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps < 1 {
+				return fmt.Errorf("migrate down: steps must be a positive number, got %q", args[1])
+			}
+		}
+		reverted, err := migrator.Down(ctx, steps)
+		for _, m := range reverted {
+			log.Printf("reverted %04d_%s", m.Version, m.Name)
+		}
+		return err
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			return err
+		}
+		for _, st := range statuses {
+			state := "pending"
+			if st.Applied {
+				state = "applied " + st.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%04d_%s\t%s\n", st.Version, st.Name, state)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown migrate command %q: use up, down [steps] or status", command)
+	}
+}
+
+func buildGameHandlerDeps(gameRepo domain.GameRepository, bus events.Publisher) handler.GameHandlers {
+	var gameService service.GameService = *service.NewGameService(gameRepo, bus)
 	return *handler.NewGameHandler(gameService)
 }
 
-func buildPlayerHandlerDeps(db *sql.DB) handler.PlayerHandlers {
-	var playerRepo domain.PlayerRepository = repository.NewPlayerRepository(db)
-	var playerService service.PlayerService = *service.NewPlayerService(playerRepo)
+func buildPlayerHandlerDeps(playerRepo domain.PlayerRepository, gameRepo domain.GameRepository, bus events.Publisher) handler.PlayerHandlers {
+	var playerService service.PlayerService = *service.NewPlayerService(playerRepo, service.NewGameService(gameRepo, bus), bus)
 	return *handler.NewPlayerHandler(playerService)
 }
 
-func buildRoundHandlerDeps(db *sql.DB) handler.RoundHandlers {
-	var roundRepo domain.RoundRepository = repository.NewRoundRepository(db)
-	var roundService service.RoundService = *service.NewRoundService(roundRepo)
-	return *handler.NewRoundHandlers(roundService)
+func buildRoundHandlerDeps(roundRepo domain.RoundRepository, gameRepo domain.GameRepository, ratings domain.RatingSystem, bus events.Publisher) handler.RoundHandlers {
+	var roundService service.RoundService = *service.NewRoundService(roundRepo, ratings, bus)
+	var gameService service.GameService = *service.NewGameService(gameRepo, nil)
+	return *handler.NewRoundHandlers(roundService, gameService)
+}
+
+func buildGameSocketHandlerDeps(gameRepo domain.GameRepository, hub *realtime.Hub, origins handler.Origins) handler.GameSocketHandlers {
+	var gameService service.GameService = *service.NewGameService(gameRepo, nil)
+	return *handler.NewGameSocketHandler(gameService, hub, origins)
+}
+
+func buildEventStreamHandlerDeps(gameRepo domain.GameRepository, playerRepo domain.PlayerRepository, eventRepo domain.GameEventRepository, hub *realtime.Hub, origins handler.Origins) handler.EventStreamHandlers {
+	var gameService service.GameService = *service.NewGameService(gameRepo, nil)
+	var playerService service.PlayerService = *service.NewPlayerService(playerRepo, service.NewGameService(gameRepo, nil), nil)
+	var eventService service.GameEventService = *service.NewGameEventService(eventRepo)
+	return *handler.NewEventStreamHandler(gameService, playerService, eventService, hub, origins)
+}
+
+func buildWebhookHandlerDeps(webhookRepo domain.WebhookRepository) handler.WebhookHandlers {
+	var webhookService service.WebhookService = *service.NewWebhookService(webhookRepo)
+	return *handler.NewWebhookHandler(webhookService)
+}
+
+// buildMatchmakingHandlerDeps also starts the matcher, which pairs the queue
+// every interval until ctx is done.
+func buildMatchmakingHandlerDeps(ctx context.Context, gameRepo domain.GameRepository, playerRepo domain.PlayerRepository, bus events.Publisher, interval time.Duration) handler.MatchmakingHandlers {
+	matchmakingService := service.NewMatchmakingService(service.NewGameService(gameRepo, bus), playerRepo, bus)
+	go matchmakingService.MatchEvery(ctx, interval)
+	return *handler.NewMatchmakingHandler(matchmakingService)
+}
+
+// buildLeaderboardHandlerDeps also keeps the leaderboard fresh: it is rebuilt
+// right away and then every refresh until ctx is done.
+func buildLeaderboardHandlerDeps(ctx context.Context, leaderboardRepo domain.LeaderboardRepository, minGames int, refresh time.Duration) (handler.LeaderboardHandlers, error) {
+	var leaderboardService service.LeaderboardService = *service.NewLeaderboardService(leaderboardRepo, minGames)
+	if err := leaderboardService.Refresh(ctx); err != nil {
+		return handler.LeaderboardHandlers{}, fmt.Errorf("refresh leaderboard: %w", err)
+	}
+	go leaderboardService.RefreshEvery(ctx, refresh)
+	return *handler.NewLeaderboardHandler(leaderboardService), nil
+}
+
+// newRatingSystem builds the configured rating system. kFactor may be empty
+// for the default.
+func newRatingSystem(name string, kFactor string) (domain.RatingSystem, error) {
+	var k float64
+	if kFactor != "" {
+		var err error
+		k, err = strconv.ParseFloat(kFactor, 64)
+		if err != nil {
+			return nil, fmt.Errorf("K-factor must be a number, got %q", kFactor)
+		}
+	}
+	return domain.NewRatingSystem(name, k)
 }
 
 const port = ":8080"
 
 func main() {
-	err := godotenv.Load()
+	if err := godotenv.Load(); err != nil {
+		log.Printf("No .env file loaded: %v", err)
+	}
+	storage := flag.String("storage", os.Getenv("DATABASE_DRIVER"), "storage backend: postgres, sqlite or memory (defaults to $DATABASE_DRIVER)")
+	rating := flag.String("rating", os.Getenv("RATING_SYSTEM"), "rating system: elo or glicko2 (defaults to $RATING_SYSTEM, then elo)")
+	kFactor := flag.String("k-factor", os.Getenv("RATING_K_FACTOR"), "Elo K-factor (defaults to $RATING_K_FACTOR, then 32)")
+	leaderboardRefresh := flag.Duration("leaderboard-refresh", time.Minute, "how often the leaderboard is rebuilt")
+	webhookAttempts := flag.Int("webhook-attempts", 8, "attempts at a webhook delivery before it is given up")
+	webhookBackoff := flag.Duration("webhook-backoff", 30*time.Second, "wait before retrying a failed webhook delivery; doubled after every further failure")
+	webhookAllowPrivate := flag.Bool("webhook-allow-private", false, "let webhooks reach loopback, private and link-local addresses, to try them out locally")
+	allowedOrigins := flag.String("allowed-origins", os.Getenv("ALLOWED_ORIGINS"), "comma-separated origins, like https://rps.example, whose pages may follow games as well as the server's own (defaults to $ALLOWED_ORIGINS)")
+	matchInterval := flag.Duration("matchmaking-interval", time.Second, "how often the matchmaking queue is paired")
+	leaderboardMinGames := flag.Int("leaderboard-min-games", domain.DefaultLeaderboardMinGames, "finished games a player needs to be ranked by win rate")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] [migrate up|down [steps]|status]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	ratings, err := newRatingSystem(*rating, *kFactor)
 	if err != nil {
-		log.Fatalf("Error loading .env file: %v", err)
+		log.Fatal(err)
+	}
+	if *webhookAttempts < 1 || *webhookBackoff <= 0 {
+		log.Fatal("webhook-attempts and webhook-backoff must be positive")
 	}
-	db, err := sql.Open("postgres", os.Getenv("DATABASE_URL"))
+
+	backend, err := openStorage(*storage, os.Getenv("DATABASE_URL"))
 	if err != nil {
 		log.Fatal(err)
 	}
-	defer db.Close()
+	defer backend.Close()
+	repos := backend.repos
 
-	if err := db.Ping(); err != nil {
-		log.Fatalf("error in connection with database %s", err)
+	if flag.Arg(0) == "migrate" {
+		if err := runMigrate(context.Background(), backend, flag.Args()[1:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if backend.db != nil {
+		if err := runMigrate(context.Background(), backend, []string{"up"}); err != nil {
+			log.Fatal(err)
+		}
 	}
 
 	r := http.NewServeMux()
 
-	gameHandler := buildGameHandlerDeps(db)
-	playerHandler := buildPlayerHandlerDeps(db)
-	roundHandler := buildRoundHandlerDeps(db)
+	// Everything that reacts to games being played subscribes to the bus
+	hub := realtime.NewHub()
+	dispatcher := webhook.NewDispatcher(repos.webhooks, webhook.NewClient(10*time.Second, *webhookAllowPrivate), *webhookAttempts, *webhookBackoff)
+	go dispatcher.Run(context.Background(), time.Second)
+	bus := events.NewBus()
+	bus.Subscribe(realtime.NewRecorder(repos.events, hub, dispatcher))
 
+	gameHandler := buildGameHandlerDeps(repos.games, bus)
+	playerHandler := buildPlayerHandlerDeps(repos.players, repos.games, bus)
+	roundHandler := buildRoundHandlerDeps(repos.rounds, repos.games, ratings, bus)
+	origins := handler.ParseOrigins(*allowedOrigins)
+	socketHandler := buildGameSocketHandlerDeps(repos.games, hub, origins)
+	eventHandler := buildEventStreamHandlerDeps(repos.games, repos.players, repos.events, hub, origins)
+	webhookHandler := buildWebhookHandlerDeps(repos.webhooks)
+	matchmakingHandler := buildMatchmakingHandlerDeps(context.Background(), repos.games, repos.players, bus, *matchInterval)
+	leaderboardHandler, err := buildLeaderboardHandlerDeps(context.Background(), repos.leaderboard, *leaderboardMinGames, *leaderboardRefresh)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	r.HandleFunc("GET /players", playerHandler.List)
 	r.HandleFunc("POST /player/create", playerHandler.Create)
 	r.HandleFunc("GET /player/{playerId}", playerHandler.Get)
-	r.HandleFunc("GET /player/{playerId}/games", playerHandler.GetGames)
+	r.HandleFunc("GET /player/{playerId}/games", playerHandler.OptionalAuth(playerHandler.GetGames))
+	r.HandleFunc("GET /player/{playerId}/stats", playerHandler.GetStats)
+	r.HandleFunc("GET /player/{playerId}/ratings", playerHandler.GetRatings)
+	r.HandleFunc("GET /player/{playerId}/vs/{opponentId}", playerHandler.OptionalAuth(playerHandler.HeadToHead))
+	r.HandleFunc("GET /player/{playerId}/events", playerHandler.RequireAuth(eventHandler.Player))
+
+	r.HandleFunc("GET /leaderboard", leaderboardHandler.List)
+
+	r.HandleFunc("POST /matchmaking/join", playerHandler.RequireAuth(matchmakingHandler.Join))
+	r.HandleFunc("POST /matchmaking/leave", playerHandler.RequireAuth(matchmakingHandler.Leave))
+	r.HandleFunc("GET /matchmaking/status", playerHandler.RequireAuth(matchmakingHandler.Status))
+
+	r.HandleFunc("GET /webhooks", playerHandler.RequireAuth(webhookHandler.List))
+	r.HandleFunc("POST /webhook/create", playerHandler.RequireAuth(webhookHandler.Create))
+	r.HandleFunc("GET /webhook/{webhookId}", playerHandler.RequireAuth(webhookHandler.Get))
+	r.HandleFunc("DELETE /webhook/{webhookId}", playerHandler.RequireAuth(webhookHandler.Delete))
+	r.HandleFunc("GET /webhook/{webhookId}/deliveries", playerHandler.RequireAuth(webhookHandler.Deliveries))
 
-	r.HandleFunc("POST /game/create", gameHandler.Create)
-	r.HandleFunc("GET /game/{gameId}", gameHandler.GetGame)
+	r.HandleFunc("GET /games", playerHandler.OptionalAuth(gameHandler.List))
+	r.HandleFunc("POST /game/create", playerHandler.RequireAuth(gameHandler.Create))
+	r.HandleFunc("GET /game/{gameId}", playerHandler.OptionalAuth(gameHandler.GetGame))
+	r.HandleFunc("GET /game/{gameId}/ws", playerHandler.RequireAuth(socketHandler.Serve))
+	r.HandleFunc("GET /game/{gameId}/events", playerHandler.RequireAuth(eventHandler.Game))
 
-	r.HandleFunc("POST /game/{gameId}/round/create", roundHandler.Create)
-	r.HandleFunc("POST /game/{gameId}/round/{roundId}/playHand", roundHandler.PlayHand)
+	r.HandleFunc("GET /game/{gameId}/rounds", playerHandler.OptionalAuth(roundHandler.List))
+	r.HandleFunc("POST /game/{gameId}/round/create", playerHandler.RequireAuth(roundHandler.Create))
+	r.HandleFunc("GET /game/{gameId}/round/{roundId}", playerHandler.OptionalAuth(roundHandler.Get))
+	r.HandleFunc("POST /game/{gameId}/round/{roundId}/commit", playerHandler.RequireAuth(roundHandler.CommitHand))
+	r.HandleFunc("POST /game/{gameId}/round/{roundId}/playHand", playerHandler.RequireAuth(roundHandler.PlayHand))
 
-	log.Println("Connected to database")
+	log.Printf("Using %q storage", *storage)
+	log.Printf("Rating games with %s", ratings.Name())
 
 	log.Println("Rock Paper Scissors running on Port ", port)
 	log.Fatal(http.ListenAndServe(port, r))
@@ -0,0 +1,7 @@
+-- Verbose statement logging for the development database. Run by the Postgres
+-- docker entrypoint on first start; the schema itself lives in
+-- internal/migrate/migrations and is applied by the server.
+ALTER SYSTEM SET log_statement = 'all';
+ALTER SYSTEM SET log_min_duration_statement = 0;
+ALTER SYSTEM SET log_error_verbosity = 'verbose';
+SELECT pg_reload_conf();
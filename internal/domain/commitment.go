@@ -0,0 +1,110 @@
+package domain
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// In a commit-reveal game each player first sends a commitment,
+//
+//	hex(sha256(hand + ":" + nonce))
+//
+// and only once both commitments are in do they reveal the hand and nonce.
+// The server cannot learn a hand before both players are bound to theirs,
+// and the stored commitments let either player check the outcome later.
+//
+// A nonce is at least 128 random bits, hex encoded: with fewer the few hands
+// of a rule set and a short nonce can be tried against a commitment until
+// one matches.
+
+const (
+	minNonceLength = 32
+	maxNonceLength = 128
+)
+
+var (
+	ErrInvalidCommitment  = newError(KindValidation, "invalid_commitment", "invalid commitment")
+	ErrInvalidNonce       = newError(KindValidation, "invalid_nonce", "invalid nonce")
+	ErrCommitmentMismatch = newError(KindValidation, "commitment_mismatch", "hand and nonce do not match your commitment")
+	ErrCommitRequired     = newError(KindValidation, "commit_required", "this game is commit-reveal: commit to a hand, then reveal it with your nonce")
+	ErrNotCommitReveal    = newError(KindValidation, "not_commit_reveal", "this game does not use commit-reveal")
+
+	ErrAlreadyCommitted  = newError(KindConflict, "already_committed", "you have already committed this round")
+	ErrCommitmentPending = newError(KindConflict, "commitment_pending", "both players must commit before hands are revealed")
+)
+
+// HandCommitment is the commitment a player sends for hand and nonce.
+func HandCommitment(hand Hand, nonce string) string {
+	sum := sha256.Sum256([]byte(string(hand) + ":" + nonce))
+	return hex.EncodeToString(sum[:])
+}
+
+// ParseCommitment checks that s looks like a HandCommitment and normalises it.
+func ParseCommitment(s string) (string, error) {
+	c := strings.ToLower(strings.TrimSpace(s))
+	if len(c) != sha256.Size*2 {
+		return "", fmt.Errorf("%w: must be %d hex characters", ErrInvalidCommitment, sha256.Size*2)
+	}
+	if _, err := hex.DecodeString(c); err != nil {
+		return "", fmt.Errorf("%w: must be hex encoded", ErrInvalidCommitment)
+	}
+	return c, nil
+}
+
+// VerifyCommitment reports whether hand and nonce open commitment. Nonces
+// too short to hide the hand are rejected before they are tried.
+func VerifyCommitment(commitment string, hand Hand, nonce string) error {
+	if len(nonce) < minNonceLength || len(nonce) > maxNonceLength {
+		return fmt.Errorf("%w: must be %d to %d hex characters", ErrInvalidNonce, minNonceLength, maxNonceLength)
+	}
+	if _, err := hex.DecodeString(nonce); err != nil {
+		return fmt.Errorf("%w: must be hex encoded", ErrInvalidNonce)
+	}
+	want := HandCommitment(hand, nonce)
+	if subtle.ConstantTimeCompare([]byte(want), []byte(commitment)) != 1 {
+		return ErrCommitmentMismatch
+	}
+	return nil
+}
+
+func (rc *RoundContext) BothCommitted() bool {
+	return rc.PlayerOneCommitment != "" && rc.PlayerTwoCommitment != ""
+}
+
+func (rc *RoundContext) CurrentPlayerCommitment() string {
+	switch rc.CurrentPlayer {
+	case rc.PlayerOneID:
+		return rc.PlayerOneCommitment
+	case rc.PlayerTwoID:
+		return rc.PlayerTwoCommitment
+	default:
+		return ""
+	}
+}
+
+func (rc *RoundContext) SetCommitmentOnCurrentPlayer(commitment string) error {
+	switch rc.CurrentPlayer {
+	case rc.PlayerOneID:
+		rc.PlayerOneCommitment = commitment
+	case rc.PlayerTwoID:
+		rc.PlayerTwoCommitment = commitment
+	default:
+		return ErrNotParticipant
+	}
+	return nil
+}
+
+func (rc *RoundContext) SetNonceOnCurrentPlayer(nonce string) error {
+	switch rc.CurrentPlayer {
+	case rc.PlayerOneID:
+		rc.PlayerOneNonce = nonce
+	case rc.PlayerTwoID:
+		rc.PlayerTwoNonce = nonce
+	default:
+		return ErrNotParticipant
+	}
+	return nil
+}
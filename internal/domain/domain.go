@@ -26,25 +26,24 @@ import (
 	- Has many Hands
 **/
 
-type Hand string
-
-// const (
-// 	Rock Hand = iota
-// 	Paper
-// 	Scissors
-// )
-
-// func (h Hand) String() string {
-// 	return [...]string{"rock", "paper", "scissors"}[h]
-// }
-
 type PlayerCreateRequest struct {
 	UserName string `json:"username"`
+	// TokenHash is the HashToken digest of the player's API token. The token
+	// itself is never stored.
+	TokenHash string `json:"-"`
 }
 
 type PlayerResponse struct {
 	ID       int    `json:"id"`
 	UserName string `json:"username"`
+	Rating   Rating `json:"rating"`
+}
+
+// PlayerCreateResponse is only returned when a player is created: it is the
+// one time the plain token is available.
+type PlayerCreateResponse struct {
+	PlayerResponse
+	Token string `json:"token"`
 }
 
 type Game struct {
@@ -71,8 +70,21 @@ type GameResponse struct {
 	PlayerTwoScore int            `json:"player_two_score"`
 	Winner         int            `json:"winner"`
 	Finished       bool           `json:"finished"`
+	Mode           string         `json:"mode"`
+	TargetScore    int            `json:"target_score"`
+	TiePolicy      string         `json:"tie_policy"`
+	RuleSet        string         `json:"rule_set"`
+	Weapons        Weapons        `json:"weapons"`
+	CommitReveal   bool           `json:"commit_reveal"`
 	Rounds         []RoundContext `json:"rounds"`
 	CreatedAt      time.Time      `json:"created_at"`
+
+	// Ratings is only loaded by RoundRepository.Update, see GameRatings.
+	Ratings GameRatings `json:"-"`
+}
+
+func (g *GameResponse) Rules() (RuleSet, error) {
+	return NewRuleSet(g.RuleSet, g.Weapons)
 }
 
 type GameCreateResponse struct {
@@ -81,30 +93,49 @@ type GameCreateResponse struct {
 	CurrentRound int       `json:"current_round"`
 	PlayerOneId  int       `json:"player_one_id"`
 	PlayerTwoId  int       `json:"player_two_id"`
+	Mode         string    `json:"mode"`
+	TargetScore  int       `json:"target_score"`
+	TiePolicy    string    `json:"tie_policy"`
+	RuleSet      string    `json:"rule_set"`
+	Weapons      Weapons   `json:"weapons"`
+	CommitReveal bool      `json:"commit_reveal"`
 	CreatedAt    time.Time `json:"created_at"`
 }
 type GameCreateRequest struct {
-	TotalRounds int `json:"total_rounds"`
-	PlayerOneID int `json:"player_one_id"`
-	PlayerTwoID int `json:"player_two_id"`
+	TotalRounds  int     `json:"total_rounds"`
+	PlayerOneID  int     `json:"player_one_id"`
+	PlayerTwoID  int     `json:"player_two_id"`
+	Mode         string  `json:"mode"`
+	TargetScore  int     `json:"target_score"`
+	TiePolicy    string  `json:"tie_policy"`
+	RuleSet      string  `json:"rule_set"`
+	Weapons      Weapons `json:"weapons"`
+	CommitReveal bool    `json:"commit_reveal"`
 }
 
 type RoundContext struct {
-	ID            int    `json:"id"`
-	GameID        int    `json:"game_id"`
-	Count         int    `json:"count"`
-	PlayerOneID   int    `json:"player_one_id"`
-	PlayerTwoID   int    `json:"player_two_id"`
-	CurrentPlayer int    `json:"current_player"`
-	PlayerOneHand string `json:"player_one_hand"`
-	PlayerTwoHand string `json:"player_two_hand"`
-	Winner        int    `json:"winner"`
-	Finished      bool   `json:"finished"`
+	ID            int  `json:"id"`
+	GameID        int  `json:"game_id"`
+	Count         int  `json:"count"`
+	PlayerOneID   int  `json:"player_one_id"`
+	PlayerTwoID   int  `json:"player_two_id"`
+	CurrentPlayer int  `json:"current_player"`
+	PlayerOneHand Hand `json:"player_one_hand"`
+	PlayerTwoHand Hand `json:"player_two_hand"`
+	Winner        int  `json:"winner"`
+	Finished      bool `json:"finished"`
+
+	// Commit-reveal games only. The commitments and, once revealed, the
+	// nonces are kept so anyone can check the result afterwards.
+	PlayerOneCommitment string `json:"player_one_commitment,omitempty"`
+	PlayerTwoCommitment string `json:"player_two_commitment,omitempty"`
+	PlayerOneNonce      string `json:"player_one_nonce,omitempty"`
+	PlayerTwoNonce      string `json:"player_two_nonce,omitempty"`
 }
 
 type PlayerHandContext struct {
 	ID   int
-	Hand string
+	Hand Hand
 }
 
 func (rc *RoundContext) PlayerOneHandContext() PlayerHandContext {
@@ -124,17 +155,11 @@ func (rc *RoundContext) PlayerTwoHandContext() PlayerHandContext {
 }
 
 func (rc *RoundContext) HasPlayerOnePlayed() bool {
-	if rc.PlayerOneHand == "none" || rc.PlayerOneHand == "" {
-		return false
-	}
-	return true
+	return !rc.PlayerOneHand.IsNone()
 }
 
 func (rc *RoundContext) HasPlayerTwoPlayed() bool {
-	if rc.PlayerTwoHand == "none" || rc.PlayerTwoHand == "" {
-		return false
-	}
-	return true
+	return !rc.PlayerTwoHand.IsNone()
 }
 
 func (rc *RoundContext) SetCurrentPlayer(id int) error {
@@ -163,7 +188,7 @@ func (rc *RoundContext) CheckCurrentPlayer() error {
 	return nil
 }
 
-func (rc *RoundContext) SetHandOnCurrentPlayer(hand string) error {
+func (rc *RoundContext) SetHandOnCurrentPlayer(hand Hand) error {
 	switch rc.CurrentPlayer {
 	case rc.PlayerOneID:
 		rc.PlayerOneHand = hand
@@ -175,14 +200,14 @@ func (rc *RoundContext) SetHandOnCurrentPlayer(hand string) error {
 	return nil
 }
 
-func (rc *RoundContext) CurrentPlayerHand() string {
+func (rc *RoundContext) CurrentPlayerHand() Hand {
 	switch rc.CurrentPlayer {
 	case rc.PlayerOneID:
 		return rc.PlayerOneHand
 	case rc.PlayerTwoID:
 		return rc.PlayerTwoHand
 	default:
-		return ""
+		return NoHand
 	}
 }
 
@@ -207,52 +232,25 @@ func (rc *RoundContext) CurrentPlayerContext() PlayerHandContext {
 
 type WinnerContext struct {
 	RoundID  int
-	Hand     string
+	Hand     Hand
 	PlayerID int
 }
 
-func (rc *RoundContext) CalculateWinner() WinnerContext {
+// CalculateWinner returns the round winner under the game's rules. PlayerID
+// is 0 while a hand is missing or when neither hand beats the other.
+func (rc *RoundContext) CalculateWinner(rules RuleSet) WinnerContext {
 	var winnerCtx WinnerContext
 	winnerCtx.RoundID = rc.ID
-	if rc.PlayerOneHand != "none" && rc.PlayerTwoHand != "none" {
-		switch rc.PlayerOneHand {
-		case "rock":
-			if rc.PlayerTwoHand == "paper" {
-				winnerCtx.PlayerID = rc.PlayerTwoID
-				winnerCtx.Hand = rc.PlayerTwoHand
-			}
-			if rc.PlayerTwoHand == "scissors" {
-				winnerCtx.PlayerID = rc.PlayerOneID
-				winnerCtx.Hand = rc.PlayerOneHand
-			}
-			if rc.PlayerTwoHand == "rock" {
-				winnerCtx.PlayerID = 0
-			}
-		case "scissors":
-			if rc.PlayerTwoHand == "rock" {
-				winnerCtx.PlayerID = rc.PlayerTwoID
-				winnerCtx.Hand = rc.PlayerTwoHand
-			}
-			if rc.PlayerTwoHand == "paper" {
-				winnerCtx.PlayerID = rc.PlayerOneID
-				winnerCtx.Hand = rc.PlayerOneHand
-			}
-			if rc.PlayerTwoHand == "scissors" {
-				winnerCtx.PlayerID = 0
-			}
-		case "paper":
-			if rc.PlayerTwoHand == "scissors" {
-				winnerCtx.PlayerID = rc.PlayerTwoID
-				winnerCtx.Hand = rc.PlayerTwoHand
-			}
-			if rc.PlayerTwoHand == "rock" {
-				winnerCtx.PlayerID = rc.PlayerOneID
-				winnerCtx.Hand = rc.PlayerOneHand
-			}
-			if rc.PlayerTwoHand == "paper" {
-				winnerCtx.PlayerID = 0
-			}
-		}
+	if !rc.HasPlayerOnePlayed() || !rc.HasPlayerTwoPlayed() {
+		return winnerCtx
+	}
+	switch {
+	case rules.Beats(rc.PlayerOneHand, rc.PlayerTwoHand):
+		winnerCtx.PlayerID = rc.PlayerOneID
+		winnerCtx.Hand = rc.PlayerOneHand
+	case rules.Beats(rc.PlayerTwoHand, rc.PlayerOneHand):
+		winnerCtx.PlayerID = rc.PlayerTwoID
+		winnerCtx.Hand = rc.PlayerTwoHand
 	}
 	return winnerCtx
 }
@@ -280,25 +278,67 @@ type Score struct {
 }
 
 type RoundPlayerInput struct {
-	RoundId  int    `json:"round_id"`
-	GameID   int    `json:"game_id"`
-	PlayerID int    `json:"player_id"`
-	Hand     string `json:"hand"`
+	RoundId  int  `json:"round_id"`
+	GameID   int  `json:"game_id"`
+	PlayerID int  `json:"player_id"`
+	Hand     Hand `json:"hand"`
 }
 
 type PlayerRepository interface {
 	Create(ctx context.Context, player PlayerCreateRequest, res *PlayerResponse) error
 	Get(ctx context.Context, id int, res *PlayerResponse) error
-	GetGames(ctx context.Context, id int, res *[]GameResponse) error
+	// GetByTokenHash finds the player whose token hashes to hash.
+	GetByTokenHash(ctx context.Context, hash string, res *PlayerResponse) error
+	// List returns up to filter.Limit players ordered by id.
+	List(ctx context.Context, filter PlayerFilter, res *[]PlayerResponse) error
+	// GetStats computes the player's stats from their games and rounds,
+	// only counting games against opponentID unless it is 0. It does not
+	// check that the players exist.
+	GetStats(ctx context.Context, id int, opponentID int, res *PlayerStats) error
+	// ListRatingHistory returns the player's rating changes, oldest first.
+	ListRatingHistory(ctx context.Context, id int, res *[]RatingChange) error
 }
 
 type GameRepository interface {
 	Create(ctx context.Context, game GameCreateRequest, res *GameCreateResponse) error
+	// Get loads the game together with all of its rounds.
 	Get(ctx context.Context, id int, res *GameResponse) error
+	// List returns up to filter.Limit games matching filter, ordered by
+	// created_at then id. Rounds are not loaded.
+	List(ctx context.Context, filter GameFilter, res *[]GameResponse) error
 }
 
 type RoundRepository interface {
 	Create(ctx context.Context, res *RoundContext) error
-	UpdateHand(ctx context.Context, hand string, res *RoundContext) error
 	Get(ctx context.Context, id int, res *RoundContext) error
+	// ListByGame returns the game's rounds in the order they were created.
+	ListByGame(ctx context.Context, gameID int, res *[]RoundContext) error
+	// Update loads the round and its game, locked against concurrent writers,
+	// and passes them to fn. If fn succeeds the round's hands and outcome and
+	// the game's score and status are saved together; otherwise nothing is.
+	// game.Ratings holds both players' current ratings; if fn finishes the
+	// game and sets game.Ratings.System, the new ratings and their history
+	// are saved in the same transaction.
+	Update(ctx context.Context, gameID int, roundID int, fn func(game *GameResponse, round *RoundContext) error) error
+}
+
+type LeaderboardRepository interface {
+	// Refresh rebuilds every window of the leaderboard as of now from the
+	// finished games, replacing the previous entries in one go.
+	Refresh(ctx context.Context, now time.Time, minGames int) error
+	// List returns up to filter.Limit entries of filter.Window that are
+	// ranked under filter.Sort, best first, with Rank set.
+	List(ctx context.Context, filter LeaderboardFilter, res *[]LeaderboardEntry) error
+}
+
+type GameEventRepository interface {
+	// Append records the events in order, numbering them within their game,
+	// and sets their ID and Seq.
+	Append(ctx context.Context, events []GameEvent) error
+	// ListByGame returns the game's events with a Seq after afterSeq, oldest
+	// first.
+	ListByGame(ctx context.Context, gameID int, afterSeq int, res *[]GameEvent) error
+	// ListByPlayer returns the events of the player's games with an ID after
+	// afterID, oldest first.
+	ListByPlayer(ctx context.Context, playerID int, afterID int, res *[]GameEvent) error
 }
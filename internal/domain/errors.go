@@ -0,0 +1,69 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrorKind groups errors by how a client should react to them. The handler
+// package maps each kind to an HTTP status.
+type ErrorKind int
+
+const (
+	KindInternal ErrorKind = iota
+	KindValidation
+	KindNotFound
+	KindConflict
+	KindForbidden
+	KindUnauthenticated
+)
+
+// Error is a domain error with a stable, machine readable code. The package
+// level values below are sentinels: wrap them with fmt.Errorf("%w ...") to
+// add detail and match them with errors.Is / errors.As.
+type Error struct {
+	Kind    ErrorKind
+	Code    string
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func newError(kind ErrorKind, code string, message string) *Error {
+	return &Error{Kind: kind, Code: code, Message: message}
+}
+
+var (
+	ErrPlayerNotFound = newError(KindNotFound, "player_not_found", "player not found")
+	ErrGameNotFound   = newError(KindNotFound, "game_not_found", "game not found")
+	ErrRoundNotFound  = newError(KindNotFound, "round_not_found", "round not found")
+
+	ErrUsernameTaken      = newError(KindConflict, "username_taken", "username is already taken")
+	ErrGameFinished       = newError(KindConflict, "game_finished", "game is already finished")
+	ErrRoundFinished      = newError(KindConflict, "round_finished", "round is already finished")
+	ErrRoundAlreadyPlayed = newError(KindConflict, "round_already_played", "you have already played this round")
+
+	ErrNotParticipant = newError(KindForbidden, "not_a_participant", "player is not in this game")
+	ErrPlayerMismatch = newError(KindForbidden, "player_mismatch", "you can only act as the authenticated player")
+
+	ErrUnauthenticated = newError(KindUnauthenticated, "unauthenticated", "missing or invalid player token")
+
+	ErrInvalidUsername = newError(KindValidation, "invalid_username", "invalid username")
+	ErrInvalidPlayers  = newError(KindValidation, "invalid_players", "invalid players")
+)
+
+// NotFound wraps a not-found sentinel with the id that was looked up.
+func NotFound(sentinel *Error, id int) error {
+	return fmt.Errorf("%w: %d", sentinel, id)
+}
+
+// AsError returns the domain error in err's chain, if any.
+func AsError(err error) (*Error, bool) {
+	var derr *Error
+	if errors.As(err, &derr) {
+		return derr, true
+	}
+	return nil, false
+}
@@ -0,0 +1,46 @@
+package domain
+
+import "time"
+
+// Game event types. EventMatchFound opens a game the matchmaking queue
+// created; the others come in the order a round produces them.
+const (
+	EventMatchFound = "match_found"
+
+	// EventHandCommitted and EventHandPlayed say who moved, never what they
+	// played: the hand only appears in EventRoundResolved.
+	EventHandCommitted = "hand_committed"
+	EventHandPlayed    = "hand_played"
+	EventRoundResolved = "round_resolved"
+	EventScoreChanged  = "score_changed"
+	EventGameFinished  = "game_finished"
+)
+
+// GameEvent is something that happened in a game, as recorded and pushed to
+// the clients following it. Only the fields of its Type are set.
+type GameEvent struct {
+	// ID orders all events; Seq numbers the events of one game from 1. Both
+	// are set when the event is recorded.
+	ID     int    `json:"id"`
+	Seq    int    `json:"seq"`
+	Type   string `json:"type"`
+	GameID int    `json:"game_id"`
+	// The game's players, so player streams can pick out their games.
+	PlayerOneID int `json:"player_one_id"`
+	PlayerTwoID int `json:"player_two_id"`
+	// RoundID and PlayerID are set for a move.
+	RoundID  int `json:"round_id,omitempty"`
+	PlayerID int `json:"player_id,omitempty"`
+	// Round is the resolved round, hands included.
+	Round *RoundContext `json:"round,omitempty"`
+	// Score is set on score_changed and game_finished.
+	Score *Score `json:"score,omitempty"`
+	// Winner is the game's winner on game_finished; 0 for a draw.
+	Winner int       `json:"winner,omitempty"`
+	Time   time.Time `json:"time"`
+}
+
+// GameEventPublisher is told about game events once they are committed.
+type GameEventPublisher interface {
+	PublishGameEvent(event GameEvent)
+}
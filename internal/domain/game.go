@@ -0,0 +1,140 @@
+package domain
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// GameModeBestOf plays at most TotalRounds rounds and stops as soon as
+	// the trailing player can no longer catch up.
+	GameModeBestOf = "best_of"
+	// GameModeFirstTo keeps playing until one player wins TargetScore rounds.
+	GameModeFirstTo = "first_to"
+)
+
+const (
+	// TiePolicyCount treats a tied round as played; a level final score is a draw.
+	TiePolicyCount = "count"
+	// TiePolicyReplay replays tied rounds under the same round count.
+	TiePolicyReplay = "replay"
+	// TiePolicySuddenDeath counts ties, but adds an extra round whenever a
+	// best_of game would otherwise end level.
+	TiePolicySuddenDeath = "sudden_death"
+)
+
+var (
+	ErrInvalidGameMode  = newError(KindValidation, "invalid_game_mode", "invalid game mode")
+	ErrInvalidTiePolicy = newError(KindValidation, "invalid_tie_policy", "invalid tie policy")
+)
+
+// Validate normalises the mode and tie policy of a new game and rejects
+// combinations that could never finish.
+func (req *GameCreateRequest) Validate() error {
+	if req.PlayerOneID == req.PlayerTwoID {
+		return fmt.Errorf("%w: a game needs two different players", ErrInvalidPlayers)
+	}
+	req.Mode = strings.ToLower(strings.TrimSpace(req.Mode))
+	switch req.Mode {
+	case "", GameModeBestOf:
+		req.Mode = GameModeBestOf
+		if req.TotalRounds < 1 {
+			return fmt.Errorf("%w: %s needs total_rounds of at least 1", ErrInvalidGameMode, GameModeBestOf)
+		}
+		req.TargetScore = req.TotalRounds/2 + 1
+	case GameModeFirstTo:
+		if req.TargetScore < 1 {
+			return fmt.Errorf("%w: %s needs target_score of at least 1", ErrInvalidGameMode, GameModeFirstTo)
+		}
+		// rounds are unbounded, the target score ends the game
+		req.TotalRounds = 0
+	default:
+		return fmt.Errorf("%w %q: must be one of %s, %s", ErrInvalidGameMode, req.Mode, GameModeBestOf, GameModeFirstTo)
+	}
+
+	req.TiePolicy = strings.ToLower(strings.TrimSpace(req.TiePolicy))
+	switch req.TiePolicy {
+	case "":
+		req.TiePolicy = TiePolicyCount
+	case TiePolicyCount, TiePolicyReplay, TiePolicySuddenDeath:
+	default:
+		return fmt.Errorf("%w %q: must be one of %s, %s, %s", ErrInvalidTiePolicy, req.TiePolicy, TiePolicyCount, TiePolicyReplay, TiePolicySuddenDeath)
+	}
+	// a first_to game never ends level, so there is nothing to break
+	if req.TiePolicy == TiePolicySuddenDeath && req.Mode == GameModeFirstTo {
+		return fmt.Errorf("%w: %s only applies to %s games", ErrInvalidTiePolicy, TiePolicySuddenDeath, GameModeBestOf)
+	}
+	return nil
+}
+
+// RoundsPlayed is the number of rounds that have been resolved so far.
+func (g *GameResponse) RoundsPlayed() int {
+	if g.CurrentRound < 1 {
+		return 0
+	}
+	return g.CurrentRound - 1
+}
+
+// Leader returns the id of the player ahead on score, or 0 when level.
+func (g *GameResponse) Leader() int {
+	switch {
+	case g.PlayerOneScore > g.PlayerTwoScore:
+		return g.PlayerOneId
+	case g.PlayerTwoScore > g.PlayerOneScore:
+		return g.PlayerTwoId
+	default:
+		return 0
+	}
+}
+
+// Decided reports whether the game is over given the current scores and how
+// many rounds have been played. winner is 0 for a drawn game.
+func (g *GameResponse) Decided() (finished bool, winner int) {
+	switch g.Mode {
+	case GameModeFirstTo:
+		if g.PlayerOneScore >= g.TargetScore || g.PlayerTwoScore >= g.TargetScore {
+			return true, g.Leader()
+		}
+		return false, 0
+	default:
+		remaining := g.TotalRounds - g.RoundsPlayed()
+		if remaining <= 0 {
+			return true, g.Leader()
+		}
+		lead := g.PlayerOneScore - g.PlayerTwoScore
+		if lead < 0 {
+			lead = -lead
+		}
+		if lead > remaining {
+			return true, g.Leader()
+		}
+		return false, 0
+	}
+}
+
+// ApplyRoundResult records a resolved round on the game. winner is 0 for a
+// tie. Scores and the round counter are updated according to TiePolicy, and
+// the game is marked finished once Decided says so.
+func (g *GameResponse) ApplyRoundResult(winner int) {
+	switch winner {
+	case g.PlayerOneId:
+		g.PlayerOneScore++
+	case g.PlayerTwoId:
+		g.PlayerTwoScore++
+	}
+	if winner != 0 || g.TiePolicy != TiePolicyReplay {
+		g.CurrentRound++
+	}
+
+	finished, gameWinner := g.Decided()
+	if !finished {
+		return
+	}
+	if gameWinner == 0 && g.TiePolicy == TiePolicySuddenDeath && g.Mode != GameModeFirstTo {
+		// level after the last round: play one more
+		g.TotalRounds++
+		return
+	}
+	g.Finished = true
+	g.Winner = gameWinner
+}
@@ -0,0 +1,188 @@
+package domain_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/ellisbywater/http-rock-paper-scissors/internal/domain"
+)
+
+const (
+	one = 1
+	two = 2
+	tie = 0
+)
+
+func TestGameCreateRequestValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		req  domain.GameCreateRequest
+		// want is the request after Validate; only checked when err is nil
+		want domain.GameCreateRequest
+		err  error
+	}{
+		{
+			name: "defaults to best_of counting ties",
+			req:  domain.GameCreateRequest{PlayerOneID: one, PlayerTwoID: two, TotalRounds: 5},
+			want: domain.GameCreateRequest{PlayerOneID: one, PlayerTwoID: two, TotalRounds: 5, Mode: domain.GameModeBestOf, TargetScore: 3, TiePolicy: domain.TiePolicyCount},
+		},
+		{
+			name: "best_of target score is a majority",
+			req:  domain.GameCreateRequest{PlayerOneID: one, PlayerTwoID: two, TotalRounds: 4, Mode: " Best_Of ", TargetScore: 9},
+			want: domain.GameCreateRequest{PlayerOneID: one, PlayerTwoID: two, TotalRounds: 4, Mode: domain.GameModeBestOf, TargetScore: 3, TiePolicy: domain.TiePolicyCount},
+		},
+		{
+			name: "first_to has unbounded rounds",
+			req:  domain.GameCreateRequest{PlayerOneID: one, PlayerTwoID: two, TotalRounds: 7, Mode: domain.GameModeFirstTo, TargetScore: 2},
+			want: domain.GameCreateRequest{PlayerOneID: one, PlayerTwoID: two, TotalRounds: 0, Mode: domain.GameModeFirstTo, TargetScore: 2, TiePolicy: domain.TiePolicyCount},
+		},
+		{
+			name: "same player twice",
+			req:  domain.GameCreateRequest{PlayerOneID: one, PlayerTwoID: one, TotalRounds: 3},
+			err:  domain.ErrInvalidPlayers,
+		},
+		{
+			name: "best_of without rounds",
+			req:  domain.GameCreateRequest{PlayerOneID: one, PlayerTwoID: two},
+			err:  domain.ErrInvalidGameMode,
+		},
+		{
+			name: "first_to without a target",
+			req:  domain.GameCreateRequest{PlayerOneID: one, PlayerTwoID: two, Mode: domain.GameModeFirstTo},
+			err:  domain.ErrInvalidGameMode,
+		},
+		{
+			name: "replay applies to first_to",
+			req:  domain.GameCreateRequest{PlayerOneID: one, PlayerTwoID: two, Mode: domain.GameModeFirstTo, TargetScore: 3, TiePolicy: "REPLAY"},
+			want: domain.GameCreateRequest{PlayerOneID: one, PlayerTwoID: two, Mode: domain.GameModeFirstTo, TargetScore: 3, TiePolicy: domain.TiePolicyReplay},
+		},
+		{
+			name: "sudden_death applies to best_of",
+			req:  domain.GameCreateRequest{PlayerOneID: one, PlayerTwoID: two, TotalRounds: 3, TiePolicy: domain.TiePolicySuddenDeath},
+			want: domain.GameCreateRequest{PlayerOneID: one, PlayerTwoID: two, TotalRounds: 3, Mode: domain.GameModeBestOf, TargetScore: 2, TiePolicy: domain.TiePolicySuddenDeath},
+		},
+		{
+			name: "unknown mode",
+			req:  domain.GameCreateRequest{PlayerOneID: one, PlayerTwoID: two, TotalRounds: 3, Mode: "marathon"},
+			err:  domain.ErrInvalidGameMode,
+		},
+		{
+			name: "unknown tie policy",
+			req:  domain.GameCreateRequest{PlayerOneID: one, PlayerTwoID: two, TotalRounds: 3, TiePolicy: "coin_flip"},
+			err:  domain.ErrInvalidTiePolicy,
+		},
+		{
+			name: "sudden_death in a first_to game",
+			req:  domain.GameCreateRequest{PlayerOneID: one, PlayerTwoID: two, Mode: domain.GameModeFirstTo, TargetScore: 3, TiePolicy: domain.TiePolicySuddenDeath},
+			err:  domain.ErrInvalidTiePolicy,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := tt.req
+			err := req.Validate()
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("Validate() error = %v, want %v", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if req.TotalRounds != tt.want.TotalRounds || req.Mode != tt.want.Mode || req.TargetScore != tt.want.TargetScore || req.TiePolicy != tt.want.TiePolicy {
+				t.Fatalf("validated request = %+v, want %+v", req, tt.want)
+			}
+		})
+	}
+}
+
+// playRounds applies each round winner in turn, failing if the game finishes
+// before the last one.
+func playRounds(t *testing.T, g *domain.GameResponse, winners ...int) {
+	t.Helper()
+	for i, winner := range winners {
+		if g.Finished {
+			t.Fatalf("game finished after %d of %d rounds", i, len(winners))
+		}
+		g.ApplyRoundResult(winner)
+	}
+}
+
+func newGame(mode string, totalRounds, targetScore int, tiePolicy string) *domain.GameResponse {
+	return &domain.GameResponse{
+		PlayerOneId:  one,
+		PlayerTwoId:  two,
+		CurrentRound: 1,
+		Mode:         mode,
+		TotalRounds:  totalRounds,
+		TargetScore:  targetScore,
+		TiePolicy:    tiePolicy,
+	}
+}
+
+func TestApplyRoundResultModes(t *testing.T) {
+	tests := []struct {
+		name    string
+		game    *domain.GameResponse
+		winners []int
+		// the game after the last round
+		finished     bool
+		winner       int
+		currentRound int
+	}{
+		{"best_of 5 decided at 3-0", newGame(domain.GameModeBestOf, 5, 3, domain.TiePolicyCount), []int{one, one, one}, true, one, 4},
+		{"best_of 5 open at 2-0", newGame(domain.GameModeBestOf, 5, 3, domain.TiePolicyCount), []int{one, one}, false, 0, 3},
+		{"best_of 5 decided at 3-1", newGame(domain.GameModeBestOf, 5, 3, domain.TiePolicyCount), []int{two, one, two, two}, true, two, 5},
+		{"best_of 3 goes the distance", newGame(domain.GameModeBestOf, 3, 2, domain.TiePolicyCount), []int{one, two, two}, true, two, 4},
+		{"best_of 4 decided at 2-0 with a round left", newGame(domain.GameModeBestOf, 4, 3, domain.TiePolicyCount), []int{one, tie, one}, true, one, 4},
+		{"first_to 2 plays past any round count", newGame(domain.GameModeFirstTo, 0, 2, domain.TiePolicyCount), []int{one, two, tie, tie}, false, 0, 5},
+		{"first_to 2 ends at the target", newGame(domain.GameModeFirstTo, 0, 2, domain.TiePolicyCount), []int{one, two, tie, two}, true, two, 5},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := tt.game
+			playRounds(t, g, tt.winners...)
+			if g.Finished != tt.finished || g.Winner != tt.winner || g.CurrentRound != tt.currentRound {
+				t.Fatalf("finished=%v winner=%d current_round=%d, want finished=%v winner=%d current_round=%d",
+					g.Finished, g.Winner, g.CurrentRound, tt.finished, tt.winner, tt.currentRound)
+			}
+		})
+	}
+}
+
+func TestApplyRoundResultTiePolicies(t *testing.T) {
+	tests := []struct {
+		name    string
+		game    *domain.GameResponse
+		winners []int
+		// the game after the last round
+		finished     bool
+		winner       int
+		currentRound int
+		totalRounds  int
+	}{
+		{"best_of count: a tie is a played round", newGame(domain.GameModeBestOf, 3, 2, domain.TiePolicyCount), []int{tie, one}, false, 0, 3, 3},
+		{"best_of count: level after the last round is a draw", newGame(domain.GameModeBestOf, 3, 2, domain.TiePolicyCount), []int{one, tie, two}, true, 0, 4, 3},
+		{"best_of replay: a tie keeps the round", newGame(domain.GameModeBestOf, 3, 2, domain.TiePolicyReplay), []int{tie, tie}, false, 0, 1, 3},
+		{"best_of replay: every round has a winner", newGame(domain.GameModeBestOf, 3, 2, domain.TiePolicyReplay), []int{one, tie, two, tie, tie, one}, true, one, 4, 3},
+		{"best_of sudden_death: a tie is a played round", newGame(domain.GameModeBestOf, 3, 2, domain.TiePolicySuddenDeath), []int{tie, one}, false, 0, 3, 3},
+		{"best_of sudden_death: level adds a round", newGame(domain.GameModeBestOf, 3, 2, domain.TiePolicySuddenDeath), []int{one, tie, two}, false, 0, 4, 4},
+		{"best_of sudden_death: the extra round decides", newGame(domain.GameModeBestOf, 3, 2, domain.TiePolicySuddenDeath), []int{one, tie, two, two}, true, two, 5, 4},
+		{"best_of sudden_death: until someone wins", newGame(domain.GameModeBestOf, 1, 1, domain.TiePolicySuddenDeath), []int{tie, tie, tie, one}, true, one, 5, 4},
+		{"first_to count: a tie is a played round", newGame(domain.GameModeFirstTo, 0, 1, domain.TiePolicyCount), []int{tie, tie}, false, 0, 3, 0},
+		{"first_to count: ends at the target", newGame(domain.GameModeFirstTo, 0, 1, domain.TiePolicyCount), []int{tie, two}, true, two, 3, 0},
+		{"first_to replay: a tie keeps the round", newGame(domain.GameModeFirstTo, 0, 1, domain.TiePolicyReplay), []int{tie, tie}, false, 0, 1, 0},
+		{"first_to replay: ends at the target", newGame(domain.GameModeFirstTo, 0, 1, domain.TiePolicyReplay), []int{tie, tie, one}, true, one, 2, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := tt.game
+			playRounds(t, g, tt.winners...)
+			if g.Finished != tt.finished || g.Winner != tt.winner || g.CurrentRound != tt.currentRound || g.TotalRounds != tt.totalRounds {
+				t.Fatalf("finished=%v winner=%d current_round=%d total_rounds=%d, want finished=%v winner=%d current_round=%d total_rounds=%d",
+					g.Finished, g.Winner, g.CurrentRound, g.TotalRounds, tt.finished, tt.winner, tt.currentRound, tt.totalRounds)
+			}
+		})
+	}
+}
@@ -0,0 +1,24 @@
+package domain
+
+import (
+	"math"
+	"testing"
+)
+
+// TestGlicko2Example is the worked example of Glickman's "Example of the
+// Glicko-2 system": a 1500 player with deviation 200 beats a 1400 player and
+// loses to a 1550 and a 1700 one in a single rating period.
+func TestGlicko2Example(t *testing.T) {
+	player := Rating{Rating: 1500, Deviation: 200, Volatility: 0.06}
+	results := []glicko2Result{
+		{Rating{Rating: 1400, Deviation: 30, Volatility: 0.06}, 1},
+		{Rating{Rating: 1550, Deviation: 100, Volatility: 0.06}, 0},
+		{Rating{Rating: 1700, Deviation: 300, Volatility: 0.06}, 0},
+	}
+	got := glicko2{}.update(player, results)
+	want := Rating{Rating: 1464.06, Deviation: 151.52, Volatility: 0.05999}
+	if math.Abs(got.Rating-want.Rating) > 0.01 || math.Abs(got.Deviation-want.Deviation) > 0.01 ||
+		math.Abs(got.Volatility-want.Volatility) > 0.00001 {
+		t.Fatalf("update() = %+v, want about %+v", got, want)
+	}
+}
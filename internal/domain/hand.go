@@ -0,0 +1,168 @@
+package domain
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Hand is a move played in a round. The zero value is NoHand, which means the
+// player has not played yet and is stored as NULL / "none".
+//
+// Which hands are legal depends on the game's RuleSet; ParseHand only checks
+// that the input is a well formed weapon name.
+type Hand string
+
+const (
+	NoHand   Hand = ""
+	Rock     Hand = "rock"
+	Paper    Hand = "paper"
+	Scissors Hand = "scissors"
+	Lizard   Hand = "lizard"
+	Spock    Hand = "spock"
+
+	// HiddenHand stands in for a hand the viewer is not allowed to see yet.
+	// It only ever appears in responses and can never be played.
+	HiddenHand Hand = "hidden"
+)
+
+const maxHandLength = 32
+
+var ErrInvalidHand = newError(KindValidation, "invalid_hand", "invalid hand")
+
+// ParseHand turns user input into a Hand. Names are lower-cased and may only
+// contain letters, digits, '-' and '_'. "none" and "hidden" are not moves and
+// are rejected.
+func ParseHand(s string) (Hand, error) {
+	name := strings.ToLower(strings.TrimSpace(s))
+	if name == "" || name == "none" {
+		return NoHand, fmt.Errorf("%w %q: a weapon name is required", ErrInvalidHand, s)
+	}
+	if Hand(name) == HiddenHand {
+		return NoHand, fmt.Errorf("%w %q: reserved name", ErrInvalidHand, s)
+	}
+	if len(name) > maxHandLength {
+		return NoHand, fmt.Errorf("%w %q: longer than %d characters", ErrInvalidHand, s, maxHandLength)
+	}
+	for _, c := range name {
+		if (c < 'a' || c > 'z') && (c < '0' || c > '9') && c != '-' && c != '_' {
+			return NoHand, fmt.Errorf("%w %q: only letters, digits, '-' and '_' are allowed", ErrInvalidHand, s)
+		}
+	}
+	return Hand(name), nil
+}
+
+func (h Hand) String() string {
+	if h == NoHand {
+		return "none"
+	}
+	return string(h)
+}
+
+func (h Hand) IsNone() bool {
+	return h == NoHand
+}
+
+func (h Hand) MarshalJSON() ([]byte, error) {
+	return json.Marshal(h.String())
+}
+
+func (h *Hand) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		*h = NoHand
+		return nil
+	}
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("%w: hand must be a string", ErrInvalidHand)
+	}
+	if s == "" || s == "none" {
+		*h = NoHand
+		return nil
+	}
+	parsed, err := ParseHand(s)
+	if err != nil {
+		return err
+	}
+	*h = parsed
+	return nil
+}
+
+// Scan implements sql.Scanner so hand columns (NULL, 'none' or a move) can be
+// read straight into a Hand.
+func (h *Hand) Scan(src any) error {
+	s, err := scanString(src)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidHand, err)
+	}
+	if s == "" || s == "none" {
+		*h = NoHand
+		return nil
+	}
+	parsed, err := ParseHand(s)
+	if err != nil {
+		return err
+	}
+	*h = parsed
+	return nil
+}
+
+// Value implements driver.Valuer. NoHand is written as NULL.
+func (h Hand) Value() (driver.Value, error) {
+	if h == NoHand {
+		return nil, nil
+	}
+	return string(h), nil
+}
+
+// Weapons is an ordered list of hands, stored as a comma separated string.
+type Weapons []Hand
+
+func (ws Weapons) String() string {
+	names := make([]string, len(ws))
+	for i, h := range ws {
+		names[i] = h.String()
+	}
+	return strings.Join(names, ", ")
+}
+
+func (ws *Weapons) Scan(src any) error {
+	s, err := scanString(src)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidRuleSet, err)
+	}
+	*ws = nil
+	if s == "" {
+		return nil
+	}
+	for _, name := range strings.Split(s, ",") {
+		h, err := ParseHand(name)
+		if err != nil {
+			return err
+		}
+		*ws = append(*ws, h)
+	}
+	return nil
+}
+
+func (ws Weapons) Value() (driver.Value, error) {
+	names := make([]string, len(ws))
+	for i, h := range ws {
+		names[i] = string(h)
+	}
+	return strings.Join(names, ","), nil
+}
+
+func scanString(src any) (string, error) {
+	switch v := src.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case []byte:
+		return string(v), nil
+	default:
+		return "", fmt.Errorf("cannot scan %T", src)
+	}
+}
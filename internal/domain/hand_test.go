@@ -0,0 +1,97 @@
+package domain_test
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/ellisbywater/http-rock-paper-scissors/internal/domain"
+)
+
+func TestParseHand(t *testing.T) {
+	tests := []struct {
+		in   string
+		want domain.Hand
+		ok   bool
+	}{
+		{"rock", domain.Rock, true},
+		{"Rock", domain.Rock, true},
+		{"  PAPER\t", domain.Paper, true},
+		{"scissors\n", domain.Scissors, true},
+		{"spock", domain.Spock, true},
+		{"fire-ball_2", "fire-ball_2", true},
+		{"", domain.NoHand, false},
+		{"   ", domain.NoHand, false},
+		{"none", domain.NoHand, false},
+		{"None", domain.NoHand, false},
+		{"hidden", domain.NoHand, false},
+		{"rock paper", domain.NoHand, false},
+		{"rock,paper", domain.NoHand, false},
+		{"røck", domain.NoHand, false},
+		{"abcdefghijklmnopqrstuvwxyz0123456", domain.NoHand, false},
+	}
+	for _, tt := range tests {
+		got, err := domain.ParseHand(tt.in)
+		if tt.ok {
+			if err != nil || got != tt.want {
+				t.Errorf("ParseHand(%q) = %q, %v; want %q", tt.in, got, err, tt.want)
+			}
+			continue
+		}
+		if !errors.Is(err, domain.ErrInvalidHand) || got != domain.NoHand {
+			t.Errorf("ParseHand(%q) = %q, %v; want ErrInvalidHand", tt.in, got, err)
+		}
+	}
+}
+
+func TestHandJSON(t *testing.T) {
+	tests := []struct {
+		in   string
+		want domain.Hand
+		ok   bool
+	}{
+		{`"Rock"`, domain.Rock, true},
+		{`"none"`, domain.NoHand, true},
+		{`""`, domain.NoHand, true},
+		{`null`, domain.NoHand, true},
+		{`"hidden"`, domain.NoHand, false},
+		{`"rock paper"`, domain.NoHand, false},
+		{`3`, domain.NoHand, false},
+	}
+	for _, tt := range tests {
+		var got domain.Hand
+		err := json.Unmarshal([]byte(tt.in), &got)
+		if tt.ok != (err == nil) || got != tt.want {
+			t.Errorf("unmarshal %s = %q, %v", tt.in, got, err)
+		}
+	}
+
+	for h, want := range map[domain.Hand]string{domain.NoHand: `"none"`, domain.Lizard: `"lizard"`} {
+		got, err := json.Marshal(h)
+		if err != nil || string(got) != want {
+			t.Errorf("marshal %q = %s, %v; want %s", h, got, err, want)
+		}
+	}
+}
+
+func TestHandSQL(t *testing.T) {
+	for _, src := range []any{nil, "none", []byte("")} {
+		h := domain.Rock
+		if err := h.Scan(src); err != nil || h != domain.NoHand {
+			t.Errorf("Scan(%v) = %q, %v; want none", src, h, err)
+		}
+	}
+	var h domain.Hand
+	if err := h.Scan([]byte("scissors")); err != nil || h != domain.Scissors {
+		t.Errorf("Scan(scissors) = %q, %v", h, err)
+	}
+	if err := h.Scan(42); !errors.Is(err, domain.ErrInvalidHand) {
+		t.Errorf("Scan(42) error = %v, want ErrInvalidHand", err)
+	}
+	if v, err := domain.NoHand.Value(); v != nil || err != nil {
+		t.Errorf("NoHand.Value() = %v, %v; want NULL", v, err)
+	}
+	if v, err := domain.Paper.Value(); v != "paper" || err != nil {
+		t.Errorf("Paper.Value() = %v, %v", v, err)
+	}
+}
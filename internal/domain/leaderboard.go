@@ -0,0 +1,213 @@
+package domain
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// The leaderboard is not computed per request. LeaderboardRepository.Refresh
+// rebuilds it from the finished games every so often and stores each entry's
+// rank under every sort, so listing is a lookup by rank. Repositories either
+// build it from the games with BuildLeaderboard or count the games themselves
+// and rank the entries with RankLeaderboard.
+
+const (
+	LeaderboardSortRating  = "rating"
+	LeaderboardSortWins    = "wins"
+	LeaderboardSortWinRate = "win_rate"
+	LeaderboardSortStreak  = "streak"
+
+	LeaderboardWindowAll   = "all"
+	LeaderboardWindowWeek  = "7d"
+	LeaderboardWindowMonth = "30d"
+
+	// DefaultLeaderboardMinGames is how many games a player needs in a window
+	// to be ranked by win rate.
+	DefaultLeaderboardMinGames = 5
+)
+
+// LeaderboardWindows maps each window to how far back it reaches; 0 is all time.
+var LeaderboardWindows = map[string]time.Duration{
+	LeaderboardWindowAll:   0,
+	LeaderboardWindowWeek:  7 * 24 * time.Hour,
+	LeaderboardWindowMonth: 30 * 24 * time.Hour,
+}
+
+var ErrInvalidLeaderboard = newError(KindValidation, "invalid_leaderboard", "invalid leaderboard")
+
+// LeaderboardEntry is a player's standing in one window. Only players with a
+// finished game in the window have one.
+type LeaderboardEntry struct {
+	// Rank is the entry's place under the listed sort.
+	Rank     int     `json:"rank"`
+	PlayerID int     `json:"player_id"`
+	UserName string  `json:"username"`
+	Rating   float64 `json:"rating"`
+
+	GamesPlayed      int     `json:"games_played"`
+	GamesWon         int     `json:"games_won"`
+	GamesLost        int     `json:"games_lost"`
+	GamesDrawn       int     `json:"games_drawn"`
+	WinRate          float64 `json:"win_rate"`
+	LongestWinStreak int     `json:"longest_win_streak"`
+
+	// The entry's rank under each sort. WinRateRank is 0 for players below
+	// the minimum number of games.
+	Window      string    `json:"-"`
+	RatingRank  int       `json:"-"`
+	WinsRank    int       `json:"-"`
+	WinRateRank int       `json:"-"`
+	StreakRank  int       `json:"-"`
+	RefreshedAt time.Time `json:"-"`
+}
+
+// SortRank is the entry's rank under sort.
+func (e *LeaderboardEntry) SortRank(sort string) int {
+	switch sort {
+	case LeaderboardSortWins:
+		return e.WinsRank
+	case LeaderboardSortWinRate:
+		return e.WinRateRank
+	case LeaderboardSortStreak:
+		return e.StreakRank
+	default:
+		return e.RatingRank
+	}
+}
+
+// BuildLeaderboard ranks the players of the finished games created at or after
+// since; a zero since takes every game. games must be ordered by created_at
+// then id, and players must include everyone who played them.
+func BuildLeaderboard(window string, since time.Time, games []GameResponse, players []PlayerResponse, minGames int, now time.Time) []LeaderboardEntry {
+	stats := map[int]*PlayerStats{}
+	var order []int
+	for i := range games {
+		g := &games[i]
+		if !g.Finished || g.CreatedAt.Before(since) {
+			continue
+		}
+		for _, id := range []int{g.PlayerOneId, g.PlayerTwoId} {
+			s, ok := stats[id]
+			if !ok {
+				s = &PlayerStats{PlayerID: id}
+				stats[id] = s
+				order = append(order, id)
+			}
+			s.AddGame(true, g.Winner)
+		}
+	}
+
+	byID := map[int]PlayerResponse{}
+	for _, p := range players {
+		byID[p.ID] = p
+	}
+	entries := make([]LeaderboardEntry, 0, len(order))
+	for _, id := range order {
+		s := stats[id]
+		entries = append(entries, LeaderboardEntry{
+			PlayerID:         id,
+			UserName:         byID[id].UserName,
+			Rating:           byID[id].Rating.Rating,
+			GamesPlayed:      s.GamesPlayed,
+			GamesWon:         s.GamesWon,
+			GamesLost:        s.GamesLost,
+			GamesDrawn:       s.GamesDrawn,
+			LongestWinStreak: s.LongestWinStreak,
+			Window:           window,
+			RefreshedAt:      now,
+		})
+	}
+
+	RankLeaderboard(entries, minGames)
+	return entries
+}
+
+// RankLeaderboard sets the win rate of entries that have their games counted
+// and ranks them under every sort. Only entries with at least minGames are
+// ranked by win rate. The entries end up ordered by player id.
+func RankLeaderboard(entries []LeaderboardEntry, minGames int) {
+	for i := range entries {
+		entries[i].WinRate = ratio(entries[i].GamesWon, entries[i].GamesPlayed)
+	}
+	rank(entries, func(e *LeaderboardEntry) float64 { return e.Rating }, func(e *LeaderboardEntry, r int) { e.RatingRank = r })
+	rank(entries, func(e *LeaderboardEntry) float64 { return float64(e.GamesWon) }, func(e *LeaderboardEntry, r int) { e.WinsRank = r })
+	rank(entries, func(e *LeaderboardEntry) float64 { return float64(e.LongestWinStreak) }, func(e *LeaderboardEntry, r int) { e.StreakRank = r })
+	var qualified []*LeaderboardEntry
+	for i := range entries {
+		if entries[i].GamesPlayed >= minGames {
+			qualified = append(qualified, &entries[i])
+		}
+	}
+	sort.SliceStable(qualified, func(i, j int) bool {
+		return higher(qualified[i].WinRate, qualified[j].WinRate, qualified[i].PlayerID, qualified[j].PlayerID)
+	})
+	for i, e := range qualified {
+		e.WinRateRank = i + 1
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].PlayerID < entries[j].PlayerID })
+}
+
+// rank numbers the entries 1, 2, ... by key, highest first. Ties go to the
+// lower player id so every entry has its own rank.
+func rank(entries []LeaderboardEntry, key func(*LeaderboardEntry) float64, set func(*LeaderboardEntry, int)) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		return higher(key(&entries[i]), key(&entries[j]), entries[i].PlayerID, entries[j].PlayerID)
+	})
+	for i := range entries {
+		set(&entries[i], i+1)
+	}
+}
+
+func higher(a, b float64, aID, bID int) bool {
+	if a != b {
+		return a > b
+	}
+	return aID < bID
+}
+
+type LeaderboardFilter struct {
+	Sort   string
+	Window string
+	// Limit is the page size. Repositories return at most Limit entries.
+	Limit int
+	// After is the last entry of the previous page; its ID is the rank.
+	After *Cursor
+}
+
+// Validate checks the filter and fills in the defaults: rating, all time and
+// the default page size.
+func (f *LeaderboardFilter) Validate() error {
+	limit, err := checkLimit(f.Limit)
+	if err != nil {
+		return err
+	}
+	f.Limit = limit
+	switch f.Sort {
+	case "":
+		f.Sort = LeaderboardSortRating
+	case LeaderboardSortRating, LeaderboardSortWins, LeaderboardSortWinRate, LeaderboardSortStreak:
+	default:
+		return fmt.Errorf("%w: sort must be %s, %s, %s or %s", ErrInvalidLeaderboard,
+			LeaderboardSortRating, LeaderboardSortWins, LeaderboardSortWinRate, LeaderboardSortStreak)
+	}
+	if f.Window == "" {
+		f.Window = LeaderboardWindowAll
+	}
+	if _, ok := LeaderboardWindows[f.Window]; !ok {
+		return fmt.Errorf("%w: window must be %s, %s or %s", ErrInvalidLeaderboard,
+			LeaderboardWindowAll, LeaderboardWindowWeek, LeaderboardWindowMonth)
+	}
+	return nil
+}
+
+type LeaderboardPage struct {
+	Sort   string `json:"sort"`
+	Window string `json:"window"`
+	// RefreshedAt is when the leaderboard was last rebuilt; games finished
+	// since then are not counted yet.
+	RefreshedAt time.Time          `json:"refreshed_at,omitzero"`
+	Entries     []LeaderboardEntry `json:"entries"`
+	NextCursor  string             `json:"next_cursor,omitempty"`
+}
@@ -0,0 +1,93 @@
+package domain_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ellisbywater/http-rock-paper-scissors/internal/domain"
+)
+
+func TestBuildLeaderboard(t *testing.T) {
+	since := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	now := since.Add(7 * 24 * time.Hour)
+	var games []domain.GameResponse
+	// play adds a game of one against two, created after the previous one
+	play := func(one, two, winner int, finished bool) {
+		games = append(games, domain.GameResponse{
+			ID:          len(games) + 1,
+			PlayerOneId: one,
+			PlayerTwoId: two,
+			Winner:      winner,
+			Finished:    finished,
+			CreatedAt:   since.Add(time.Duration(len(games)-1) * time.Hour),
+		})
+	}
+	// before the window
+	play(4, 1, 4, true)
+	play(1, 3, 1, true)
+	play(1, 3, 1, true)
+	play(2, 4, 2, true)
+	play(2, 4, 2, true)
+	play(3, 1, 3, true)
+	play(4, 2, 0, true)
+	play(5, 4, 5, true)
+	// not over yet
+	play(3, 5, 3, false)
+
+	players := []domain.PlayerResponse{
+		{ID: 1, UserName: "one", Rating: domain.Rating{Rating: 1500}},
+		{ID: 2, UserName: "two", Rating: domain.Rating{Rating: 1600}},
+		{ID: 3, UserName: "three", Rating: domain.Rating{Rating: 1500}},
+		{ID: 4, UserName: "four", Rating: domain.Rating{Rating: 1400}},
+		{ID: 5, UserName: "five", Rating: domain.Rating{Rating: 1600}},
+		{ID: 6, UserName: "idle", Rating: domain.Rating{Rating: 1700}},
+	}
+
+	entry := func(id int, name string, rating float64, played, won, lost, drawn int, winRate float64, streak int, ranks [4]int) domain.LeaderboardEntry {
+		return domain.LeaderboardEntry{
+			PlayerID: id, UserName: name, Rating: rating,
+			GamesPlayed: played, GamesWon: won, GamesLost: lost, GamesDrawn: drawn,
+			WinRate: winRate, LongestWinStreak: streak,
+			Window: domain.LeaderboardWindowWeek, RefreshedAt: now,
+			RatingRank: ranks[0], WinsRank: ranks[1], WinRateRank: ranks[2], StreakRank: ranks[3],
+		}
+	}
+	// ties go to the lower player id under every sort: one and two tie on
+	// wins, win rate and streak, three and five on streak. Five won its only
+	// game, which is below the minimum of three to be ranked by win rate.
+	want := []domain.LeaderboardEntry{
+		entry(1, "one", 1500, 3, 2, 1, 0, 0.6667, 2, [4]int{3, 1, 1, 1}),
+		entry(2, "two", 1600, 3, 2, 0, 1, 0.6667, 2, [4]int{1, 2, 2, 2}),
+		entry(3, "three", 1500, 3, 1, 2, 0, 0.3333, 1, [4]int{4, 3, 3, 3}),
+		entry(4, "four", 1400, 4, 0, 3, 1, 0, 0, [4]int{5, 5, 4, 5}),
+		entry(5, "five", 1600, 1, 1, 0, 0, 1, 1, [4]int{2, 4, 0, 4}),
+	}
+	got := domain.BuildLeaderboard(domain.LeaderboardWindowWeek, since, games, players, 3, now)
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("BuildLeaderboard =\n%+v\nwant\n%+v", got, want)
+	}
+
+	// with the minimum at a single game, five's perfect record comes first
+	got = domain.BuildLeaderboard(domain.LeaderboardWindowWeek, since, games, players, 1, now)
+	for i, rank := range []int{2, 3, 4, 5, 1} {
+		if got[i].WinRateRank != rank {
+			t.Fatalf("player %d has win rate rank %d, want %d", got[i].PlayerID, got[i].WinRateRank, rank)
+		}
+	}
+}
+
+func TestRankLeaderboardBreaksStreakTies(t *testing.T) {
+	// every player has the same streak; ids settle it, whatever the order
+	entries := []domain.LeaderboardEntry{
+		{PlayerID: 9, GamesPlayed: 4, GamesWon: 3, LongestWinStreak: 2},
+		{PlayerID: 2, GamesPlayed: 2, GamesWon: 2, LongestWinStreak: 2},
+		{PlayerID: 5, GamesPlayed: 5, GamesWon: 2, LongestWinStreak: 2},
+	}
+	domain.RankLeaderboard(entries, 3)
+	for i, want := range []struct{ id, streakRank, winRateRank int }{{2, 1, 0}, {5, 2, 2}, {9, 3, 1}} {
+		if e := entries[i]; e.PlayerID != want.id || e.StreakRank != want.streakRank || e.WinRateRank != want.winRateRank {
+			t.Fatalf("entry %d = %+v, want player %d at streak rank %d and win rate rank %d", i, e, want.id, want.streakRank, want.winRateRank)
+		}
+	}
+}
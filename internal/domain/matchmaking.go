@@ -0,0 +1,155 @@
+package domain
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// Players waiting in the matchmaking queue are paired with the closest
+// rated player they are compatible with. A player only accepts opponents
+// within their rating window, which starts at InitialMatchWindow and widens
+// by MatchWindowGrowth every MatchWindowStep they wait, so nobody waits
+// forever for a close match.
+
+const (
+	MatchStatusQueued = "queued"
+	// MatchStatusMatching is a ticket that has been paired and whose game is
+	// being created. It stays in the queue until the game exists, or goes
+	// back to queued if it cannot be created.
+	MatchStatusMatching = "matching"
+	MatchStatusMatched  = "matched"
+	// MatchStatusFailed is a ticket taken out of the queue after
+	// MaxMatchFailures attempts at creating its game failed.
+	MatchStatusFailed = "failed"
+
+	// MaxMatchFailures is how many times a ticket's game may fail to be
+	// created before the ticket is given up.
+	MaxMatchFailures = 3
+
+	InitialMatchWindow = 50.0
+	MatchWindowGrowth  = 50.0
+	MatchWindowStep    = 10 * time.Second
+
+	// DefaultMatchRounds is the length of a matched game when neither player
+	// asked for one.
+	DefaultMatchRounds = 3
+)
+
+var (
+	ErrAlreadyQueued       = newError(KindConflict, "already_queued", "you are already in the matchmaking queue")
+	ErrNotQueued           = newError(KindNotFound, "not_queued", "you are not in the matchmaking queue")
+	ErrMatchInProgress     = newError(KindConflict, "match_in_progress", "your match is being created")
+	ErrInvalidMatchRequest = newError(KindValidation, "invalid_matchmaking_request", "invalid matchmaking request")
+)
+
+// MatchRequest is what a player wants from a matched game. Zero values
+// accept whatever the opponent asked for.
+type MatchRequest struct {
+	TotalRounds int    `json:"total_rounds"`
+	RuleSet     string `json:"rule_set"`
+}
+
+func (req *MatchRequest) Validate() error {
+	if req.TotalRounds < 0 {
+		return fmt.Errorf("%w: total_rounds cannot be negative", ErrInvalidMatchRequest)
+	}
+	req.RuleSet = strings.ToLower(strings.TrimSpace(req.RuleSet))
+	// custom rule sets need weapons, which two strangers cannot agree on
+	if req.RuleSet == RuleSetCustom {
+		return fmt.Errorf("%w: rule_set must be %s or %s", ErrInvalidMatchRequest, RuleSetClassic, RuleSetRPSLS)
+	}
+	if _, err := NewRuleSet(req.RuleSet, nil); err != nil {
+		return fmt.Errorf("%w: rule_set must be %s or %s", ErrInvalidMatchRequest, RuleSetClassic, RuleSetRPSLS)
+	}
+	return nil
+}
+
+// MatchTicket is a player's place in the queue, and once matched, the game
+// they were matched into.
+type MatchTicket struct {
+	PlayerID int          `json:"player_id"`
+	Status   string       `json:"status"`
+	Request  MatchRequest `json:"request"`
+	Rating   float64      `json:"rating"`
+	// Window is how far from Rating an opponent may be, as of the request.
+	Window     float64   `json:"rating_window,omitempty"`
+	JoinedAt   time.Time `json:"joined_at"`
+	GameID     int       `json:"game_id,omitempty"`
+	OpponentID int       `json:"opponent_id,omitempty"`
+	MatchedAt  time.Time `json:"matched_at,omitzero"`
+	// Failures counts the failed attempts at creating the ticket's game;
+	// Error is why the last one failed.
+	Failures int    `json:"failures,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// MatchWindow is the rating window of a player who joined at joinedAt.
+func MatchWindow(joinedAt time.Time, now time.Time) float64 {
+	steps := math.Floor(float64(now.Sub(joinedAt)) / float64(MatchWindowStep))
+	return InitialMatchWindow + MatchWindowGrowth*max(steps, 0)
+}
+
+// Accepts reports whether t and other can play each other at now: their
+// requests agree and each is within the other's rating window.
+func (t *MatchTicket) Accepts(other *MatchTicket, now time.Time) bool {
+	if t.Request.TotalRounds != 0 && other.Request.TotalRounds != 0 && t.Request.TotalRounds != other.Request.TotalRounds {
+		return false
+	}
+	if t.Request.RuleSet != "" && other.Request.RuleSet != "" && t.Request.RuleSet != other.Request.RuleSet {
+		return false
+	}
+	gap := math.Abs(t.Rating - other.Rating)
+	return gap <= MatchWindow(t.JoinedAt, now) && gap <= MatchWindow(other.JoinedAt, now)
+}
+
+// GameRequest is the game a match between t and other is played as. The
+// player who waited longer is player one.
+func (t *MatchTicket) GameRequest(other *MatchTicket) GameCreateRequest {
+	one, two := t, other
+	if two.JoinedAt.Before(one.JoinedAt) {
+		one, two = two, one
+	}
+	req := GameCreateRequest{
+		PlayerOneID: one.PlayerID,
+		PlayerTwoID: two.PlayerID,
+		TotalRounds: max(one.Request.TotalRounds, two.Request.TotalRounds),
+		RuleSet:     one.Request.RuleSet,
+	}
+	if req.TotalRounds == 0 {
+		req.TotalRounds = DefaultMatchRounds
+	}
+	if req.RuleSet == "" {
+		req.RuleSet = two.Request.RuleSet
+	}
+	return req
+}
+
+// PairTickets pairs the queued tickets of the queue, which is in joining
+// order. Going from the longest waiting player, each is paired with the
+// closest rated player left that they accept, the longer waiting one on a
+// tie. Tickets already matching are left alone.
+func PairTickets(queue []*MatchTicket, now time.Time) [][2]*MatchTicket {
+	var pairs [][2]*MatchTicket
+	paired := make(map[*MatchTicket]bool)
+	for i, t := range queue {
+		if paired[t] || t.Status != MatchStatusQueued {
+			continue
+		}
+		var best *MatchTicket
+		for _, other := range queue[i+1:] {
+			if paired[other] || other.Status != MatchStatusQueued || !t.Accepts(other, now) {
+				continue
+			}
+			if best == nil || math.Abs(t.Rating-other.Rating) < math.Abs(t.Rating-best.Rating) {
+				best = other
+			}
+		}
+		if best != nil {
+			paired[t], paired[best] = true, true
+			pairs = append(pairs, [2]*MatchTicket{t, best})
+		}
+	}
+	return pairs
+}
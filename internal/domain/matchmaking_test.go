@@ -0,0 +1,167 @@
+package domain_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ellisbywater/http-rock-paper-scissors/internal/domain"
+)
+
+var joined = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+// ticket is a queued ticket of player id, who joined wait before joined.
+func ticket(id int, rating float64, wait time.Duration, req domain.MatchRequest) *domain.MatchTicket {
+	return &domain.MatchTicket{PlayerID: id, Status: domain.MatchStatusQueued, Request: req, Rating: rating, JoinedAt: joined.Add(-wait)}
+}
+
+func TestMatchRequestValidate(t *testing.T) {
+	tests := []struct {
+		req  domain.MatchRequest
+		want string
+		err  error
+	}{
+		{domain.MatchRequest{}, "", nil},
+		{domain.MatchRequest{TotalRounds: 5, RuleSet: " RPSLS "}, domain.RuleSetRPSLS, nil},
+		{domain.MatchRequest{TotalRounds: -1}, "", domain.ErrInvalidMatchRequest},
+		{domain.MatchRequest{RuleSet: domain.RuleSetCustom}, "", domain.ErrInvalidMatchRequest},
+		{domain.MatchRequest{RuleSet: "chess"}, "", domain.ErrInvalidMatchRequest},
+	}
+	for _, tt := range tests {
+		req := tt.req
+		err := req.Validate()
+		if !errors.Is(err, tt.err) {
+			t.Fatalf("Validate(%+v) error = %v, want %v", tt.req, err, tt.err)
+		}
+		if err == nil && req.RuleSet != tt.want {
+			t.Fatalf("Validate(%+v) rule_set = %q, want %q", tt.req, req.RuleSet, tt.want)
+		}
+	}
+}
+
+func TestMatchWindow(t *testing.T) {
+	tests := []struct {
+		wait time.Duration
+		want float64
+	}{
+		{0, domain.InitialMatchWindow},
+		{domain.MatchWindowStep - time.Nanosecond, domain.InitialMatchWindow},
+		{domain.MatchWindowStep, domain.InitialMatchWindow + domain.MatchWindowGrowth},
+		{35 * time.Second, domain.InitialMatchWindow + 3*domain.MatchWindowGrowth},
+		// a clock that went backwards does not shrink the window
+		{-time.Minute, domain.InitialMatchWindow},
+	}
+	for _, tt := range tests {
+		if got := domain.MatchWindow(joined, joined.Add(tt.wait)); got != tt.want {
+			t.Errorf("MatchWindow after %v = %v, want %v", tt.wait, got, tt.want)
+		}
+	}
+}
+
+func TestMatchTicketAccepts(t *testing.T) {
+	open := domain.MatchRequest{}
+	tests := []struct {
+		name        string
+		a, b        *domain.MatchTicket
+		waitedSince time.Duration
+		want        bool
+	}{
+		{"same rating", ticket(1, 1500, 0, open), ticket(2, 1500, 0, open), 0, true},
+		{"at the edge of the window", ticket(1, 1500, 0, open), ticket(2, 1550, 0, open), 0, true},
+		{"outside the window", ticket(1, 1500, 0, open), ticket(2, 1551, 0, open), 0, false},
+		{"both windows widened", ticket(1, 1500, 0, open), ticket(2, 1600, 0, open), domain.MatchWindowStep, true},
+		// the newcomer's window is still the initial one
+		{"only one window widened", ticket(1, 1500, time.Minute, open), ticket(2, 1600, 0, open), 0, false},
+		{"any rounds", ticket(1, 1500, 0, domain.MatchRequest{TotalRounds: 5}), ticket(2, 1500, 0, open), 0, true},
+		{"different rounds", ticket(1, 1500, 0, domain.MatchRequest{TotalRounds: 5}), ticket(2, 1500, 0, domain.MatchRequest{TotalRounds: 3}), 0, false},
+		{"any rule set", ticket(1, 1500, 0, open), ticket(2, 1500, 0, domain.MatchRequest{RuleSet: domain.RuleSetRPSLS}), 0, true},
+		{"different rule sets", ticket(1, 1500, 0, domain.MatchRequest{RuleSet: domain.RuleSetClassic}), ticket(2, 1500, 0, domain.MatchRequest{RuleSet: domain.RuleSetRPSLS}), 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := joined.Add(tt.waitedSince)
+			if got := tt.a.Accepts(tt.b, now); got != tt.want {
+				t.Fatalf("a.Accepts(b) = %v, want %v", got, tt.want)
+			}
+			if got := tt.b.Accepts(tt.a, now); got != tt.want {
+				t.Fatalf("b.Accepts(a) = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchTicketGameRequest(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b *domain.MatchTicket
+		want domain.GameCreateRequest
+	}{
+		{name: "defaults", a: ticket(1, 1500, time.Second, domain.MatchRequest{}), b: ticket(2, 1500, 0, domain.MatchRequest{}),
+			want: domain.GameCreateRequest{PlayerOneID: 1, PlayerTwoID: 2, TotalRounds: domain.DefaultMatchRounds}},
+		{name: "longer waiting player is player one", a: ticket(1, 1500, 0, domain.MatchRequest{}), b: ticket(2, 1500, time.Second, domain.MatchRequest{}),
+			want: domain.GameCreateRequest{PlayerOneID: 2, PlayerTwoID: 1, TotalRounds: domain.DefaultMatchRounds}},
+		{name: "one player's wishes", a: ticket(1, 1500, time.Second, domain.MatchRequest{}), b: ticket(2, 1500, 0, domain.MatchRequest{TotalRounds: 7, RuleSet: domain.RuleSetRPSLS}),
+			want: domain.GameCreateRequest{PlayerOneID: 1, PlayerTwoID: 2, TotalRounds: 7, RuleSet: domain.RuleSetRPSLS}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.a.GameRequest(tt.b); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("a.GameRequest(b) = %+v, want %+v", got, tt.want)
+			}
+			if got := tt.b.GameRequest(tt.a); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("b.GameRequest(a) = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPairTickets(t *testing.T) {
+	open := domain.MatchRequest{}
+	matching := ticket(9, 1500, time.Hour, open)
+	matching.Status = domain.MatchStatusMatching
+
+	tests := []struct {
+		name string
+		// queue is in joining order, so waits go down
+		queue []*domain.MatchTicket
+		// now is this long after joined
+		now  time.Duration
+		want [][2]int
+	}{
+		{"empty", nil, 0, nil},
+		{"alone", []*domain.MatchTicket{ticket(1, 1500, 0, open)}, 0, nil},
+		{"closest rating", []*domain.MatchTicket{
+			ticket(1, 1500, 3*time.Second, open), ticket(2, 1540, 2*time.Second, open), ticket(3, 1510, time.Second, open),
+		}, 0, [][2]int{{1, 3}}},
+		{"tie goes to the longer waiting", []*domain.MatchTicket{
+			ticket(1, 1500, 3*time.Second, open), ticket(2, 1480, 2*time.Second, open), ticket(3, 1520, time.Second, open),
+		}, 0, [][2]int{{1, 2}}},
+		{"longest waiting picks first", []*domain.MatchTicket{
+			ticket(1, 1500, 3*time.Second, open), ticket(2, 1530, 2*time.Second, open), ticket(3, 1535, time.Second, open), ticket(4, 1560, 0, open),
+		}, 0, [][2]int{{1, 2}, {3, 4}}},
+		{"too far apart", []*domain.MatchTicket{ticket(1, 1500, 0, open), ticket(2, 1600, 0, open)}, 0, nil},
+		{"window widened with waiting", []*domain.MatchTicket{ticket(1, 1500, 0, open), ticket(2, 1600, 0, open)}, domain.MatchWindowStep, [][2]int{{1, 2}}},
+		{"incompatible requests", []*domain.MatchTicket{
+			ticket(1, 1500, time.Second, domain.MatchRequest{RuleSet: domain.RuleSetRPSLS}), ticket(2, 1500, 0, domain.MatchRequest{RuleSet: domain.RuleSetClassic}),
+		}, 0, nil},
+		{"matching tickets are left alone", []*domain.MatchTicket{matching, ticket(1, 1500, 0, open)}, 0, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pairs := domain.PairTickets(tt.queue, joined.Add(tt.now))
+			var got [][2]int
+			for _, pair := range pairs {
+				got = append(got, [2]int{pair[0].PlayerID, pair[1].PlayerID})
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("pairs = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("pairs = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
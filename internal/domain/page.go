@@ -0,0 +1,184 @@
+package domain
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+const (
+	DefaultPageLimit = 20
+	MaxPageLimit     = 100
+
+	GameStatusFinished   = "finished"
+	GameStatusInProgress = "in_progress"
+
+	GameResultWon  = "won"
+	GameResultLost = "lost"
+)
+
+var (
+	ErrInvalidCursor = newError(KindValidation, "invalid_cursor", "invalid cursor")
+	ErrInvalidFilter = newError(KindValidation, "invalid_filter", "invalid filter")
+)
+
+// Cursor marks the last item of a page; the next page starts after it. Lists
+// are ordered by (CreatedAt, ID), or by ID alone where there is no creation
+// time. Clients only ever see it encoded, see EncodeCursor.
+type Cursor struct {
+	CreatedAt time.Time `json:"t,omitzero"`
+	ID        int       `json:"id"`
+}
+
+// EncodeCursor makes c opaque so clients don't come to depend on its fields.
+func EncodeCursor(c Cursor) string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// DecodeCursor parses a cursor from EncodeCursor. The empty string is the
+// first page and decodes to nil.
+func DecodeCursor(s string) (*Cursor, error) {
+	if s == "" {
+		return nil, nil
+	}
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var c Cursor
+	if err := json.Unmarshal(data, &c); err != nil || c.ID < 1 {
+		return nil, ErrInvalidCursor
+	}
+	return &c, nil
+}
+
+func checkLimit(limit int) (int, error) {
+	switch {
+	case limit == 0:
+		return DefaultPageLimit, nil
+	case limit < 0 || limit > MaxPageLimit:
+		return 0, fmt.Errorf("%w: limit must be between 1 and %d", ErrInvalidFilter, MaxPageLimit)
+	default:
+		return limit, nil
+	}
+}
+
+type PlayerFilter struct {
+	// Limit is the page size. Repositories return at most Limit players.
+	Limit int
+	After *Cursor
+}
+
+// Validate checks the filter and fills in the default page size.
+func (f *PlayerFilter) Validate() error {
+	limit, err := checkLimit(f.Limit)
+	if err != nil {
+		return err
+	}
+	f.Limit = limit
+	return nil
+}
+
+// GameFilter selects games for a listing. Zero fields don't filter.
+type GameFilter struct {
+	// PlayerID and OpponentID keep games either player took part in; set
+	// both for the games between the two.
+	PlayerID   int
+	OpponentID int
+	// Status is GameStatusFinished or GameStatusInProgress.
+	Status string
+	// Result is GameResultWon or GameResultLost, seen from PlayerID. Drawn
+	// games are neither.
+	Result string
+	// CreatedFrom is inclusive, CreatedTo exclusive.
+	CreatedFrom time.Time
+	CreatedTo   time.Time
+
+	// Limit is the page size. Repositories return at most Limit games.
+	Limit int
+	After *Cursor
+}
+
+// Validate checks the filter and fills in the default page size.
+func (f *GameFilter) Validate() error {
+	limit, err := checkLimit(f.Limit)
+	if err != nil {
+		return err
+	}
+	f.Limit = limit
+	switch f.Status {
+	case "", GameStatusFinished, GameStatusInProgress:
+	default:
+		return fmt.Errorf("%w: status must be %s or %s", ErrInvalidFilter, GameStatusFinished, GameStatusInProgress)
+	}
+	switch f.Result {
+	case "":
+	case GameResultWon, GameResultLost:
+		if f.PlayerID == 0 {
+			return fmt.Errorf("%w: result needs a player", ErrInvalidFilter)
+		}
+	default:
+		return fmt.Errorf("%w: result must be %s or %s", ErrInvalidFilter, GameResultWon, GameResultLost)
+	}
+	if f.PlayerID != 0 && f.PlayerID == f.OpponentID {
+		return fmt.Errorf("%w: opponent must differ from player", ErrInvalidFilter)
+	}
+	if !f.CreatedFrom.IsZero() && !f.CreatedTo.IsZero() && !f.CreatedFrom.Before(f.CreatedTo) {
+		return fmt.Errorf("%w: from must be before to", ErrInvalidFilter)
+	}
+	return nil
+}
+
+// Matches reports whether game passes the filter, cursor included. It is the
+// reference the SQL backends' WHERE clauses follow.
+func (f *GameFilter) Matches(game *GameResponse) bool {
+	involved := func(id int) bool {
+		return game.PlayerOneId == id || game.PlayerTwoId == id
+	}
+	if f.PlayerID != 0 && !involved(f.PlayerID) {
+		return false
+	}
+	if f.OpponentID != 0 && !involved(f.OpponentID) {
+		return false
+	}
+	if f.Status == GameStatusFinished && !game.Finished {
+		return false
+	}
+	if f.Status == GameStatusInProgress && game.Finished {
+		return false
+	}
+	if f.Result == GameResultWon && game.Winner != f.PlayerID {
+		return false
+	}
+	if f.Result == GameResultLost && (game.Winner == 0 || game.Winner == f.PlayerID) {
+		return false
+	}
+	if !f.CreatedFrom.IsZero() && game.CreatedAt.Before(f.CreatedFrom) {
+		return false
+	}
+	if !f.CreatedTo.IsZero() && !game.CreatedAt.Before(f.CreatedTo) {
+		return false
+	}
+	if f.After != nil {
+		if game.CreatedAt.Before(f.After.CreatedAt) {
+			return false
+		}
+		if game.CreatedAt.Equal(f.After.CreatedAt) && game.ID <= f.After.ID {
+			return false
+		}
+	}
+	return true
+}
+
+type PlayerPage struct {
+	Players []PlayerResponse `json:"players"`
+	// NextCursor is empty on the last page.
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+type GamePage struct {
+	Games      []GameResponse `json:"games"`
+	NextCursor string         `json:"next_cursor,omitempty"`
+}
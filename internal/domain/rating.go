@@ -0,0 +1,231 @@
+package domain
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+const (
+	RatingSystemElo     = "elo"
+	RatingSystemGlicko2 = "glicko2"
+
+	DefaultRating           = 1500.0
+	DefaultRatingDeviation  = 350.0
+	DefaultRatingVolatility = 0.06
+	DefaultKFactor          = 32.0
+)
+
+var ErrInvalidRatingSystem = newError(KindValidation, "invalid_rating_system", "invalid rating system")
+
+// Rating is a player's strength. Deviation and Volatility are only moved by
+// Glicko-2; Elo leaves them at whatever they were.
+type Rating struct {
+	Rating     float64 `json:"rating"`
+	Deviation  float64 `json:"deviation"`
+	Volatility float64 `json:"volatility"`
+}
+
+func DefaultPlayerRating() Rating {
+	return Rating{Rating: DefaultRating, Deviation: DefaultRatingDeviation, Volatility: DefaultRatingVolatility}
+}
+
+// RatingSystem rates the two players of a finished game. score is player
+// one's result: 1 for a win, 0.5 for a draw and 0 for a loss.
+type RatingSystem interface {
+	Name() string
+	Rate(one Rating, two Rating, score float64) (Rating, Rating)
+}
+
+// NewRatingSystem returns the named system; an empty name means Elo. kFactor
+// is only used by Elo and defaults to DefaultKFactor when 0.
+func NewRatingSystem(name string, kFactor float64) (RatingSystem, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "", RatingSystemElo:
+		if kFactor == 0 {
+			kFactor = DefaultKFactor
+		}
+		if kFactor < 0 {
+			return nil, fmt.Errorf("%w: K-factor must be positive", ErrInvalidRatingSystem)
+		}
+		return elo{k: kFactor}, nil
+	case RatingSystemGlicko2:
+		return glicko2{}, nil
+	default:
+		return nil, fmt.Errorf("%w %q: must be %s or %s", ErrInvalidRatingSystem, name, RatingSystemElo, RatingSystemGlicko2)
+	}
+}
+
+type elo struct {
+	k float64
+}
+
+func (e elo) Name() string {
+	return RatingSystemElo
+}
+
+func (e elo) Rate(one Rating, two Rating, score float64) (Rating, Rating) {
+	expected := 1 / (1 + math.Pow(10, (two.Rating-one.Rating)/400))
+	delta := e.k * (score - expected)
+	one.Rating += delta
+	two.Rating -= delta
+	return one, two
+}
+
+// glicko2 follows Glickman's "Example of the Glicko-2 system", treating every
+// game as a rating period of its own.
+type glicko2 struct{}
+
+const (
+	glicko2Scale = 173.7178
+	// glicko2Tau limits how fast volatility can change. Glickman suggests
+	// 0.3 to 1.2; his example uses 0.5.
+	glicko2Tau = 0.5
+)
+
+// glicko2Result is one game of a rating period, from the rated player's side.
+type glicko2Result struct {
+	opponent Rating
+	score    float64
+}
+
+func (g glicko2) Name() string {
+	return RatingSystemGlicko2
+}
+
+func (g glicko2) Rate(one Rating, two Rating, score float64) (Rating, Rating) {
+	return g.update(one, []glicko2Result{{two, score}}), g.update(two, []glicko2Result{{one, 1 - score}})
+}
+
+// update rates player after a rating period with at least one result.
+func (g glicko2) update(player Rating, results []glicko2Result) Rating {
+	mu := (player.Rating - DefaultRating) / glicko2Scale
+	phi := player.Deviation / glicko2Scale
+	sigma := player.Volatility
+
+	var vInv, improvement float64
+	for _, result := range results {
+		opMu := (result.opponent.Rating - DefaultRating) / glicko2Scale
+		opPhi := result.opponent.Deviation / glicko2Scale
+		gPhi := 1 / math.Sqrt(1+3*opPhi*opPhi/(math.Pi*math.Pi))
+		expected := 1 / (1 + math.Exp(-gPhi*(mu-opMu)))
+		vInv += gPhi * gPhi * expected * (1 - expected)
+		improvement += gPhi * (result.score - expected)
+	}
+	v := 1 / vInv
+	delta := v * improvement
+
+	sigma = g.volatility(phi, sigma, v, delta)
+	phiStar := math.Sqrt(phi*phi + sigma*sigma)
+	phi = 1 / math.Sqrt(1/(phiStar*phiStar)+1/v)
+	mu += phi * phi * improvement
+
+	return Rating{
+		Rating:     mu*glicko2Scale + DefaultRating,
+		Deviation:  phi * glicko2Scale,
+		Volatility: sigma,
+	}
+}
+
+// volatility solves for the new volatility with the Illinois algorithm.
+func (g glicko2) volatility(phi, sigma, v, delta float64) float64 {
+	const epsilon = 0.000001
+	a := math.Log(sigma * sigma)
+	f := func(x float64) float64 {
+		ex := math.Exp(x)
+		d := phi*phi + v + ex
+		return ex*(delta*delta-phi*phi-v-ex)/(2*d*d) - (x-a)/(glicko2Tau*glicko2Tau)
+	}
+
+	A := a
+	var B float64
+	if delta*delta > phi*phi+v {
+		B = math.Log(delta*delta - phi*phi - v)
+	} else {
+		k := 1.0
+		for f(a-k*glicko2Tau) < 0 {
+			k++
+		}
+		B = a - k*glicko2Tau
+	}
+	fA, fB := f(A), f(B)
+	for math.Abs(B-A) > epsilon {
+		C := A + (A-B)*fA/(fB-fA)
+		fC := f(C)
+		if fC*fB <= 0 {
+			A, fA = B, fB
+		} else {
+			fA /= 2
+		}
+		B, fB = C, fC
+	}
+	return math.Exp(A / 2)
+}
+
+// GameRatings carries the players' ratings through RoundRepository.Update.
+// The repository loads the current ratings; if the update finishes the game,
+// whoever finished it replaces them with the new ones and sets System, and
+// the repository saves them with a RatingChange per player.
+type GameRatings struct {
+	System    string
+	PlayerOne Rating
+	PlayerTwo Rating
+}
+
+// RatingChange is one entry of a player's rating history.
+type RatingChange struct {
+	PlayerID   int       `json:"player_id"`
+	GameID     int       `json:"game_id"`
+	OpponentID int       `json:"opponent_id"`
+	Score      float64   `json:"score"`
+	System     string    `json:"system"`
+	Before     Rating    `json:"before"`
+	After      Rating    `json:"after"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// RatingChanges returns the history entries for a game that was just rated:
+// before holds the ratings as they were loaded and game.Ratings the new ones.
+func RatingChanges(game *GameResponse, before GameRatings) []RatingChange {
+	score := ScoreFor(game, game.PlayerOneId)
+	return []RatingChange{
+		{
+			PlayerID:   game.PlayerOneId,
+			GameID:     game.ID,
+			OpponentID: game.PlayerTwoId,
+			Score:      score,
+			System:     game.Ratings.System,
+			Before:     before.PlayerOne,
+			After:      game.Ratings.PlayerOne,
+		},
+		{
+			PlayerID:   game.PlayerTwoId,
+			GameID:     game.ID,
+			OpponentID: game.PlayerOneId,
+			Score:      1 - score,
+			System:     game.Ratings.System,
+			Before:     before.PlayerTwo,
+			After:      game.Ratings.PlayerTwo,
+		},
+	}
+}
+
+// ScoreFor is playerID's result in a finished game: 1, 0.5 or 0.
+func ScoreFor(game *GameResponse, playerID int) float64 {
+	switch game.Winner {
+	case playerID:
+		return 1
+	case 0:
+		return 0.5
+	default:
+		return 0
+	}
+}
+
+// PlayerRatings is a player's current rating and how it got there.
+type PlayerRatings struct {
+	PlayerID int            `json:"player_id"`
+	Current  Rating         `json:"current"`
+	History  []RatingChange `json:"history"`
+}
@@ -0,0 +1,96 @@
+package domain_test
+
+import (
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/ellisbywater/http-rock-paper-scissors/internal/domain"
+)
+
+func TestNewRatingSystem(t *testing.T) {
+	tests := []struct {
+		name    string
+		kFactor float64
+		want    string
+		err     error
+	}{
+		{"", 0, domain.RatingSystemElo, nil},
+		{" Elo ", 16, domain.RatingSystemElo, nil},
+		{"glicko2", 0, domain.RatingSystemGlicko2, nil},
+		{"elo", -1, "", domain.ErrInvalidRatingSystem},
+		{"trueskill", 0, "", domain.ErrInvalidRatingSystem},
+	}
+	for _, tt := range tests {
+		system, err := domain.NewRatingSystem(tt.name, tt.kFactor)
+		if !errors.Is(err, tt.err) {
+			t.Fatalf("NewRatingSystem(%q, %v) error = %v, want %v", tt.name, tt.kFactor, err, tt.err)
+		}
+		if err == nil && system.Name() != tt.want {
+			t.Fatalf("NewRatingSystem(%q, %v) = %s, want %s", tt.name, tt.kFactor, system.Name(), tt.want)
+		}
+	}
+}
+
+func TestEloRate(t *testing.T) {
+	elo, err := domain.NewRatingSystem(domain.RatingSystemElo, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := domain.DefaultPlayerRating()
+	stronger := start
+	stronger.Rating = 1900
+
+	tests := []struct {
+		name     string
+		one, two domain.Rating
+		score    float64
+		want     float64
+	}{
+		{"win between equals", start, start, 1, 1516},
+		{"loss between equals", start, start, 0, 1484},
+		{"draw between equals", start, start, 0.5, 1500},
+		// the expected score of the 1500 player is 1/11
+		{"upset", start, stronger, 1, 1500 + 32*10.0/11},
+		{"expected loss", start, stronger, 0, 1500 - 32*1.0/11},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			one, two := elo.Rate(tt.one, tt.two, tt.score)
+			if math.Abs(one.Rating-tt.want) > 1e-9 {
+				t.Fatalf("player one = %v, want %v", one.Rating, tt.want)
+			}
+			// Elo is zero sum and leaves deviation and volatility alone
+			if math.Abs(one.Rating+two.Rating-tt.one.Rating-tt.two.Rating) > 1e-9 ||
+				one.Deviation != tt.one.Deviation || two.Volatility != tt.two.Volatility {
+				t.Fatalf("ratings = %+v, %+v", one, two)
+			}
+		})
+	}
+}
+
+func TestGlicko2Rate(t *testing.T) {
+	glicko2, err := domain.NewRatingSystem(domain.RatingSystemGlicko2, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := domain.DefaultPlayerRating()
+
+	winner, loser := glicko2.Rate(start, start, 1)
+	if winner.Rating <= start.Rating || loser.Rating >= start.Rating {
+		t.Fatalf("ratings after a win = %+v, %+v", winner, loser)
+	}
+	// between equals, what one gains the other loses
+	if math.Abs(winner.Rating-start.Rating-(start.Rating-loser.Rating)) > 1e-9 || winner.Deviation != loser.Deviation {
+		t.Fatalf("ratings after a win between equals are not mirrored: %+v, %+v", winner, loser)
+	}
+	// a game tells the system something about both players
+	if winner.Deviation >= start.Deviation || loser.Deviation >= start.Deviation {
+		t.Fatalf("deviations after a game = %v, %v, want below %v", winner.Deviation, loser.Deviation, start.Deviation)
+	}
+
+	one, two := glicko2.Rate(start, start, 0.5)
+	if math.Abs(one.Rating-start.Rating) > 1e-9 || math.Abs(two.Rating-start.Rating) > 1e-9 {
+		t.Fatalf("ratings after a draw between equals = %+v, %+v", one, two)
+	}
+}
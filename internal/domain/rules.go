@@ -0,0 +1,104 @@
+package domain
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	RuleSetClassic = "classic"
+	RuleSetRPSLS   = "rpsls"
+	RuleSetCustom  = "custom"
+)
+
+var ErrInvalidRuleSet = newError(KindValidation, "invalid_rule_set", "invalid rule set")
+
+// RuleSet decides which hands may be played in a game and which hand wins.
+type RuleSet interface {
+	Name() string
+	Hands() Weapons
+	Validate(h Hand) error
+	// Beats reports whether a wins against b.
+	Beats(a, b Hand) bool
+}
+
+// cyclicRuleSet is a balanced tournament over an odd number of weapons:
+// walking the list in order, each weapon beats the weapon before it, the one
+// three places before it, and so on. Every weapon therefore beats exactly
+// half of the others. Classic and RPSLS are both orderings of this rule.
+type cyclicRuleSet struct {
+	name  string
+	hands Weapons
+	index map[Hand]int
+}
+
+var (
+	classicHands = Weapons{Rock, Paper, Scissors}
+	rpslsHands   = Weapons{Rock, Paper, Scissors, Spock, Lizard}
+)
+
+func ClassicRules() RuleSet {
+	rs, _ := newCyclicRuleSet(RuleSetClassic, classicHands)
+	return rs
+}
+
+// NewRuleSet builds the rule set stored on a game. weapons is only read for
+// custom rule sets; an empty name means classic.
+func NewRuleSet(name string, weapons Weapons) (RuleSet, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "", RuleSetClassic:
+		return newCyclicRuleSet(RuleSetClassic, classicHands)
+	case RuleSetRPSLS:
+		return newCyclicRuleSet(RuleSetRPSLS, rpslsHands)
+	case RuleSetCustom:
+		return newCyclicRuleSet(RuleSetCustom, weapons)
+	default:
+		return nil, fmt.Errorf("%w %q: must be one of %s, %s, %s", ErrInvalidRuleSet, name, RuleSetClassic, RuleSetRPSLS, RuleSetCustom)
+	}
+}
+
+func newCyclicRuleSet(name string, hands Weapons) (*cyclicRuleSet, error) {
+	if len(hands) < 3 || len(hands)%2 == 0 {
+		return nil, fmt.Errorf("%w: %s needs an odd number of weapons, at least 3 (got %d)", ErrInvalidRuleSet, name, len(hands))
+	}
+	index := make(map[Hand]int, len(hands))
+	for i, h := range hands {
+		if h.IsNone() {
+			return nil, fmt.Errorf("%w: weapon %d is blank", ErrInvalidRuleSet, i+1)
+		}
+		if _, dup := index[h]; dup {
+			return nil, fmt.Errorf("%w: weapon %q listed twice", ErrInvalidRuleSet, h)
+		}
+		index[h] = i
+	}
+	return &cyclicRuleSet{
+		name:  name,
+		hands: append(Weapons(nil), hands...),
+		index: index,
+	}, nil
+}
+
+func (rs *cyclicRuleSet) Name() string {
+	return rs.name
+}
+
+func (rs *cyclicRuleSet) Hands() Weapons {
+	return append(Weapons(nil), rs.hands...)
+}
+
+func (rs *cyclicRuleSet) Validate(h Hand) error {
+	if _, ok := rs.index[h]; !ok {
+		return fmt.Errorf("%w %q: %s allows %s", ErrInvalidHand, h.String(), rs.name, rs.hands)
+	}
+	return nil
+}
+
+func (rs *cyclicRuleSet) Beats(a, b Hand) bool {
+	i, okA := rs.index[a]
+	j, okB := rs.index[b]
+	if !okA || !okB || i == j {
+		return false
+	}
+	n := len(rs.hands)
+	return ((i-j)%n+n)%n%2 == 1
+}
@@ -0,0 +1,110 @@
+package domain_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/ellisbywater/http-rock-paper-scissors/internal/domain"
+)
+
+// checkBeats compares every ordered pair of rs's hands against wins, which
+// lists each winning pair once.
+func checkBeats(t *testing.T, rs domain.RuleSet, wins [][2]domain.Hand) {
+	t.Helper()
+	beats := make(map[[2]domain.Hand]bool)
+	for _, w := range wins {
+		beats[w] = true
+	}
+	for _, a := range rs.Hands() {
+		for _, b := range rs.Hands() {
+			if got, want := rs.Beats(a, b), beats[[2]domain.Hand{a, b}]; got != want {
+				t.Errorf("%s: Beats(%s, %s) = %v, want %v", rs.Name(), a, b, got, want)
+			}
+		}
+	}
+}
+
+func TestClassicRules(t *testing.T) {
+	rs, err := domain.NewRuleSet("", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rs.Name() != domain.RuleSetClassic || len(rs.Hands()) != 3 {
+		t.Fatalf("default rule set = %s %v", rs.Name(), rs.Hands())
+	}
+	checkBeats(t, rs, [][2]domain.Hand{
+		{domain.Rock, domain.Scissors},
+		{domain.Paper, domain.Rock},
+		{domain.Scissors, domain.Paper},
+	})
+	if err := rs.Validate(domain.Lizard); !errors.Is(err, domain.ErrInvalidHand) {
+		t.Errorf("classic Validate(lizard) = %v, want ErrInvalidHand", err)
+	}
+}
+
+func TestRPSLSRules(t *testing.T) {
+	rs, err := domain.NewRuleSet(" RPSLS ", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkBeats(t, rs, [][2]domain.Hand{
+		{domain.Scissors, domain.Paper},
+		{domain.Paper, domain.Rock},
+		{domain.Rock, domain.Lizard},
+		{domain.Lizard, domain.Spock},
+		{domain.Spock, domain.Scissors},
+		{domain.Scissors, domain.Lizard},
+		{domain.Lizard, domain.Paper},
+		{domain.Paper, domain.Spock},
+		{domain.Spock, domain.Rock},
+		{domain.Rock, domain.Scissors},
+	})
+	for _, h := range rs.Hands() {
+		if err := rs.Validate(h); err != nil {
+			t.Errorf("rpsls Validate(%s) = %v", h, err)
+		}
+	}
+}
+
+func TestCustomRules(t *testing.T) {
+	fire, water, air, earth, wood := domain.Hand("fire"), domain.Hand("water"), domain.Hand("air"), domain.Hand("earth"), domain.Hand("wood")
+	rs, err := domain.NewRuleSet(domain.RuleSetCustom, domain.Weapons{fire, water, air, earth, wood})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// each weapon beats the one before it and the one three before it
+	checkBeats(t, rs, [][2]domain.Hand{
+		{water, fire}, {air, water}, {earth, air}, {wood, earth}, {fire, wood},
+		{earth, fire}, {wood, water}, {fire, air}, {water, earth}, {air, wood},
+	})
+	if rs.Beats(fire, domain.Rock) || rs.Beats(domain.Rock, fire) {
+		t.Error("a hand outside the rule set beats nothing and loses to nothing")
+	}
+	if err := rs.Validate(domain.Rock); !errors.Is(err, domain.ErrInvalidHand) {
+		t.Errorf("custom Validate(rock) = %v, want ErrInvalidHand", err)
+	}
+}
+
+func TestNewRuleSetRejects(t *testing.T) {
+	tests := []struct {
+		name    string
+		rules   string
+		weapons domain.Weapons
+	}{
+		{"unknown name", "chess", nil},
+		{"custom without weapons", domain.RuleSetCustom, nil},
+		{"one weapon", domain.RuleSetCustom, domain.Weapons{"a"}},
+		{"two weapons", domain.RuleSetCustom, domain.Weapons{"a", "b"}},
+		{"four weapons", domain.RuleSetCustom, domain.Weapons{"a", "b", "c", "d"}},
+		{"six weapons", domain.RuleSetCustom, domain.Weapons{"a", "b", "c", "d", "e", "f"}},
+		{"duplicate weapon", domain.RuleSetCustom, domain.Weapons{"a", "b", "a"}},
+		{"blank weapon", domain.RuleSetCustom, domain.Weapons{"a", domain.NoHand, "c"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := domain.NewRuleSet(tt.rules, tt.weapons); !errors.Is(err, domain.ErrInvalidRuleSet) {
+				t.Errorf("NewRuleSet(%q, %v) error = %v, want ErrInvalidRuleSet", tt.rules, tt.weapons, err)
+			}
+		})
+	}
+}
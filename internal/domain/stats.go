@@ -0,0 +1,165 @@
+package domain
+
+import (
+	"math"
+	"sort"
+)
+
+// PlayerStats summarises a player's record. Game counts only include
+// finished games and round counts only finished rounds, so stats never give
+// away a hand that is still hidden.
+type PlayerStats struct {
+	PlayerID int `json:"player_id"`
+	// OpponentID is set when only games against one opponent are counted.
+	OpponentID int `json:"opponent_id,omitempty"`
+
+	GamesPlayed     int     `json:"games_played"`
+	GamesWon        int     `json:"games_won"`
+	GamesLost       int     `json:"games_lost"`
+	GamesDrawn      int     `json:"games_drawn"`
+	GamesInProgress int     `json:"games_in_progress"`
+	WinRate         float64 `json:"win_rate"`
+
+	// Streaks count consecutive won games; a draw or loss ends one.
+	CurrentWinStreak int `json:"current_win_streak"`
+	LongestWinStreak int `json:"longest_win_streak"`
+
+	RoundsPlayed int `json:"rounds_played"`
+	RoundsWon    int `json:"rounds_won"`
+	RoundsLost   int `json:"rounds_lost"`
+	RoundsTied   int `json:"rounds_tied"`
+
+	Hands []HandStats `json:"hands"`
+}
+
+// HandStats is how often a player threw a hand and how it went.
+type HandStats struct {
+	Hand   Hand `json:"hand"`
+	Played int  `json:"played"`
+	Won    int  `json:"won"`
+	Lost   int  `json:"lost"`
+	Tied   int  `json:"tied"`
+	// Usage is the share of the player's rounds played with this hand and
+	// WinRate the share of those rounds won.
+	Usage   float64 `json:"usage"`
+	WinRate float64 `json:"win_rate"`
+}
+
+// Repositories build PlayerStats by feeding AddGame every game of the player
+// oldest first, AddHand one row per hand, then calling Summarize.
+
+// AddGame records one of the player's games. Games must be added in the
+// order they were created for the streaks to be right.
+func (s *PlayerStats) AddGame(finished bool, winner int) {
+	if !finished {
+		s.GamesInProgress++
+		return
+	}
+	s.GamesPlayed++
+	switch winner {
+	case s.PlayerID:
+		s.GamesWon++
+		s.CurrentWinStreak++
+		s.LongestWinStreak = max(s.LongestWinStreak, s.CurrentWinStreak)
+		return
+	case 0:
+		s.GamesDrawn++
+	default:
+		s.GamesLost++
+	}
+	s.CurrentWinStreak = 0
+}
+
+// AddHand records the finished rounds the player played hand in.
+func (s *PlayerStats) AddHand(hand Hand, played int, won int, tied int) {
+	for i := range s.Hands {
+		if s.Hands[i].Hand == hand {
+			s.Hands[i].Played += played
+			s.Hands[i].Won += won
+			s.Hands[i].Tied += tied
+			return
+		}
+	}
+	s.Hands = append(s.Hands, HandStats{Hand: hand, Played: played, Won: won, Tied: tied})
+}
+
+// Summarize derives the totals and rates from what was added.
+func (s *PlayerStats) Summarize() {
+	if s.Hands == nil {
+		s.Hands = []HandStats{}
+	}
+	s.RoundsPlayed, s.RoundsWon, s.RoundsTied = 0, 0, 0
+	for i := range s.Hands {
+		h := &s.Hands[i]
+		h.Lost = h.Played - h.Won - h.Tied
+		s.RoundsPlayed += h.Played
+		s.RoundsWon += h.Won
+		s.RoundsTied += h.Tied
+	}
+	s.RoundsLost = s.RoundsPlayed - s.RoundsWon - s.RoundsTied
+	for i := range s.Hands {
+		h := &s.Hands[i]
+		h.Usage = ratio(h.Played, s.RoundsPlayed)
+		h.WinRate = ratio(h.Won, h.Played)
+	}
+	sort.Slice(s.Hands, func(i, j int) bool {
+		if s.Hands[i].Played != s.Hands[j].Played {
+			return s.Hands[i].Played > s.Hands[j].Played
+		}
+		return s.Hands[i].Hand < s.Hands[j].Hand
+	})
+	s.WinRate = ratio(s.GamesWon, s.GamesPlayed)
+}
+
+// ratio is a/b rounded to four places, or 0 when there is nothing to divide.
+func ratio(a, b int) float64 {
+	if b == 0 {
+		return 0
+	}
+	return math.Round(float64(a)/float64(b)*10000) / 10000
+}
+
+// HeadToHead is the record between two players, told from PlayerID's side.
+type HeadToHead struct {
+	PlayerID   int `json:"player_id"`
+	OpponentID int `json:"opponent_id"`
+
+	GamesPlayed     int `json:"games_played"`
+	PlayerWins      int `json:"player_wins"`
+	OpponentWins    int `json:"opponent_wins"`
+	Draws           int `json:"draws"`
+	GamesInProgress int `json:"games_in_progress"`
+
+	RoundsPlayed      int `json:"rounds_played"`
+	PlayerRoundsWon   int `json:"player_rounds_won"`
+	OpponentRoundsWon int `json:"opponent_rounds_won"`
+	RoundsTied        int `json:"rounds_tied"`
+
+	// The hands each player used against the other, most used first.
+	PlayerHands   []HandStats `json:"player_hands"`
+	OpponentHands []HandStats `json:"opponent_hands"`
+
+	// Games is one page of the games the two played against each other.
+	Games GamePage `json:"games"`
+}
+
+// NewHeadToHead combines both players' stats against each other: player is
+// PlayerID's stats against the opponent and opponent the other way round.
+func NewHeadToHead(player PlayerStats, opponent PlayerStats, games GamePage) HeadToHead {
+	return HeadToHead{
+		PlayerID:          player.PlayerID,
+		OpponentID:        opponent.PlayerID,
+		GamesPlayed:       player.GamesPlayed,
+		PlayerWins:        player.GamesWon,
+		OpponentWins:      player.GamesLost,
+		Draws:             player.GamesDrawn,
+		GamesInProgress:   player.GamesInProgress,
+		RoundsPlayed:      player.RoundsPlayed,
+		PlayerRoundsWon:   player.RoundsWon,
+		OpponentRoundsWon: player.RoundsLost,
+		RoundsTied:        player.RoundsTied,
+		PlayerHands:       player.Hands,
+		OpponentHands:     opponent.Hands,
+		Games:             games,
+	}
+}
@@ -0,0 +1,56 @@
+package domain
+
+// Responses are projected for the player looking at them so nobody can read
+// their opponent's move before the round is over. A viewer id of 0 is an
+// anonymous viewer who sees neither hand of an unfinished round.
+
+// ForViewer returns a copy of the round with every hand the viewer may not
+// see yet replaced by HiddenHand. Finished rounds are shown in full.
+func (rc *RoundContext) ForViewer(viewerID int) RoundContext {
+	view := *rc
+	if view.Finished {
+		return view
+	}
+	// a nonce next to its commitment gives the hand away just the same
+	if view.PlayerOneID != viewerID {
+		if view.HasPlayerOnePlayed() {
+			view.PlayerOneHand = HiddenHand
+		}
+		view.PlayerOneNonce = ""
+	}
+	if view.PlayerTwoID != viewerID {
+		if view.HasPlayerTwoPlayed() {
+			view.PlayerTwoHand = HiddenHand
+		}
+		view.PlayerTwoNonce = ""
+	}
+	return view
+}
+
+// ForViewer returns a copy of the game with its rounds projected for the
+// viewer.
+func (g *GameResponse) ForViewer(viewerID int) GameResponse {
+	view := *g
+	if g.Rounds != nil {
+		view.Rounds = RoundsForViewer(g.Rounds, viewerID)
+	}
+	return view
+}
+
+// GamesForViewer projects each game for the viewer.
+func GamesForViewer(games []GameResponse, viewerID int) []GameResponse {
+	views := make([]GameResponse, len(games))
+	for i := range games {
+		views[i] = games[i].ForViewer(viewerID)
+	}
+	return views
+}
+
+// RoundsForViewer projects each round for the viewer.
+func RoundsForViewer(rounds []RoundContext, viewerID int) []RoundContext {
+	views := make([]RoundContext, len(rounds))
+	for i := range rounds {
+		views[i] = rounds[i].ForViewer(viewerID)
+	}
+	return views
+}
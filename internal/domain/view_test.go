@@ -0,0 +1,100 @@
+package domain_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/ellisbywater/http-rock-paper-scissors/internal/domain"
+)
+
+// viewedRound is a commit-reveal round in which player one has revealed and
+// player two has only committed.
+func viewedRound() domain.RoundContext {
+	return domain.RoundContext{
+		ID:                  1,
+		GameID:              1,
+		Count:               1,
+		PlayerOneID:         one,
+		PlayerTwoID:         two,
+		PlayerOneHand:       domain.Rock,
+		PlayerOneCommitment: domain.HandCommitment(domain.Rock, "n1"),
+		PlayerOneNonce:      "n1",
+		PlayerTwoCommitment: domain.HandCommitment(domain.Paper, "n2"),
+	}
+}
+
+func TestRoundForViewer(t *testing.T) {
+	const outsider = 3
+	const anonymous = 0
+
+	tests := []struct {
+		name   string
+		viewer int
+		// the hands and nonces the viewer sees before the round resolves
+		oneHand  domain.Hand
+		oneNonce string
+		twoHand  domain.Hand
+	}{
+		{"participant", one, domain.Rock, "n1", domain.NoHand},
+		{"opponent", two, domain.HiddenHand, "", domain.NoHand},
+		{"outsider", outsider, domain.HiddenHand, "", domain.NoHand},
+		{"anonymous", anonymous, domain.HiddenHand, "", domain.NoHand},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name+" before the round resolves", func(t *testing.T) {
+			round := viewedRound()
+			view := round.ForViewer(tt.viewer)
+			want := viewedRound()
+			want.PlayerOneHand, want.PlayerOneNonce, want.PlayerTwoHand = tt.oneHand, tt.oneNonce, tt.twoHand
+			if view != want {
+				t.Fatalf("ForViewer(%d) = %+v, want %+v", tt.viewer, view, want)
+			}
+			if round != viewedRound() {
+				t.Fatalf("ForViewer changed the round: %+v", round)
+			}
+		})
+
+		t.Run(tt.name+" after the round resolves", func(t *testing.T) {
+			round := viewedRound()
+			round.PlayerTwoHand, round.PlayerTwoNonce = domain.Paper, "n2"
+			round.Winner, round.Finished = two, true
+			if view := round.ForViewer(tt.viewer); view != round {
+				t.Fatalf("ForViewer(%d) = %+v, want the whole round %+v", tt.viewer, view, round)
+			}
+		})
+	}
+
+	// the player who has played sees their own hand, the other only that it
+	// was played
+	round := viewedRound()
+	round.PlayerOneHand, round.PlayerOneNonce = domain.NoHand, ""
+	round.PlayerTwoHand, round.PlayerTwoNonce = domain.Paper, "n2"
+	if view := round.ForViewer(two); view.PlayerTwoHand != domain.Paper || view.PlayerTwoNonce != "n2" {
+		t.Fatalf("player two's own view = %+v", view)
+	}
+	if view := round.ForViewer(one); view.PlayerTwoHand != domain.HiddenHand || view.PlayerTwoNonce != "" || !view.PlayerOneHand.IsNone() {
+		t.Fatalf("player one's view of player two's hand = %+v", view)
+	}
+}
+
+func TestGameForViewer(t *testing.T) {
+	finished := viewedRound()
+	finished.PlayerTwoHand, finished.Winner, finished.Finished = domain.Paper, two, true
+	game := domain.GameResponse{ID: 1, PlayerOneId: one, PlayerTwoId: two, Rounds: []domain.RoundContext{finished, viewedRound()}}
+
+	view := game.ForViewer(two)
+	want := []domain.RoundContext{finished, viewedRound()}
+	want[1].PlayerOneHand, want[1].PlayerOneNonce = domain.HiddenHand, ""
+	if !reflect.DeepEqual(view.Rounds, want) {
+		t.Fatalf("rounds seen by player two = %+v, want %+v", view.Rounds, want)
+	}
+	if game.Rounds[1] != viewedRound() {
+		t.Fatalf("ForViewer changed the game's rounds: %+v", game.Rounds)
+	}
+
+	// a game loaded without its rounds keeps them nil
+	games := domain.GamesForViewer([]domain.GameResponse{{ID: 2, PlayerOneId: one, PlayerTwoId: two}}, 0)
+	if len(games) != 1 || games[0].Rounds != nil {
+		t.Fatalf("GamesForViewer() = %+v", games)
+	}
+}
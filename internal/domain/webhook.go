@@ -0,0 +1,175 @@
+package domain
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql/driver"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+// A webhook is a URL a player wants game events POSTed to. It is told about
+// the events of the player's own games whose type it subscribed to; every
+// event it is told about becomes a delivery, which is retried until the URL
+// answers 2xx or the attempts run out.
+
+const (
+	DeliveryPending   = "pending"
+	DeliverySucceeded = "succeeded"
+	DeliveryFailed    = "failed"
+)
+
+// WebhookEventTypes are the game event types a webhook may subscribe to.
+var WebhookEventTypes = []string{EventMatchFound, EventHandCommitted, EventHandPlayed, EventRoundResolved, EventScoreChanged, EventGameFinished}
+
+var (
+	ErrWebhookNotFound = newError(KindNotFound, "webhook_not_found", "webhook not found")
+	ErrInvalidWebhook  = newError(KindValidation, "invalid_webhook", "invalid webhook")
+)
+
+type Webhook struct {
+	ID       int    `json:"id"`
+	PlayerID int    `json:"player_id"`
+	URL      string `json:"url"`
+	// Events are the event types delivered; empty means all of them.
+	Events WebhookEvents `json:"events"`
+	// Secret signs every delivery. It is only shown when the webhook is
+	// created, see WebhookCreateResponse.
+	Secret    string    `json:"-"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Wants reports whether the webhook subscribed to events of eventType.
+func (w *Webhook) Wants(eventType string) bool {
+	return len(w.Events) == 0 || slices.Contains(w.Events, eventType)
+}
+
+// WebhookEvents is stored as a comma separated list.
+type WebhookEvents []string
+
+func (we *WebhookEvents) Scan(src any) error {
+	s, err := scanString(src)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidWebhook, err)
+	}
+	*we = WebhookEvents{}
+	if s != "" {
+		*we = strings.Split(s, ",")
+	}
+	return nil
+}
+
+func (we WebhookEvents) Value() (driver.Value, error) {
+	return strings.Join(we, ","), nil
+}
+
+type WebhookCreateRequest struct {
+	PlayerID int           `json:"-"`
+	URL      string        `json:"url"`
+	Events   WebhookEvents `json:"events"`
+	Secret   string        `json:"-"`
+}
+
+// Validate checks the request and normalises its URL, which must be one the
+// dispatcher can POST to.
+func (r *WebhookCreateRequest) Validate() error {
+	u, err := url.Parse(strings.TrimSpace(r.URL))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return fmt.Errorf("%w: url must be an absolute http or https URL", ErrInvalidWebhook)
+	}
+	r.URL = u.String()
+	for _, eventType := range r.Events {
+		if !slices.Contains(WebhookEventTypes, eventType) {
+			return fmt.Errorf("%w: unknown event type %q", ErrInvalidWebhook, eventType)
+		}
+	}
+	return nil
+}
+
+type WebhookCreateResponse struct {
+	Webhook
+	Secret string `json:"secret"`
+}
+
+// NewWebhookSecret returns a random secret to sign a webhook's deliveries
+// with. Unlike tokens it is stored as is: signing needs it.
+func NewWebhookSecret() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// WebhookDelivery is one game event on its way to one webhook.
+type WebhookDelivery struct {
+	ID        int    `json:"id"`
+	WebhookID int    `json:"webhook_id"`
+	EventID   int    `json:"event_id"`
+	EventType string `json:"event_type"`
+	// Payload is the body POSTed: the GameEvent as JSON.
+	Payload  json.RawMessage `json:"payload"`
+	Status   string          `json:"status"`
+	Attempts int             `json:"attempts"`
+	// NextAttemptAt is when a pending delivery is tried again.
+	NextAttemptAt time.Time        `json:"next_attempt_at,omitzero"`
+	CreatedAt     time.Time        `json:"created_at"`
+	History       []WebhookAttempt `json:"history"`
+}
+
+// WebhookAttempt is one POST of a delivery.
+type WebhookAttempt struct {
+	Attempt int `json:"attempt"`
+	// StatusCode is 0 when no response came back, and Error says why.
+	StatusCode  int       `json:"status_code,omitempty"`
+	Error       string    `json:"error,omitempty"`
+	DurationMS  int       `json:"duration_ms"`
+	AttemptedAt time.Time `json:"attempted_at"`
+}
+
+type WebhookDeliveryFilter struct {
+	// Limit is the page size. Repositories return at most Limit deliveries.
+	Limit int
+	// After is the last delivery of the previous page; deliveries are listed
+	// newest first.
+	After *Cursor
+}
+
+// Validate checks the filter and fills in the default page size.
+func (f *WebhookDeliveryFilter) Validate() error {
+	limit, err := checkLimit(f.Limit)
+	if err != nil {
+		return err
+	}
+	f.Limit = limit
+	return nil
+}
+
+type WebhookDeliveryPage struct {
+	Deliveries []WebhookDelivery `json:"deliveries"`
+	NextCursor string            `json:"next_cursor,omitempty"`
+}
+
+type WebhookRepository interface {
+	Create(ctx context.Context, req WebhookCreateRequest, res *Webhook) error
+	Get(ctx context.Context, id int, res *Webhook) error
+	ListByPlayer(ctx context.Context, playerID int, res *[]Webhook) error
+	Delete(ctx context.Context, id int) error
+	// Enqueue creates a pending delivery of event, due at now, for every
+	// webhook of the event's players that wants it.
+	Enqueue(ctx context.Context, event GameEvent, now time.Time) error
+	// ListDue returns up to limit pending deliveries due by now, oldest
+	// first, without their history.
+	ListDue(ctx context.Context, now time.Time, limit int, res *[]WebhookDelivery) error
+	// RecordAttempt saves attempt and the delivery's resulting Status,
+	// Attempts and NextAttemptAt.
+	RecordAttempt(ctx context.Context, delivery WebhookDelivery, attempt WebhookAttempt) error
+	// ListDeliveries returns a page of the webhook's deliveries, newest
+	// first, each with its history.
+	ListDeliveries(ctx context.Context, webhookID int, filter WebhookDeliveryFilter, res *[]WebhookDelivery) error
+}
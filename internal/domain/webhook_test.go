@@ -0,0 +1,45 @@
+package domain_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/ellisbywater/http-rock-paper-scissors/internal/domain"
+)
+
+func TestWebhookCreateRequestValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		url    string
+		events domain.WebhookEvents
+		// want is the URL after Validate; only checked when err is nil
+		want string
+		err  error
+	}{
+		{name: "https", url: "https://example.com/hooks", want: "https://example.com/hooks"},
+		{name: "http with a port", url: "http://localhost:9000/rps?k=v", want: "http://localhost:9000/rps?k=v"},
+		{name: "surrounding spaces", url: "  https://example.com  ", want: "https://example.com"},
+		{name: "known events", url: "https://example.com", events: domain.WebhookEvents{domain.EventGameFinished}, want: "https://example.com"},
+		{name: "empty", url: "", err: domain.ErrInvalidWebhook},
+		{name: "relative", url: "/hooks", err: domain.ErrInvalidWebhook},
+		{name: "no scheme", url: "example.com/hooks", err: domain.ErrInvalidWebhook},
+		{name: "missing scheme", url: "://example.com", err: domain.ErrInvalidWebhook},
+		{name: "other scheme", url: "ftp://example.com", err: domain.ErrInvalidWebhook},
+		{name: "port without a host", url: "http://:8080/hooks", err: domain.ErrInvalidWebhook},
+		{name: "space in the host", url: "http://exa mple.com", err: domain.ErrInvalidWebhook},
+		{name: "bad port", url: "http://example.com:port", err: domain.ErrInvalidWebhook},
+		{name: "unknown event", url: "https://example.com", events: domain.WebhookEvents{"player_created"}, err: domain.ErrInvalidWebhook},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := domain.WebhookCreateRequest{URL: tt.url, Events: tt.events}
+			err := req.Validate()
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Validate() error = %v, want %v", err, tt.err)
+			}
+			if err == nil && req.URL != tt.want {
+				t.Fatalf("URL = %q, want %q", req.URL, tt.want)
+			}
+		})
+	}
+}
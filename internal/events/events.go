@@ -0,0 +1,193 @@
+// Package events is the in-process bus for game lifecycle events. Services
+// publish an event once the change it describes is committed; subscribers
+// (the event log, live streams, ...) react to it without the services
+// knowing about them.
+package events
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/ellisbywater/http-rock-paper-scissors/internal/domain"
+)
+
+// Event is one of the types below.
+type Event interface {
+	Name() string
+}
+
+type PlayerCreated struct {
+	Player domain.PlayerResponse
+	Time   time.Time
+}
+
+type GameCreated struct {
+	Game domain.GameCreateResponse
+	Time time.Time
+}
+
+type RoundCreated struct {
+	Round domain.RoundContext
+	Time  time.Time
+}
+
+// MatchFound follows the GameCreated of a game the matchmaking queue paired
+// its players into.
+type MatchFound struct {
+	Game domain.GameCreateResponse
+	Time time.Time
+}
+
+// HandCommitted is a commitment in a commit-reveal game; the hand itself is
+// still secret.
+type HandCommitted struct {
+	Game     domain.GameResponse
+	Round    domain.RoundContext
+	PlayerID int
+	Time     time.Time
+}
+
+// HandPlayed is a hand played, or revealed, by PlayerID. Game and Round are
+// as saved, so Round only shows the hands once it is finished.
+type HandPlayed struct {
+	Game     domain.GameResponse
+	Round    domain.RoundContext
+	PlayerID int
+	Time     time.Time
+}
+
+// RoundResolved follows the HandPlayed that finished Round; Game has the
+// updated score.
+type RoundResolved struct {
+	Game  domain.GameResponse
+	Round domain.RoundContext
+	Time  time.Time
+}
+
+// GameFinished follows the RoundResolved that decided Game, and carries its
+// ratings when the game was rated.
+type GameFinished struct {
+	Game domain.GameResponse
+	Time time.Time
+}
+
+func (PlayerCreated) Name() string { return "player_created" }
+func (GameCreated) Name() string   { return "game_created" }
+func (RoundCreated) Name() string  { return "round_created" }
+func (MatchFound) Name() string    { return "match_found" }
+func (HandCommitted) Name() string { return "hand_committed" }
+func (HandPlayed) Name() string    { return "hand_played" }
+func (RoundResolved) Name() string { return "round_resolved" }
+func (GameFinished) Name() string  { return "game_finished" }
+
+// Subscriber handles the events published on a bus. Each subscriber runs on
+// a goroutine of its own, one event at a time.
+type Subscriber interface {
+	HandleEvent(ctx context.Context, event Event) error
+}
+
+// SubscriberFunc adapts a function to Subscriber.
+type SubscriberFunc func(ctx context.Context, event Event) error
+
+func (f SubscriberFunc) HandleEvent(ctx context.Context, event Event) error {
+	return f(ctx, event)
+}
+
+// Publisher is what services publish to. A nil Publisher is allowed and
+// drops every event.
+type Publisher interface {
+	Publish(ctx context.Context, events ...Event)
+}
+
+// queueSize is how many events a subscriber may fall behind by before
+// Publish waits for it.
+const queueSize = 256
+
+// Bus delivers each event to every subscriber. Every subscriber has a queue
+// and a goroutine of its own, so Publish does not wait for subscribers, and
+// a slow one only holds up itself. All subscribers see the events in the
+// order they were published. The change an event describes is already
+// committed, so a subscriber that fails, or panics, is logged and goes on
+// with the next event.
+type Bus struct {
+	mu     sync.Mutex
+	queues []chan delivery
+	closed bool
+	done   sync.WaitGroup
+}
+
+type delivery struct {
+	ctx   context.Context
+	event Event
+}
+
+func NewBus() *Bus {
+	return &Bus{}
+}
+
+// Subscribe starts delivering the events published from now on to sub.
+func (b *Bus) Subscribe(sub Subscriber) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return
+	}
+	queue := make(chan delivery, queueSize)
+	b.queues = append(b.queues, queue)
+	b.done.Add(1)
+	go func() {
+		defer b.done.Done()
+		for d := range queue {
+			if err := deliver(d.ctx, sub, d.event); err != nil {
+				log.Printf("handle %s event: %v", d.event.Name(), err)
+			}
+		}
+	}()
+}
+
+// Publish queues events for every subscriber and returns. Subscribers get
+// ctx without its cancellation, as the request that published the events is
+// usually over by the time they run. It only blocks while a subscriber's
+// queue is full.
+func (b *Bus) Publish(ctx context.Context, events ...Event) {
+	ctx = context.WithoutCancel(ctx)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		log.Printf("bus closed: dropped %d events", len(events))
+		return
+	}
+	for _, event := range events {
+		for _, queue := range b.queues {
+			queue <- delivery{ctx: ctx, event: event}
+		}
+	}
+}
+
+// Close stops the bus and waits for the subscribers to handle the events
+// published before it. Events published later are dropped.
+func (b *Bus) Close() {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return
+	}
+	b.closed = true
+	for _, queue := range b.queues {
+		close(queue)
+	}
+	b.mu.Unlock()
+	b.done.Wait()
+}
+
+func deliver(ctx context.Context, sub Subscriber, event Event) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("panic: %v", p)
+		}
+	}()
+	return sub.HandleEvent(ctx, event)
+}
@@ -0,0 +1,98 @@
+package events_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ellisbywater/http-rock-paper-scissors/internal/domain"
+	"github.com/ellisbywater/http-rock-paper-scissors/internal/events"
+)
+
+// created is the event of player id being created.
+func created(id int) events.Event {
+	return events.PlayerCreated{Player: domain.PlayerResponse{ID: id}}
+}
+
+// recorder remembers the ids of the players it saw created, and fails or
+// panics on those it is told to.
+type recorder struct {
+	mu     sync.Mutex
+	seen   []int
+	fail   int
+	panics int
+}
+
+func (r *recorder) HandleEvent(ctx context.Context, event events.Event) error {
+	id := event.(events.PlayerCreated).Player.ID
+	r.mu.Lock()
+	r.seen = append(r.seen, id)
+	r.mu.Unlock()
+	switch id {
+	case r.fail:
+		return errors.New("boom")
+	case r.panics:
+		panic("boom")
+	}
+	return nil
+}
+
+func TestBusDeliversInOrder(t *testing.T) {
+	bus := events.NewBus()
+	first, second := &recorder{}, &recorder{fail: 2, panics: 3}
+	bus.Subscribe(first)
+	bus.Subscribe(second)
+
+	ctx := context.Background()
+	bus.Publish(ctx, created(1), created(2))
+	bus.Publish(ctx, created(3))
+	bus.Publish(ctx, created(4), created(5))
+	bus.Close()
+
+	// a failing or panicking subscriber goes on with the next event, and the
+	// others never notice
+	want := []int{1, 2, 3, 4, 5}
+	for name, sub := range map[string]*recorder{"first": first, "second": second} {
+		if !reflect.DeepEqual(sub.seen, want) {
+			t.Errorf("%s subscriber saw %v, want %v", name, sub.seen, want)
+		}
+	}
+
+	bus.Publish(ctx, created(6))
+	if len(first.seen) != len(want) {
+		t.Fatalf("subscriber saw %v after Close", first.seen)
+	}
+}
+
+func TestBusDoesNotWaitForSubscribers(t *testing.T) {
+	bus := events.NewBus()
+	release := make(chan struct{})
+	handled := make(chan error, 1)
+	bus.Subscribe(events.SubscriberFunc(func(ctx context.Context, event events.Event) error {
+		<-release
+		handled <- ctx.Err()
+		return nil
+	}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	published := make(chan struct{})
+	go func() {
+		bus.Publish(ctx, created(1))
+		close(published)
+	}()
+	select {
+	case <-published:
+	case <-time.After(time.Second):
+		t.Fatal("Publish waited for a blocked subscriber")
+	}
+	// the request that published is over before the subscriber runs
+	cancel()
+	close(release)
+	if err := <-handled; err != nil {
+		t.Fatalf("subscriber's ctx err = %v, want the publisher's cancellation dropped", err)
+	}
+	bus.Close()
+}
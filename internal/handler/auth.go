@@ -0,0 +1,80 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/ellisbywater/http-rock-paper-scissors/internal/domain"
+	"github.com/gorilla/websocket"
+)
+
+type contextKey int
+
+const playerKey contextKey = iota
+
+// RequireAuth resolves the bearer token on the request to a player and makes
+// it available to next through authenticatedPlayer. Requests without a valid
+// token are rejected with 401.
+func (ph *PlayerHandlers) RequireAuth(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		player, err := ph.service.Authenticate(r.Context(), bearerToken(r))
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		next(w, r.WithContext(context.WithValue(r.Context(), playerKey, *player)))
+	}
+}
+
+// OptionalAuth is RequireAuth for endpoints anonymous callers may use too.
+// A request without an Authorization header goes through as anonymous; a bad
+// token is still rejected.
+func (ph *PlayerHandlers) OptionalAuth(next http.HandlerFunc) http.HandlerFunc {
+	authed := ph.RequireAuth(next)
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "" {
+			next(w, r)
+			return
+		}
+		authed(w, r)
+	}
+}
+
+func bearerToken(r *http.Request) string {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if ok && strings.EqualFold(scheme, "Bearer") {
+		return strings.TrimSpace(token)
+	}
+	// Browsers cannot set headers on a WebSocket handshake or an
+	// EventSource. Elsewhere tokens stay out of URLs, which end up in logs.
+	if websocket.IsWebSocketUpgrade(r) || isEventStream(r) {
+		return r.URL.Query().Get("access_token")
+	}
+	return ""
+}
+
+// isEventStream reports whether r asks for server-sent events, as
+// EventSource does.
+func isEventStream(r *http.Request) bool {
+	return r.Method == http.MethodGet && strings.Contains(r.Header.Get("Accept"), "text/event-stream")
+}
+
+// authenticatedPlayer returns the player RequireAuth stored on the request.
+func authenticatedPlayer(r *http.Request) (domain.PlayerResponse, error) {
+	player, ok := r.Context().Value(playerKey).(domain.PlayerResponse)
+	if !ok {
+		return player, domain.ErrUnauthenticated
+	}
+	return player, nil
+}
+
+// viewerID is the id responses are projected for: the authenticated player,
+// or 0 for anonymous callers.
+func viewerID(r *http.Request) int {
+	player, err := authenticatedPlayer(r)
+	if err != nil {
+		return 0
+	}
+	return player.ID
+}
@@ -0,0 +1,129 @@
+package handler_test
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/ellisbywater/http-rock-paper-scissors/internal/domain"
+)
+
+func TestRequireAuth(t *testing.T) {
+	s := newServer(t)
+	player := s.player(t, "one")
+
+	tests := []struct {
+		name          string
+		authorization string
+		status        int
+	}{
+		{"bearer token", "Bearer " + player.Token, http.StatusNoContent},
+		{"scheme in any case", "bearer " + player.Token, http.StatusNoContent},
+		{"padded token", "Bearer  " + player.Token + " ", http.StatusNoContent},
+		{"no header", "", http.StatusUnauthorized},
+		{"unknown token", "Bearer nope", http.StatusUnauthorized},
+		{"empty token", "Bearer ", http.StatusUnauthorized},
+		{"other scheme", "Basic " + player.Token, http.StatusUnauthorized},
+		{"no scheme", player.Token, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			if tt.authorization != "" {
+				header.Set("Authorization", tt.authorization)
+			}
+			rec := s.send(t, http.MethodGet, "/authed", header, "")
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d; body %s", rec.Code, tt.status, rec.Body)
+			}
+			if tt.status == http.StatusUnauthorized {
+				if code := errorCode(t, rec, http.StatusUnauthorized); code != "unauthenticated" {
+					t.Fatalf("code = %q", code)
+				}
+				if rec.Header().Get("WWW-Authenticate") == "" {
+					t.Fatal("401 without WWW-Authenticate")
+				}
+			}
+		})
+	}
+}
+
+func TestAccessTokenOnlyForStreams(t *testing.T) {
+	s := newServer(t)
+	player := s.player(t, "one")
+	target := "/authed?access_token=" + player.Token
+
+	tests := []struct {
+		name   string
+		header http.Header
+		status int
+	}{
+		{"plain request", http.Header{}, http.StatusUnauthorized},
+		{"JSON request", http.Header{"Accept": {"application/json"}}, http.StatusUnauthorized},
+		{"event stream", http.Header{"Accept": {"text/event-stream"}}, http.StatusNoContent},
+		{"WebSocket handshake", http.Header{"Connection": {"Upgrade"}, "Upgrade": {"websocket"}}, http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if rec := s.send(t, http.MethodGet, target, tt.header, ""); rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d; body %s", rec.Code, tt.status, rec.Body)
+			}
+		})
+	}
+}
+
+func TestOptionalAuth(t *testing.T) {
+	s := newServer(t)
+	one, two := s.player(t, "one"), s.player(t, "two")
+	game, _ := s.game(t, one, two)
+	target := fmt.Sprintf("/game/%d", game.ID)
+
+	var seen domain.GameResponse
+	decode(t, s.do(t, http.MethodGet, target, "", ""), http.StatusOK, &seen)
+	if seen.ID != game.ID {
+		t.Fatalf("anonymous caller got %+v", seen)
+	}
+	decode(t, s.do(t, http.MethodGet, target, two.Token, ""), http.StatusOK, &seen)
+	// a token that was sent has to be good
+	if code := errorCode(t, s.do(t, http.MethodGet, target, "nope", ""), http.StatusUnauthorized); code != "unauthenticated" {
+		t.Fatalf("code = %q", code)
+	}
+}
+
+func TestOnlyPlayersMove(t *testing.T) {
+	s := newServer(t)
+	one, two, outsider := s.player(t, "one"), s.player(t, "two"), s.player(t, "outsider")
+	game, round := s.game(t, one, two)
+	create := fmt.Sprintf("/game/%d/round/create", game.ID)
+	play := fmt.Sprintf("/game/%d/round/%d/playHand", game.ID, round.ID)
+
+	tests := []struct {
+		name   string
+		target string
+		token  string
+		body   string
+		status int
+		code   string
+	}{
+		{"anonymous round", create, "", "", http.StatusUnauthorized, "unauthenticated"},
+		{"outsider's round", create, outsider.Token, "", http.StatusForbidden, "not_a_participant"},
+		{"round of an unknown game", "/game/4242/round/create", one.Token, "", http.StatusNotFound, "game_not_found"},
+		{"anonymous hand", play, "", `{"hand": "rock"}`, http.StatusUnauthorized, "unauthenticated"},
+		{"outsider's hand", play, outsider.Token, `{"hand": "rock"}`, http.StatusForbidden, "not_a_participant"},
+		{"hand as the other player", play, two.Token, fmt.Sprintf(`{"current_player": %d, "hand": "rock"}`, one.ID), http.StatusForbidden, "player_mismatch"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code := errorCode(t, s.do(t, http.MethodPost, tt.target, tt.token, tt.body), tt.status); code != tt.code {
+				t.Fatalf("code = %q, want %q", code, tt.code)
+			}
+		})
+	}
+
+	// the hand is played for the caller
+	var played domain.RoundContext
+	decode(t, s.do(t, http.MethodPost, play, two.Token, fmt.Sprintf(`{"current_player": %d, "hand": "rock"}`, two.ID)), http.StatusOK, &played)
+	if played.PlayerTwoHand != domain.Rock || !played.PlayerOneHand.IsNone() {
+		t.Fatalf("round after player two played = %+v", played)
+	}
+}
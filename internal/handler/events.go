@@ -0,0 +1,202 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ellisbywater/http-rock-paper-scissors/internal/domain"
+	"github.com/ellisbywater/http-rock-paper-scissors/internal/realtime"
+	"github.com/ellisbywater/http-rock-paper-scissors/internal/service"
+)
+
+// heartbeatPeriod is how often an idle event stream sends a comment so
+// proxies do not close it.
+const heartbeatPeriod = 15 * time.Second
+
+type EventStreamHandlers struct {
+	games   service.GameService
+	players service.PlayerService
+	events  service.GameEventService
+	hub     *realtime.Hub
+	origins Origins
+}
+
+// NewEventStreamHandler serves pages from the server's own origin and from
+// origins, as the WebSocket does.
+func NewEventStreamHandler(games service.GameService, players service.PlayerService, events service.GameEventService, hub *realtime.Hub, origins Origins) *EventStreamHandlers {
+	return &EventStreamHandlers{games: games, players: players, events: events, hub: hub, origins: origins}
+}
+
+// Game streams the game's events (see domain.GameEvent) as server-sent
+// events identified by their seq. A stream starts with every event of the
+// game so far, or those after Last-Event-ID when resuming. Only the game's
+// players may follow it, as with the WebSocket.
+func (eh *EventStreamHandlers) Game(w http.ResponseWriter, r *http.Request) {
+	if !eh.origins.allow(r) {
+		writeError(w, errOriginNotAllowed)
+		return
+	}
+	player, err := authenticatedPlayer(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	game_id, err := pathID(r, "gameId")
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	game, err := eh.games.GetGame(r.Context(), game_id)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if player.ID != game.PlayerOneId && player.ID != game.PlayerTwoId {
+		writeError(w, domain.ErrNotParticipant)
+		return
+	}
+	last_id, _, err := lastEventID(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	sub := eh.hub.Subscribe(game_id)
+	defer sub.Close()
+	list := func(after int) (*[]domain.GameEvent, error) {
+		return eh.events.ListByGame(r.Context(), game_id, after)
+	}
+	eh.stream(w, r, sub, last_id, true, list, func(event domain.GameEvent) int { return event.Seq })
+}
+
+// Player streams the events of every game the player is in, identified by
+// their id. A stream starts with the next event, or after Last-Event-ID when
+// resuming. Players may only follow their own stream.
+func (eh *EventStreamHandlers) Player(w http.ResponseWriter, r *http.Request) {
+	if !eh.origins.allow(r) {
+		writeError(w, errOriginNotAllowed)
+		return
+	}
+	player, err := authenticatedPlayer(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	player_id, err := pathID(r, "playerId")
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if player.ID != player_id {
+		writeError(w, domain.ErrPlayerMismatch)
+		return
+	}
+	if _, err := eh.players.GetPlayer(r.Context(), player_id); err != nil {
+		writeError(w, err)
+		return
+	}
+	last_id, resume, err := lastEventID(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	sub := eh.hub.SubscribePlayer(player_id)
+	defer sub.Close()
+	list := func(after int) (*[]domain.GameEvent, error) {
+		return eh.events.ListByPlayer(r.Context(), player_id, after)
+	}
+	eh.stream(w, r, sub, last_id, resume, list, func(event domain.GameEvent) int { return event.ID })
+}
+
+// stream writes the events list returns after last_id, starting with the
+// backlog when resume is set. Published events only wake it up: what is sent
+// is read back from the event log, so the stream follows the recorded order
+// and never repeats or skips an event. Without resume it starts just before
+// the first published event.
+func (eh *EventStreamHandlers) stream(w http.ResponseWriter, r *http.Request, sub *realtime.Subscription, last_id int, resume bool, list func(after int) (*[]domain.GameEvent, error), eventID func(domain.GameEvent) int) {
+	var backlog *[]domain.GameEvent
+	if resume {
+		var err error
+		if backlog, err = list(last_id); err != nil {
+			writeError(w, err)
+			return
+		}
+	}
+
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	send := func(events *[]domain.GameEvent) error {
+		if events != nil {
+			for _, event := range *events {
+				data, err := json.Marshal(event)
+				if err != nil {
+					return err
+				}
+				if _, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", eventID(event), event.Type, data); err != nil {
+					return err
+				}
+				last_id = eventID(event)
+			}
+		}
+		return rc.Flush()
+	}
+	if err := send(backlog); err != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(heartbeatPeriod)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event, ok := <-sub.Events():
+			if !ok {
+				// Dropped for falling behind; the client reconnects with
+				// Last-Event-ID and catches up
+				return
+			}
+			if !resume {
+				last_id, resume = eventID(event)-1, true
+			}
+			events, err := list(last_id)
+			if err != nil {
+				log.Printf("list game events: %v", err)
+				return
+			}
+			if err := send(events); err != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+			if err := rc.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// lastEventID reads the id of the last event a client received from the
+// Last-Event-ID header, or the last_event_id query parameter for clients
+// that cannot set it.
+func lastEventID(r *http.Request) (id int, ok bool, err error) {
+	v := r.Header.Get("Last-Event-ID")
+	if v == "" {
+		v = r.URL.Query().Get("last_event_id")
+	}
+	if v == "" {
+		return 0, false, nil
+	}
+	id, err = strconv.Atoi(v)
+	if err != nil || id < 0 {
+		return 0, false, fmt.Errorf("%w: Last-Event-ID must be an event id", domain.ErrInvalidFilter)
+	}
+	return id, true, nil
+}
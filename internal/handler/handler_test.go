@@ -0,0 +1,177 @@
+package handler_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ellisbywater/http-rock-paper-scissors/internal/domain"
+	"github.com/ellisbywater/http-rock-paper-scissors/internal/events"
+	"github.com/ellisbywater/http-rock-paper-scissors/internal/handler"
+	"github.com/ellisbywater/http-rock-paper-scissors/internal/realtime"
+	"github.com/ellisbywater/http-rock-paper-scissors/internal/repository/memory"
+	"github.com/ellisbywater/http-rock-paper-scissors/internal/service"
+)
+
+// allowedOrigin is the origin, besides its own, the server lets pages follow
+// games from.
+const allowedOrigin = "https://allowed.example"
+
+// server routes the endpoints as cmd/main.go does, over an empty memory
+// store. Events go over a bus to the event log and the hub, as they do
+// there.
+type server struct {
+	mux    *http.ServeMux
+	events domain.GameEventRepository
+}
+
+func newServer(t *testing.T) *server {
+	t.Helper()
+	store := memory.New()
+	hub := realtime.NewHub()
+	eventRepo := memory.NewGameEventRepository(store)
+	bus := events.NewBus()
+	bus.Subscribe(realtime.NewRecorder(eventRepo, hub))
+	t.Cleanup(bus.Close)
+
+	games := service.NewGameService(memory.NewGameRepository(store), bus)
+	playerService := service.NewPlayerService(memory.NewPlayerRepository(store), games, bus)
+	players := handler.NewPlayerHandler(*playerService)
+	gameHandler := handler.NewGameHandler(*games)
+	ratings, err := domain.NewRatingSystem("", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rounds := handler.NewRoundHandlers(*service.NewRoundService(memory.NewRoundRepository(store), ratings, bus), *games)
+	origins := handler.ParseOrigins(" " + allowedOrigin + "/, ")
+	sockets := handler.NewGameSocketHandler(*games, hub, origins)
+	streams := handler.NewEventStreamHandler(*games, *playerService, *service.NewGameEventService(eventRepo), hub, origins)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /player/create", players.Create)
+	mux.HandleFunc("GET /player/{playerId}/events", players.RequireAuth(streams.Player))
+	// answers 204 to any authenticated caller
+	mux.HandleFunc("GET /authed", players.RequireAuth(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	mux.HandleFunc("POST /game/create", players.RequireAuth(gameHandler.Create))
+	mux.HandleFunc("GET /game/{gameId}", players.OptionalAuth(gameHandler.GetGame))
+	mux.HandleFunc("GET /game/{gameId}/ws", players.RequireAuth(sockets.Serve))
+	mux.HandleFunc("GET /game/{gameId}/events", players.RequireAuth(streams.Game))
+	mux.HandleFunc("POST /game/{gameId}/round/create", players.RequireAuth(rounds.Create))
+	mux.HandleFunc("POST /game/{gameId}/round/{roundId}/playHand", players.RequireAuth(rounds.PlayHand))
+	return &server{mux: mux, events: eventRepo}
+}
+
+// start serves the routes over HTTP until the test ends.
+func (s *server) start(t *testing.T) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(s.mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// do sends a request with token as its bearer token, unless it is empty.
+func (s *server) do(t *testing.T, method string, target string, token string, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	header := http.Header{}
+	if token != "" {
+		header.Set("Authorization", "Bearer "+token)
+	}
+	return s.send(t, method, target, header, body)
+}
+
+// send sends a request with header.
+func (s *server) send(t *testing.T, method string, target string, header http.Header, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	rec := httptest.NewRecorder()
+	s.mux.ServeHTTP(rec, req)
+	return rec
+}
+
+// decode fails unless rec has status and then reads its body into v.
+func decode(t *testing.T, rec *httptest.ResponseRecorder, status int, v any) {
+	t.Helper()
+	if rec.Code != status {
+		t.Fatalf("status = %d, want %d; body %s", rec.Code, status, rec.Body)
+	}
+	if err := json.NewDecoder(rec.Body).Decode(v); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func (s *server) player(t *testing.T, name string) domain.PlayerCreateResponse {
+	t.Helper()
+	var player domain.PlayerCreateResponse
+	decode(t, s.do(t, http.MethodPost, "/player/create", "", fmt.Sprintf(`{"username": %q}`, name)), http.StatusCreated, &player)
+	return player
+}
+
+// game starts a game of one against two and its first round.
+func (s *server) game(t *testing.T, one, two domain.PlayerCreateResponse) (domain.GameCreateResponse, domain.RoundContext) {
+	t.Helper()
+	var game domain.GameCreateResponse
+	decode(t, s.do(t, http.MethodPost, "/game/create", one.Token, fmt.Sprintf(`{"player_two": %d, "total_rounds": 3}`, two.ID)), http.StatusCreated, &game)
+	var round domain.RoundContext
+	decode(t, s.do(t, http.MethodPost, fmt.Sprintf("/game/%d/round/create", game.ID), one.Token, ""), http.StatusCreated, &round)
+	return game, round
+}
+
+// errorCode fails unless rec is an error response with status, and returns
+// its code.
+func errorCode(t *testing.T, rec *httptest.ResponseRecorder, status int) string {
+	t.Helper()
+	var body struct {
+		Error struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	decode(t, rec, status, &body)
+	if body.Error.Code == "" || body.Error.Message == "" {
+		t.Fatalf("error response without a code or message: %+v", body)
+	}
+	return body.Error.Code
+}
+
+func TestPlayHandRejectsBadHands(t *testing.T) {
+	s := newServer(t)
+	one, two := s.player(t, "one"), s.player(t, "two")
+	game, round := s.game(t, one, two)
+	play := fmt.Sprintf("/game/%d/round/%d/playHand", game.ID, round.ID)
+
+	tests := []struct {
+		name   string
+		body   string
+		status int
+		code   string
+	}{
+		{"missing", `{}`, http.StatusBadRequest, "invalid_hand"},
+		{"empty", `{"hand": ""}`, http.StatusBadRequest, "invalid_hand"},
+		{"not a weapon name", `{"hand": "rock paper"}`, http.StatusBadRequest, "invalid_hand"},
+		{"not a string", `{"hand": 1}`, http.StatusBadRequest, "invalid_hand"},
+		{"not JSON", `{"hand":`, http.StatusBadRequest, "invalid_json"},
+		// a well formed hand the game's rule set does not have
+		{"not in the rule set", `{"hand": "lizard"}`, http.StatusUnprocessableEntity, "invalid_hand"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code := errorCode(t, s.do(t, http.MethodPost, play, one.Token, tt.body), tt.status); code != tt.code {
+				t.Fatalf("code = %q, want %q", code, tt.code)
+			}
+		})
+	}
+
+	var played domain.RoundContext
+	decode(t, s.do(t, http.MethodPost, play, one.Token, `{"hand": "rock"}`), http.StatusOK, &played)
+	if played.PlayerOneHand != domain.Rock {
+		t.Fatalf("played round = %+v", played)
+	}
+}
@@ -1,10 +1,8 @@
 package handler
 
 import (
-	"encoding/json"
 	"fmt"
 	"net/http"
-	"strconv"
 
 	"github.com/ellisbywater/http-rock-paper-scissors/internal/domain"
 	"github.com/ellisbywater/http-rock-paper-scissors/internal/service"
@@ -17,8 +15,18 @@ type RoundResultRequest struct {
 
 type NewGameRequest struct {
 	TotalRounds int `json:"total_rounds"`
-	PlayerOne   int `json:"player_one"`
-	PlayerTwo   int `json:"player_two"`
+	// PlayerOne is the authenticated player. It may be omitted; if it is
+	// sent it has to match the caller.
+	PlayerOne   int            `json:"player_one"`
+	PlayerTwo   int            `json:"player_two"`
+	Mode        string         `json:"mode"`
+	TargetScore int            `json:"target_score"`
+	TiePolicy   string         `json:"tie_policy"`
+	RuleSet     string         `json:"rule_set"`
+	Weapons     domain.Weapons `json:"weapons"`
+	// CommitReveal makes players commit to a hash of their hand before
+	// revealing it.
+	CommitReveal bool `json:"commit_reveal"`
 }
 
 type NewPlayerRequest struct {
@@ -26,8 +34,8 @@ type NewPlayerRequest struct {
 }
 
 type RoundPlayerInput struct {
-	PlayerID int `json:"id"`
-	Hand     int `json:"hand"`
+	PlayerID int         `json:"id"`
+	Hand     domain.Hand `json:"hand"`
 }
 
 type RoundCreateRequest struct {
@@ -43,33 +51,69 @@ func NewGameHandler(service service.GameService) *GameHandlers {
 }
 
 func (gh *GameHandlers) Create(w http.ResponseWriter, r *http.Request) {
+	player, err := authenticatedPlayer(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
 	var new_game_req NewGameRequest
-	if err := json.NewDecoder(r.Body).Decode(&new_game_req); err != nil {
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+	if err := decodeJSON(r, &new_game_req); err != nil {
+		writeError(w, err)
+		return
+	}
+	if new_game_req.PlayerOne != 0 && new_game_req.PlayerOne != player.ID {
+		writeError(w, fmt.Errorf("%w: player_one must be you (%d)", domain.ErrPlayerMismatch, player.ID))
+		return
 	}
-	defer r.Body.Close()
-	if new_game_req.TotalRounds < 1 {
+	new_game_req.PlayerOne = player.ID
+	if new_game_req.Mode != domain.GameModeFirstTo && new_game_req.TotalRounds < 1 {
 		new_game_req.TotalRounds = 1
 	}
-	game, err := gh.service.NewGame(r.Context(), new_game_req.TotalRounds, new_game_req.PlayerOne, new_game_req.PlayerTwo)
+	game, err := gh.service.NewGame(r.Context(), domain.GameCreateRequest{
+		TotalRounds:  new_game_req.TotalRounds,
+		PlayerOneID:  new_game_req.PlayerOne,
+		PlayerTwoID:  new_game_req.PlayerTwo,
+		Mode:         new_game_req.Mode,
+		TargetScore:  new_game_req.TargetScore,
+		TiePolicy:    new_game_req.TiePolicy,
+		RuleSet:      new_game_req.RuleSet,
+		Weapons:      new_game_req.Weapons,
+		CommitReveal: new_game_req.CommitReveal,
+	})
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeError(w, err)
+		return
 	}
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(game)
+	writeJSON(w, http.StatusCreated, game)
 }
 
 func (gh *GameHandlers) GetGame(w http.ResponseWriter, r *http.Request) {
-	game_id, err := strconv.Atoi(r.PathValue("gameId"))
+	game_id, err := pathID(r, "gameId")
 	if err != nil {
-		http.Error(w, "Invalid Game ID", http.StatusBadRequest)
+		writeError(w, err)
+		return
 	}
 	game, err := gh.service.GetGame(r.Context(), game_id)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, game.ForViewer(viewerID(r)))
+}
+
+func (gh *GameHandlers) List(w http.ResponseWriter, r *http.Request) {
+	filter, err := gameFilterFromQuery(r)
+	if err != nil {
+		writeError(w, err)
+		return
 	}
-	w.WriteHeader(http.StatusFound)
-	json.NewEncoder(w).Encode(game)
+	page, err := gh.service.ListGames(r.Context(), filter)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	page.Games = domain.GamesForViewer(page.Games, viewerID(r))
+	writeJSON(w, http.StatusOK, page)
 }
 
 type PlayerHandlers struct {
@@ -82,100 +126,480 @@ func NewPlayerHandler(service service.PlayerService) *PlayerHandlers {
 
 func (ph *PlayerHandlers) Create(w http.ResponseWriter, r *http.Request) {
 	var new_player_req NewPlayerRequest
-	if err := json.NewDecoder(r.Body).Decode(&new_player_req); err != nil {
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
-	}
-	defer r.Body.Close()
-	if new_player_req.UserName == "" {
-		http.Error(w, "Username cannot be blank", http.StatusBadRequest)
+	if err := decodeJSON(r, &new_player_req); err != nil {
+		writeError(w, err)
+		return
 	}
 	player, err := ph.service.CreatePlayer(r.Context(), new_player_req.UserName)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeError(w, err)
+		return
 	}
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(player)
+	writeJSON(w, http.StatusCreated, player)
 }
 
 func (ph *PlayerHandlers) Get(w http.ResponseWriter, r *http.Request) {
-	player_id, err := strconv.Atoi(r.PathValue("playerId"))
+	player_id, err := pathID(r, "playerId")
 	if err != nil {
-		http.Error(w, "Invalid player id", http.StatusBadRequest)
+		writeError(w, err)
+		return
 	}
 	player, err := ph.service.GetPlayer(r.Context(), player_id)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeError(w, err)
+		return
 	}
-	json.NewEncoder(w).Encode(player)
+	writeJSON(w, http.StatusOK, player)
+}
+
+func (ph *PlayerHandlers) List(w http.ResponseWriter, r *http.Request) {
+	filter, err := playerFilterFromQuery(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	page, err := ph.service.ListPlayers(r.Context(), filter)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, page)
 }
 
 func (ph *PlayerHandlers) GetGames(w http.ResponseWriter, r *http.Request) {
-	player_id, err := strconv.Atoi(r.PathValue("playerId"))
+	player_id, err := pathID(r, "playerId")
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	filter, err := gameFilterFromQuery(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	page, err := ph.service.GetPlayerGames(r.Context(), player_id, filter)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	page.Games = domain.GamesForViewer(page.Games, viewerID(r))
+	writeJSON(w, http.StatusOK, page)
+}
+
+func (ph *PlayerHandlers) GetStats(w http.ResponseWriter, r *http.Request) {
+	player_id, err := pathID(r, "playerId")
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	stats, err := ph.service.GetStats(r.Context(), player_id)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, stats)
+}
+
+func (ph *PlayerHandlers) GetRatings(w http.ResponseWriter, r *http.Request) {
+	player_id, err := pathID(r, "playerId")
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	ratings, err := ph.service.GetRatings(r.Context(), player_id)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, ratings)
+}
+
+func (ph *PlayerHandlers) HeadToHead(w http.ResponseWriter, r *http.Request) {
+	player_id, err := pathID(r, "playerId")
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	opponent_id, err := pathID(r, "opponentId")
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	filter, err := gameFilterFromQuery(r)
 	if err != nil {
-		http.Error(w, "Invalid player id", http.StatusBadRequest)
+		writeError(w, err)
+		return
 	}
-	games, err := ph.service.GetPlayerGames(r.Context(), player_id)
+	h2h, err := ph.service.HeadToHead(r.Context(), player_id, opponent_id, filter)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeError(w, err)
+		return
 	}
-	json.NewEncoder(w).Encode(games)
+	h2h.Games.Games = domain.GamesForViewer(h2h.Games.Games, viewerID(r))
+	writeJSON(w, http.StatusOK, h2h)
 }
 
 type RoundHandlers struct {
 	service service.RoundService
+	games   service.GameService
 }
 
-func NewRoundHandlers(service service.RoundService) *RoundHandlers {
-	return &RoundHandlers{service: service}
+func NewRoundHandlers(service service.RoundService, games service.GameService) *RoundHandlers {
+	return &RoundHandlers{service: service, games: games}
 }
 
+// Create starts the game's next round. Only the game's players may.
 func (rh *RoundHandlers) Create(w http.ResponseWriter, r *http.Request) {
-	gameId, err := strconv.Atoi(r.PathValue("gameId"))
+	player, err := authenticatedPlayer(r)
 	if err != nil {
-		http.Error(w, "Invalid game id", http.StatusBadRequest)
+		writeError(w, err)
+		return
+	}
+	gameId, err := pathID(r, "gameId")
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	game, err := rh.games.GetGame(r.Context(), gameId)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if player.ID != game.PlayerOneId && player.ID != game.PlayerTwoId {
+		writeError(w, domain.ErrNotParticipant)
+		return
 	}
 	var newRoundRequest domain.RoundContext
 
 	newRoundRequest.GameID = gameId
 	round, err := rh.service.Create(r.Context(), newRoundRequest)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, round.ForViewer(player.ID))
+}
+
+func (rh *RoundHandlers) Get(w http.ResponseWriter, r *http.Request) {
+	gameId, err := pathID(r, "gameId")
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	roundId, err := pathID(r, "roundId")
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	round, err := rh.service.GetInGame(r.Context(), gameId, roundId)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, round.ForViewer(viewerID(r)))
+}
+
+func (rh *RoundHandlers) List(w http.ResponseWriter, r *http.Request) {
+	gameId, err := pathID(r, "gameId")
+	if err != nil {
+		writeError(w, err)
+		return
 	}
-	json.NewEncoder(w).Encode(round)
+	rounds, err := rh.service.ListByGame(r.Context(), gameId)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, domain.RoundsForViewer(*rounds, viewerID(r)))
 }
 
 // TODO: Change roundId to roundCount and move roundId to r.Body
 func (rh *RoundHandlers) PlayHand(w http.ResponseWriter, r *http.Request) {
-	roundId, err := strconv.Atoi(r.PathValue("roundId"))
+	player, err := authenticatedPlayer(r)
 	if err != nil {
-		http.Error(w, "Invalid Round ID", http.StatusBadRequest)
+		writeError(w, err)
+		return
 	}
-	gameId, err := strconv.Atoi(r.PathValue("gameId"))
+	roundId, err := pathID(r, "roundId")
 	if err != nil {
-		http.Error(w, "Invalid game id", http.StatusBadRequest)
+		writeError(w, err)
+		return
+	}
+	gameId, err := pathID(r, "gameId")
+	if err != nil {
+		writeError(w, err)
+		return
 	}
 
+	// CurrentPlayer is optional; the hand is always played for the caller.
+	// Nonce is the reveal in commit-reveal games.
 	type PlayHandRequest struct {
-		CurrentPlayer int    `json:"current_player"`
-		Hand          string `json:"hand"`
+		CurrentPlayer int         `json:"current_player"`
+		Hand          domain.Hand `json:"hand"`
+		Nonce         string      `json:"nonce"`
 	}
 
 	var playHandRequest PlayHandRequest
-	var roundCtx domain.RoundContext
-	if err := json.NewDecoder(r.Body).Decode(&playHandRequest); err != nil {
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+	if err := decodeJSON(r, &playHandRequest); err != nil {
+		writeError(w, err)
+		return
+	}
+	if playHandRequest.CurrentPlayer != 0 && playHandRequest.CurrentPlayer != player.ID {
+		writeError(w, fmt.Errorf("%w: current_player must be you (%d)", domain.ErrPlayerMismatch, player.ID))
+		return
+	}
+	if playHandRequest.Hand.IsNone() {
+		writeError(w, malformed(fmt.Errorf("%w: hand is required", domain.ErrInvalidHand)))
+		return
 	}
-	defer r.Body.Close()
 
-	roundCtx = domain.RoundContext{
+	roundCtx := domain.RoundContext{
 		ID:     roundId,
 		GameID: gameId,
 	}
-	roundCtx.SetCurrentPlayerUnsafe(playHandRequest.CurrentPlayer)
-	fmt.Println("Current Player in PlayHand is: ", roundCtx.CurrentPlayer)
-	hand, err := rh.service.UpdateHand(r.Context(), playHandRequest.Hand, roundCtx)
+	roundCtx.SetCurrentPlayerUnsafe(player.ID)
+	hand, err := rh.service.UpdateHand(r.Context(), playHandRequest.Hand, playHandRequest.Nonce, roundCtx)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, hand.ForViewer(player.ID))
+}
+
+// CommitHand stores the caller's commitment in a commit-reveal game,
+// hex(sha256(hand + ":" + nonce)) with a nonce of 32 to 128 hex characters
+// (at least 128 random bits). The hand itself is sent to PlayHand, with the
+// nonce, once both players committed. Reveals with a shorter nonce are
+// rejected, so a commitment made with one can never be opened.
+func (rh *RoundHandlers) CommitHand(w http.ResponseWriter, r *http.Request) {
+	player, err := authenticatedPlayer(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	roundId, err := pathID(r, "roundId")
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	gameId, err := pathID(r, "gameId")
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	type CommitHandRequest struct {
+		Commitment string `json:"commitment"`
+	}
+
+	var commitRequest CommitHandRequest
+	if err := decodeJSON(r, &commitRequest); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	roundCtx := domain.RoundContext{
+		ID:     roundId,
+		GameID: gameId,
+	}
+	roundCtx.SetCurrentPlayerUnsafe(player.ID)
+	round, err := rh.service.CommitHand(r.Context(), commitRequest.Commitment, roundCtx)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, round.ForViewer(player.ID))
+}
+
+type LeaderboardHandlers struct {
+	service service.LeaderboardService
+}
+
+func NewLeaderboardHandler(service service.LeaderboardService) *LeaderboardHandlers {
+	return &LeaderboardHandlers{service: service}
+}
+
+func (lh *LeaderboardHandlers) List(w http.ResponseWriter, r *http.Request) {
+	filter, err := leaderboardFilterFromQuery(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	page, err := lh.service.List(r.Context(), filter)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, page)
+}
+
+type WebhookHandlers struct {
+	service service.WebhookService
+}
+
+func NewWebhookHandler(service service.WebhookService) *WebhookHandlers {
+	return &WebhookHandlers{service: service}
+}
+
+type NewWebhookRequest struct {
+	URL string `json:"url"`
+	// Events are the event types to deliver; all of them when empty.
+	Events []string `json:"events"`
+}
+
+func (wh *WebhookHandlers) Create(w http.ResponseWriter, r *http.Request) {
+	player, err := authenticatedPlayer(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	var new_webhook_req NewWebhookRequest
+	if err := decodeJSON(r, &new_webhook_req); err != nil {
+		writeError(w, err)
+		return
+	}
+	webhook, err := wh.service.CreateWebhook(r.Context(), domain.WebhookCreateRequest{
+		PlayerID: player.ID,
+		URL:      new_webhook_req.URL,
+		Events:   new_webhook_req.Events,
+	})
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, webhook)
+}
+
+func (wh *WebhookHandlers) List(w http.ResponseWriter, r *http.Request) {
+	player, err := authenticatedPlayer(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	webhooks, err := wh.service.ListWebhooks(r.Context(), player.ID)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, webhooks)
+}
+
+func (wh *WebhookHandlers) Get(w http.ResponseWriter, r *http.Request) {
+	player, err := authenticatedPlayer(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	webhook_id, err := pathID(r, "webhookId")
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	webhook, err := wh.service.GetWebhook(r.Context(), player.ID, webhook_id)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, webhook)
+}
+
+func (wh *WebhookHandlers) Delete(w http.ResponseWriter, r *http.Request) {
+	player, err := authenticatedPlayer(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	webhook_id, err := pathID(r, "webhookId")
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if err := wh.service.DeleteWebhook(r.Context(), player.ID, webhook_id); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (wh *WebhookHandlers) Deliveries(w http.ResponseWriter, r *http.Request) {
+	player, err := authenticatedPlayer(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	webhook_id, err := pathID(r, "webhookId")
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	var filter domain.WebhookDeliveryFilter
+	filter.Limit, filter.After, err = pageFromQuery(r.URL.Query())
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	page, err := wh.service.ListDeliveries(r.Context(), player.ID, webhook_id, filter)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, page)
+}
+
+// MatchmakingHandlers holds the service by pointer: the queue lives in it.
+type MatchmakingHandlers struct {
+	service *service.MatchmakingService
+}
+
+func NewMatchmakingHandler(service *service.MatchmakingService) *MatchmakingHandlers {
+	return &MatchmakingHandlers{service: service}
+}
+
+// Join queues the authenticated player. The body is optional.
+func (mh *MatchmakingHandlers) Join(w http.ResponseWriter, r *http.Request) {
+	player, err := authenticatedPlayer(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	var match_req domain.MatchRequest
+	if r.ContentLength != 0 {
+		if err := decodeJSON(r, &match_req); err != nil {
+			writeError(w, err)
+			return
+		}
+	}
+	ticket, err := mh.service.Join(r.Context(), player.ID, match_req)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusAccepted, ticket)
+}
+
+func (mh *MatchmakingHandlers) Leave(w http.ResponseWriter, r *http.Request) {
+	player, err := authenticatedPlayer(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if err := mh.service.Leave(r.Context(), player.ID); err != nil {
+		writeError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (mh *MatchmakingHandlers) Status(w http.ResponseWriter, r *http.Request) {
+	player, err := authenticatedPlayer(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	ticket, err := mh.service.Status(r.Context(), player.ID)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeError(w, err)
+		return
 	}
-	json.NewEncoder(w).Encode(hand)
+	writeJSON(w, http.StatusOK, ticket)
 }
@@ -0,0 +1,48 @@
+package handler
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Origins are the origins, besides the server's own, of the browser pages
+// allowed to follow games over WebSockets and event streams, such as
+// "https://rps.example". Tokens are not cookies, so a foreign page cannot
+// ride on a player's session; the check keeps pages the operator does not
+// know about from embedding the streams all the same.
+type Origins []string
+
+// ParseOrigins reads a comma-separated list of origins.
+func ParseOrigins(s string) Origins {
+	var origins Origins
+	for _, origin := range strings.Split(s, ",") {
+		if origin = strings.TrimSpace(origin); origin != "" {
+			origins = append(origins, strings.TrimSuffix(origin, "/"))
+		}
+	}
+	return origins
+}
+
+// allow reports whether r may be served: it comes from outside a browser,
+// which sends no Origin, from the server's own origin or from an allowed
+// one.
+func (o Origins) allow(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	if strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	for _, allowed := range o {
+		if strings.EqualFold(allowed, origin) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,105 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/ellisbywater/http-rock-paper-scissors/internal/domain"
+)
+
+// Query parameters shared by the list endpoints:
+//
+//	limit     page size, 1 to domain.MaxPageLimit
+//	cursor    next_cursor of the previous page
+//
+// and for game lists:
+//
+//	player, opponent   player ids
+//	status             finished | in_progress
+//	result             won | lost, for player
+//	from, to           RFC 3339 time or YYYY-MM-DD date; to is exclusive
+//
+// and for the leaderboard:
+//
+//	sort     rating | wins | win_rate | streak
+//	window   all | 7d | 30d
+
+func queryInt(q url.Values, name string) (int, error) {
+	v := q.Get(name)
+	if v == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("%w: %s must be a positive number", domain.ErrInvalidFilter, name)
+	}
+	return n, nil
+}
+
+func queryTime(q url.Values, name string) (time.Time, error) {
+	v := q.Get(name)
+	if v == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t.UTC(), nil
+	}
+	if t, err := time.Parse(time.DateOnly, v); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("%w: %s must be an RFC 3339 time or a YYYY-MM-DD date", domain.ErrInvalidFilter, name)
+}
+
+func pageFromQuery(q url.Values) (limit int, after *domain.Cursor, err error) {
+	if limit, err = queryInt(q, "limit"); err != nil {
+		return 0, nil, err
+	}
+	after, err = domain.DecodeCursor(q.Get("cursor"))
+	return limit, after, err
+}
+
+func playerFilterFromQuery(r *http.Request) (domain.PlayerFilter, error) {
+	var filter domain.PlayerFilter
+	var err error
+	filter.Limit, filter.After, err = pageFromQuery(r.URL.Query())
+	return filter, err
+}
+
+func gameFilterFromQuery(r *http.Request) (domain.GameFilter, error) {
+	q := r.URL.Query()
+	filter := domain.GameFilter{
+		Status: q.Get("status"),
+		Result: q.Get("result"),
+	}
+	var err error
+	if filter.Limit, filter.After, err = pageFromQuery(q); err != nil {
+		return filter, err
+	}
+	if filter.PlayerID, err = queryInt(q, "player"); err != nil {
+		return filter, err
+	}
+	if filter.OpponentID, err = queryInt(q, "opponent"); err != nil {
+		return filter, err
+	}
+	if filter.CreatedFrom, err = queryTime(q, "from"); err != nil {
+		return filter, err
+	}
+	if filter.CreatedTo, err = queryTime(q, "to"); err != nil {
+		return filter, err
+	}
+	return filter, nil
+}
+
+func leaderboardFilterFromQuery(r *http.Request) (domain.LeaderboardFilter, error) {
+	q := r.URL.Query()
+	filter := domain.LeaderboardFilter{
+		Sort:   q.Get("sort"),
+		Window: q.Get("window"),
+	}
+	var err error
+	filter.Limit, filter.After, err = pageFromQuery(q)
+	return filter, err
+}
@@ -0,0 +1,118 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/ellisbywater/http-rock-paper-scissors/internal/domain"
+)
+
+// Errors that only exist at the HTTP layer. They use the domain error type so
+// writeError treats them like any other error.
+var (
+	errInvalidJSON = &domain.Error{Kind: domain.KindValidation, Code: "invalid_json", Message: "request body is not valid JSON"}
+	errInvalidID   = &domain.Error{Kind: domain.KindValidation, Code: "invalid_id", Message: "invalid id"}
+
+	errOriginNotAllowed = &domain.Error{Kind: domain.KindForbidden, Code: "origin_not_allowed", Message: "pages from this origin may not follow games"}
+)
+
+// malformedError marks a domain validation error that came from reading the
+// request itself, such as a hand that does not parse, so that it is reported
+// as a bad request rather than an unprocessable one.
+type malformedError struct {
+	error
+}
+
+func (e malformedError) Unwrap() error { return e.error }
+
+// malformed marks err as raised while reading the request.
+func malformed(err error) error {
+	return malformedError{err}
+}
+
+type errorDetail struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+type errorResponse struct {
+	Error errorDetail `json:"error"`
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("encode response: %v", err)
+	}
+}
+
+// writeError maps err to a status code and writes the JSON error envelope.
+// Errors outside the domain error set are logged and reported as a generic
+// internal error so driver messages never reach clients.
+func writeError(w http.ResponseWriter, err error) {
+	derr, ok := domain.AsError(err)
+	if !ok {
+		log.Printf("internal error: %v", err)
+		writeJSON(w, http.StatusInternalServerError, errorResponse{errorDetail{
+			Code:    "internal_error",
+			Message: "something went wrong",
+		}})
+		return
+	}
+	if derr.Kind == domain.KindUnauthenticated {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="rps"`)
+	}
+	writeJSON(w, statusFor(derr, err), errorResponse{errorDetail{
+		Code:    derr.Code,
+		Message: err.Error(),
+	}})
+}
+
+func statusFor(derr *domain.Error, err error) int {
+	switch derr.Kind {
+	case domain.KindNotFound:
+		return http.StatusNotFound
+	case domain.KindConflict:
+		return http.StatusConflict
+	case domain.KindForbidden:
+		return http.StatusForbidden
+	case domain.KindUnauthenticated:
+		return http.StatusUnauthorized
+	case domain.KindValidation:
+		// malformed requests are 400, well formed but invalid ones 422
+		var malformedErr malformedError
+		if errors.Is(err, errInvalidJSON) || errors.Is(err, errInvalidID) || errors.As(err, &malformedErr) {
+			return http.StatusBadRequest
+		}
+		return http.StatusUnprocessableEntity
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// decodeJSON reads the request body into v. Domain errors raised while
+// unmarshalling (an invalid hand, say) keep their code but are malformed.
+func decodeJSON(r *http.Request, v any) error {
+	defer r.Body.Close()
+	if err := json.NewDecoder(r.Body).Decode(v); err != nil {
+		if _, ok := domain.AsError(err); ok {
+			return malformed(err)
+		}
+		return errInvalidJSON
+	}
+	return nil
+}
+
+// pathID parses the named path value as an id.
+func pathID(r *http.Request, name string) (int, error) {
+	id, err := strconv.Atoi(r.PathValue(name))
+	if err != nil || id < 1 {
+		return 0, fmt.Errorf("%w: %s must be a positive number", errInvalidID, name)
+	}
+	return id, nil
+}
@@ -0,0 +1,65 @@
+package handler
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ellisbywater/http-rock-paper-scissors/internal/domain"
+)
+
+func TestWriteError(t *testing.T) {
+	tests := []struct {
+		name    string
+		err     error
+		status  int
+		code    string
+		message string
+	}{
+		{"not found", domain.ErrGameNotFound, http.StatusNotFound, "game_not_found", "game not found"},
+		{"conflict", domain.ErrUsernameTaken, http.StatusConflict, "username_taken", "username is already taken"},
+		{"forbidden", domain.ErrNotParticipant, http.StatusForbidden, "not_a_participant", "player is not in this game"},
+		{"unauthenticated", domain.ErrUnauthenticated, http.StatusUnauthorized, "unauthenticated", "missing or invalid player token"},
+		{"validation", domain.ErrInvalidUsername, http.StatusUnprocessableEntity, "invalid_username", "invalid username"},
+		{"wrapped validation", fmt.Errorf("%w: limit must be between 1 and 100", domain.ErrInvalidFilter), http.StatusUnprocessableEntity, "invalid_filter", "invalid filter: limit must be between 1 and 100"},
+		{"malformed validation", malformed(domain.ErrInvalidHand), http.StatusBadRequest, "invalid_hand", "invalid hand"},
+		{"invalid JSON", errInvalidJSON, http.StatusBadRequest, "invalid_json", "request body is not valid JSON"},
+		{"invalid id", fmt.Errorf("%w: gameId must be a positive number", errInvalidID), http.StatusBadRequest, "invalid_id", "invalid id: gameId must be a positive number"},
+		{"internal kind", &domain.Error{Kind: domain.KindInternal, Code: "broken", Message: "broken"}, http.StatusInternalServerError, "broken", "broken"},
+		// driver errors are logged, never shown
+		{"no rows", sql.ErrNoRows, http.StatusInternalServerError, "internal_error", "something went wrong"},
+		{"wrapped no rows", fmt.Errorf("get game 7: %w", sql.ErrNoRows), http.StatusInternalServerError, "internal_error", "something went wrong"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			writeError(rec, tt.err)
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.status)
+			}
+			if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+				t.Fatalf("Content-Type = %q", ct)
+			}
+			if got := rec.Header().Get("WWW-Authenticate") != ""; got != (tt.status == http.StatusUnauthorized) {
+				t.Fatalf("WWW-Authenticate = %q", rec.Header().Get("WWW-Authenticate"))
+			}
+			if strings.Contains(rec.Body.String(), "sql:") {
+				t.Fatalf("body leaks the driver error: %s", rec.Body)
+			}
+
+			var body map[string]map[string]string
+			if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			want := map[string]map[string]string{"error": {"code": tt.code, "message": tt.message}}
+			if !reflect.DeepEqual(body, want) {
+				t.Fatalf("body = %v, want %v", body, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package handler
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/ellisbywater/http-rock-paper-scissors/internal/domain"
+	"github.com/ellisbywater/http-rock-paper-scissors/internal/realtime"
+	"github.com/ellisbywater/http-rock-paper-scissors/internal/service"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// writeWait bounds every write to the client.
+	writeWait = 10 * time.Second
+	// The server pings every pingPeriod and drops clients that have not
+	// answered within pongWait.
+	pongWait   = 60 * time.Second
+	pingPeriod = pongWait * 9 / 10
+	// Clients have nothing to say beyond control frames.
+	maxClientMessage = 512
+)
+
+var upgrader = websocket.Upgrader{
+	// Serve has checked the origin already, answering in JSON
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+type GameSocketHandlers struct {
+	games   service.GameService
+	hub     *realtime.Hub
+	origins Origins
+}
+
+// NewGameSocketHandler serves pages from the server's own origin and from
+// origins.
+func NewGameSocketHandler(games service.GameService, hub *realtime.Hub, origins Origins) *GameSocketHandlers {
+	return &GameSocketHandlers{games: games, hub: hub, origins: origins}
+}
+
+// Serve upgrades to a WebSocket that pushes the game's events (see
+// domain.GameEvent) as JSON text messages. Only the game's players may
+// connect, from pages of an allowed origin; browsers, which cannot set
+// headers on a WebSocket, may pass the token as ?access_token=.
+func (gs *GameSocketHandlers) Serve(w http.ResponseWriter, r *http.Request) {
+	if !gs.origins.allow(r) {
+		writeError(w, errOriginNotAllowed)
+		return
+	}
+	player, err := authenticatedPlayer(r)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	game_id, err := pathID(r, "gameId")
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	game, err := gs.games.GetGame(r.Context(), game_id)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if player.ID != game.PlayerOneId && player.ID != game.PlayerTwoId {
+		writeError(w, domain.ErrNotParticipant)
+		return
+	}
+
+	// Subscribe before upgrading so nothing published in between is lost
+	sub := gs.hub.Subscribe(game_id)
+	defer sub.Close()
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// Upgrade has already answered the request
+		return
+	}
+	defer conn.Close()
+
+	// The reader only services control frames; it ends when the client
+	// goes away or stops answering pings.
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		conn.SetReadLimit(maxClientMessage)
+		conn.SetReadDeadline(time.Now().Add(pongWait))
+		conn.SetPongHandler(func(string) error {
+			return conn.SetReadDeadline(time.Now().Add(pongWait))
+		})
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	ping := time.NewTicker(pingPeriod)
+	defer ping.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case event, ok := <-sub.Events():
+			conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if !ok {
+				// Dropped for falling behind; the client should reconnect
+				conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "too slow"))
+				return
+			}
+			if err := conn.WriteJSON(event); err != nil {
+				return
+			}
+		case <-ping.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(writeWait)); err != nil {
+				return
+			}
+		}
+	}
+}
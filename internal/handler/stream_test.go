@@ -0,0 +1,266 @@
+package handler_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ellisbywater/http-rock-paper-scissors/internal/domain"
+	"github.com/gorilla/websocket"
+)
+
+// recorded waits until the game's event log has at least n events, as the
+// bus records them in the background, and returns them.
+func (s *server) recorded(t *testing.T, gameID int, n int) []domain.GameEvent {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		var events []domain.GameEvent
+		if err := s.events.ListByGame(context.Background(), gameID, 0, &events); err != nil {
+			t.Fatal(err)
+		}
+		if len(events) >= n {
+			return events
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("game %d has %d events, want %d", gameID, len(events), n)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// sse is an event read off an event stream.
+type sse struct {
+	id    int
+	event string
+	data  domain.GameEvent
+}
+
+// eventStream opens the event stream at target and returns a function
+// reading its next event. The stream is closed when the test ends.
+func eventStream(t *testing.T, srv *httptest.Server, target string, header http.Header) func() sse {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+target, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header = header.Clone()
+	req.Header.Set("Accept", "text/event-stream")
+	res, err := srv.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// cancel before the server closes, which waits for open streams
+	t.Cleanup(func() {
+		cancel()
+		res.Body.Close()
+	})
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d, want %d", res.StatusCode, http.StatusOK)
+	}
+
+	lines := bufio.NewScanner(res.Body)
+	return func() sse {
+		t.Helper()
+		var next sse
+		for lines.Scan() {
+			name, value, _ := strings.Cut(lines.Text(), ": ")
+			switch name {
+			case "id":
+				if next.id, err = strconv.Atoi(value); err != nil {
+					t.Fatal(err)
+				}
+			case "event":
+				next.event = value
+			case "data":
+				if err := json.Unmarshal([]byte(value), &next.data); err != nil {
+					t.Fatal(err)
+				}
+			case "":
+				// a blank line ends an event, and heartbeats are comments
+				if next.event != "" {
+					return next
+				}
+			}
+		}
+		t.Fatalf("stream ended: %v", lines.Err())
+		return next
+	}
+}
+
+// playRound has one beat two in the round.
+func (s *server) playRound(t *testing.T, one, two domain.PlayerCreateResponse, gameID int, roundID int) {
+	t.Helper()
+	play := fmt.Sprintf("/game/%d/round/%d/playHand", gameID, roundID)
+	decode(t, s.do(t, http.MethodPost, play, one.Token, `{"hand": "rock"}`), http.StatusOK, &domain.RoundContext{})
+	decode(t, s.do(t, http.MethodPost, play, two.Token, `{"hand": "scissors"}`), http.StatusOK, &domain.RoundContext{})
+}
+
+func bearer(token string) http.Header {
+	return http.Header{"Authorization": {"Bearer " + token}}
+}
+
+func TestStreamsOnlyForParticipants(t *testing.T) {
+	s := newServer(t)
+	one, two, outsider := s.player(t, "one"), s.player(t, "two"), s.player(t, "outsider")
+	game, _ := s.game(t, one, two)
+	gameEvents := fmt.Sprintf("/game/%d/events", game.ID)
+	playerEvents := fmt.Sprintf("/player/%d/events", one.ID)
+
+	tests := []struct {
+		name   string
+		target string
+		header http.Header
+		status int
+		code   string
+	}{
+		{"anonymous", gameEvents, http.Header{}, http.StatusUnauthorized, "unauthenticated"},
+		{"outsider's game stream", gameEvents, bearer(outsider.Token), http.StatusForbidden, "not_a_participant"},
+		{"unknown game", "/game/4242/events", bearer(one.Token), http.StatusNotFound, "game_not_found"},
+		{"another player's stream", playerEvents, bearer(two.Token), http.StatusForbidden, "player_mismatch"},
+		{"bad Last-Event-ID", gameEvents, http.Header{"Authorization": {"Bearer " + one.Token}, "Last-Event-Id": {"one"}}, http.StatusUnprocessableEntity, "invalid_filter"},
+		{"foreign origin", gameEvents, http.Header{"Authorization": {"Bearer " + one.Token}, "Origin": {"https://evil.example"}}, http.StatusForbidden, "origin_not_allowed"},
+		{"foreign origin on the player stream", playerEvents, http.Header{"Authorization": {"Bearer " + one.Token}, "Origin": {"https://evil.example"}}, http.StatusForbidden, "origin_not_allowed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := tt.header.Clone()
+			header.Set("Accept", "text/event-stream")
+			if code := errorCode(t, s.send(t, http.MethodGet, tt.target, header, ""), tt.status); code != tt.code {
+				t.Fatalf("code = %q, want %q", code, tt.code)
+			}
+		})
+	}
+}
+
+func TestGameStreamReplaysBacklog(t *testing.T) {
+	s := newServer(t)
+	srv := s.start(t)
+	one, two := s.player(t, "one"), s.player(t, "two")
+	game, round := s.game(t, one, two)
+	s.playRound(t, one, two, game.ID, round.ID)
+	// both hands, the round and the score
+	logged := s.recorded(t, game.ID, 4)
+	target := fmt.Sprintf("/game/%d/events", game.ID)
+
+	tests := []struct {
+		name   string
+		header http.Header
+		after  int
+	}{
+		{"from the start", bearer(two.Token), 0},
+		{"resuming", http.Header{"Authorization": {"Bearer " + one.Token}, "Last-Event-Id": {"2"}}, 2},
+		{"from an allowed origin", http.Header{"Authorization": {"Bearer " + one.Token}, "Origin": {allowedOrigin}}, 0},
+		{"from its own origin", http.Header{"Authorization": {"Bearer " + one.Token}, "Origin": {srv.URL}}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next := eventStream(t, srv, target, tt.header)
+			for _, want := range logged[tt.after:] {
+				got := next()
+				if got.id != want.Seq || got.event != want.Type || got.data.ID != want.ID {
+					t.Fatalf("got event %d %s (%+v), want %d %s", got.id, got.event, got.data, want.Seq, want.Type)
+				}
+			}
+		})
+	}
+}
+
+func TestPlayerStreamResumes(t *testing.T) {
+	s := newServer(t)
+	srv := s.start(t)
+	one, two := s.player(t, "one"), s.player(t, "two")
+	game, round := s.game(t, one, two)
+	s.playRound(t, one, two, game.ID, round.ID)
+	logged := s.recorded(t, game.ID, 4)
+
+	header := bearer(one.Token)
+	header.Set("Last-Event-ID", strconv.Itoa(logged[0].ID))
+	next := eventStream(t, srv, fmt.Sprintf("/player/%d/events", one.ID), header)
+	for _, want := range logged[1:] {
+		if got := next(); got.id != want.ID || got.event != want.Type {
+			t.Fatalf("got event %d %s, want %d %s", got.id, got.event, want.ID, want.Type)
+		}
+	}
+
+	// and then follows the game as it goes on
+	var second domain.RoundContext
+	decode(t, s.do(t, http.MethodPost, fmt.Sprintf("/game/%d/round/create", game.ID), one.Token, ""), http.StatusCreated, &second)
+	decode(t, s.do(t, http.MethodPost, fmt.Sprintf("/game/%d/round/%d/playHand", game.ID, second.ID), two.Token, `{"hand": "paper"}`), http.StatusOK, &domain.RoundContext{})
+	got := next()
+	if got.event != domain.EventHandPlayed || got.data.PlayerID != two.ID || got.id <= logged[len(logged)-1].ID {
+		t.Fatalf("live event = %d %s (%+v)", got.id, got.event, got.data)
+	}
+}
+
+func TestGameSocket(t *testing.T) {
+	s := newServer(t)
+	srv := s.start(t)
+	one, two, outsider := s.player(t, "one"), s.player(t, "two"), s.player(t, "outsider")
+	game, round := s.game(t, one, two)
+	url := "ws" + strings.TrimPrefix(srv.URL, "http") + fmt.Sprintf("/game/%d/ws", game.ID)
+
+	dial := func(token string, origin string) (*websocket.Conn, *http.Response, error) {
+		header := bearer(token)
+		if origin != "" {
+			header.Set("Origin", origin)
+		}
+		conn, res, err := websocket.DefaultDialer.Dial(url, header)
+		if conn != nil {
+			t.Cleanup(func() { conn.Close() })
+		}
+		return conn, res, err
+	}
+
+	refused := []struct {
+		name   string
+		token  string
+		origin string
+		status int
+	}{
+		{"outsider", outsider.Token, "", http.StatusForbidden},
+		{"unknown token", "nope", "", http.StatusUnauthorized},
+		{"foreign origin", one.Token, "https://evil.example", http.StatusForbidden},
+	}
+	for _, tt := range refused {
+		t.Run(tt.name, func(t *testing.T) {
+			_, res, err := dial(tt.token, tt.origin)
+			if err == nil {
+				t.Fatal("connected")
+			}
+			if res == nil || res.StatusCode != tt.status {
+				t.Fatalf("response = %v, want status %d", res, tt.status)
+			}
+		})
+	}
+
+	for _, origin := range []string{"", allowedOrigin, srv.URL} {
+		conn, _, err := dial(two.Token, origin)
+		if err != nil {
+			t.Fatalf("dial from origin %q: %v", origin, err)
+		}
+		conn.Close()
+	}
+
+	conn, _, err := dial(two.Token, allowedOrigin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decode(t, s.do(t, http.MethodPost, fmt.Sprintf("/game/%d/round/%d/playHand", game.ID, round.ID), one.Token, `{"hand": "rock"}`), http.StatusOK, &domain.RoundContext{})
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var event domain.GameEvent
+	if err := conn.ReadJSON(&event); err != nil {
+		t.Fatal(err)
+	}
+	if event.Type != domain.EventHandPlayed || event.PlayerID != one.ID || event.RoundID != round.ID {
+		t.Fatalf("event = %+v", event)
+	}
+}
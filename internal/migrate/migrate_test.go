@@ -0,0 +1,266 @@
+package migrate_test
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ellisbywater/http-rock-paper-scissors/internal/migrate"
+	"github.com/ellisbywater/http-rock-paper-scissors/internal/repository/sqlite"
+	_ "github.com/lib/pq"
+)
+
+func TestSQLiteUpAndDown(t *testing.T) {
+	ctx := context.Background()
+	db, err := sqlite.Open(filepath.Join(t.TempDir(), "rps.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	migrator, err := migrate.New(db, migrate.DialectSQLite)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	applied, err := migrator.Up(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkStatus(t, migrator, len(applied))
+	if again, err := migrator.Up(ctx); err != nil || len(again) != 0 {
+		t.Fatalf("second Up applied %d migrations, err = %v", len(again), err)
+	}
+
+	reverted, err := migrator.Down(ctx, len(applied))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reverted) != len(applied) {
+		t.Fatalf("Down reverted %d migrations, want %d", len(reverted), len(applied))
+	}
+	checkStatus(t, migrator, 0)
+	var tables []string
+	rows, err := db.Query(`SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT IN ('schema_migrations', 'sqlite_sequence')`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			t.Fatal(err)
+		}
+		tables = append(tables, name)
+	}
+	if len(tables) != 0 {
+		t.Fatalf("tables left after reverting everything: %v", tables)
+	}
+
+	if _, err := migrator.Up(ctx); err != nil {
+		t.Fatalf("Up after Down: %v", err)
+	}
+}
+
+// TestSQLiteRedoesGameColumns reverts and reapplies the migrations that add
+// the game columns, which must take them out and bring them back.
+func TestSQLiteRedoesGameColumns(t *testing.T) {
+	ctx := context.Background()
+	db, err := sqlite.Open(filepath.Join(t.TempDir(), "rps.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	migrator, err := migrate.New(db, migrate.DialectSQLite)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := migrator.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+	gameColumns := []string{"rule_set", "weapons", "mode", "target_score", "tie_policy"}
+
+	var down int
+	statuses, err := migrator.Status(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, status := range statuses {
+		if status.Name == "rule_sets" {
+			down = len(statuses) - i
+		}
+	}
+	if down == 0 {
+		t.Fatal("no rule_sets migration")
+	}
+	if _, err := migrator.Down(ctx, down); err != nil {
+		t.Fatal(err)
+	}
+	columns := tableColumns(t, db, "games")
+	for _, column := range gameColumns {
+		if columns[column] {
+			t.Fatalf("games.%s left after reverting %d migrations", column, down)
+		}
+	}
+
+	if _, err := db.Exec(`
+		INSERT INTO players (username) VALUES ('a'), ('b');
+		INSERT INTO games (total_rounds, player_one_id, player_two_id) VALUES (5, 1, 2);
+	`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := migrator.Up(ctx); err != nil {
+		t.Fatalf("Up after Down: %v", err)
+	}
+	columns = tableColumns(t, db, "games")
+	for _, column := range gameColumns {
+		if !columns[column] {
+			t.Fatalf("games.%s missing after reapplying the migrations", column)
+		}
+	}
+	// games from before 0009_game_modes are best_of
+	var mode string
+	var targetScore int
+	if err := db.QueryRow(`SELECT mode, target_score FROM games WHERE id = 1`).Scan(&mode, &targetScore); err != nil {
+		t.Fatal(err)
+	}
+	if mode != "best_of" || targetScore != 3 {
+		t.Fatalf("game = %s/%d, want best_of/3", mode, targetScore)
+	}
+}
+
+// tableColumns returns the names of the columns of a SQLite table.
+func tableColumns(t *testing.T, db *sql.DB, table string) map[string]bool {
+	t.Helper()
+	rows, err := db.Query(`SELECT name FROM pragma_table_info(?)`, table)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	columns := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			t.Fatal(err)
+		}
+		columns[name] = true
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return columns
+}
+
+// checkStatus fails unless exactly the first applied migrations are applied.
+func checkStatus(t *testing.T, migrator *migrate.Migrator, applied int) {
+	t.Helper()
+	statuses, err := migrator.Status(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(statuses) == 0 {
+		t.Fatal("no migrations")
+	}
+	for i, status := range statuses {
+		if status.Applied != (i < applied) || status.Applied == status.AppliedAt.IsZero() {
+			t.Fatalf("status %d = %+v, want the first %d applied", i, status, applied)
+		}
+	}
+}
+
+// TestPostgresAdoptsBaselineSchema migrates a database created from the old
+// db/schema.sql, with a game in it, in a throwaway schema of the database in
+// TEST_DATABASE_URL.
+func TestPostgresAdoptsBaselineSchema(t *testing.T) {
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+	ctx := context.Background()
+	admin, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { admin.Close() })
+	schema := fmt.Sprintf("baseline_%d", time.Now().UnixNano())
+	if _, err := admin.Exec(`CREATE SCHEMA ` + schema); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { admin.Exec(`DROP SCHEMA ` + schema + ` CASCADE`) })
+
+	db, err := sql.Open("postgres", withSearchPath(t, dsn, schema))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	baseline, err := os.ReadFile(filepath.Join("testdata", "baseline_schema.sql"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(string(baseline)); err != nil {
+		t.Fatalf("baseline schema: %v", err)
+	}
+	_, err = db.Exec(`
+		INSERT INTO players (username) VALUES ('a'), ('b');
+		INSERT INTO games (total_rounds, player_one_id, player_two_id) VALUES (5, 1, 2);
+		INSERT INTO rounds (game, player_one_id, player_two_id, player_one_hand, player_two_hand) VALUES (1, 1, 2, 'rock', 'none');
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	migrator, err := migrate.New(db, migrate.DialectPostgres)
+	if err != nil {
+		t.Fatal(err)
+	}
+	applied, err := migrator.Up(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkStatus(t, migrator, len(applied))
+
+	var mode, tiePolicy, ruleSet, weapons string
+	var targetScore int
+	err = db.QueryRow(`SELECT mode, target_score, tie_policy, rule_set, weapons FROM games WHERE id = 1`).
+		Scan(&mode, &targetScore, &tiePolicy, &ruleSet, &weapons)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode != "best_of" || targetScore != 3 || tiePolicy != "count" || ruleSet != "classic" || weapons != "rock,paper,scissors" {
+		t.Fatalf("adopted game = %s/%d/%s/%s/%s", mode, targetScore, tiePolicy, ruleSet, weapons)
+	}
+
+	var one, two sql.NullString
+	if err := db.QueryRow(`SELECT player_one_hand, player_two_hand FROM rounds WHERE id = 1`).Scan(&one, &two); err != nil {
+		t.Fatal(err)
+	}
+	if one.String != "rock" || two.Valid {
+		t.Fatalf("adopted round hands = %v, %v; want rock and NULL", one, two)
+	}
+	// hands are no longer limited to the old enum
+	if _, err := db.Exec(`UPDATE rounds SET player_two_hand = 'lizard' WHERE id = 1`); err != nil {
+		t.Fatalf("hand outside the old enum: %v", err)
+	}
+}
+
+// withSearchPath points every connection opened with dsn at schema. lib/pq
+// sends parameters it does not know itself to the server.
+func withSearchPath(t *testing.T, dsn string, schema string) string {
+	t.Helper()
+	if !strings.HasPrefix(dsn, "postgres://") && !strings.HasPrefix(dsn, "postgresql://") {
+		return dsn + " search_path=" + schema
+	}
+	u, err := url.Parse(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := u.Query()
+	query.Set("search_path", schema)
+	u.RawQuery = query.Encode()
+	return u.String()
+}
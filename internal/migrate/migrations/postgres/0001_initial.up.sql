@@ -0,0 +1,35 @@
+-- The schema of the old db/schema.sql, except that hands are TEXT. IF NOT
+-- EXISTS lets a database created from that file run this migration; it keeps
+-- its hand enum until 0008_rule_sets. Every later column belongs to the
+-- migration that adds it, so reverting that migration and applying it again
+-- gives the same schema.
+
+CREATE TABLE IF NOT EXISTS players (
+    id INTEGER GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+    username TEXT NOT NULL UNIQUE
+);
+
+CREATE TABLE IF NOT EXISTS games (
+    id INTEGER GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+    total_rounds INTEGER NOT NULL DEFAULT 3,
+    current_round INTEGER DEFAULT 1,
+    player_one_id INTEGER REFERENCES players(id) ON DELETE CASCADE,
+    player_two_id INTEGER REFERENCES players(id) ON DELETE CASCADE,
+    player_one_score INTEGER DEFAULT 0,
+    player_two_score INTEGER DEFAULT 0,
+    winner INTEGER REFERENCES players(id),
+    finished BOOLEAN DEFAULT False,
+    created_at timestamptz DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS rounds (
+    id INTEGER GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+    game INTEGER REFERENCES games(id) ON DELETE CASCADE,
+    count INTEGER NOT NULL DEFAULT 1,
+    player_one_id INTEGER REFERENCES players(id),
+    player_two_id INTEGER REFERENCES players(id),
+    player_one_hand TEXT,
+    player_two_hand TEXT,
+    winner INTEGER REFERENCES players(id),
+    finished BOOLEAN DEFAULT False
+);
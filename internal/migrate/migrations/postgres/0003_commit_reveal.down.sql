@@ -0,0 +1,7 @@
+ALTER TABLE rounds
+    DROP COLUMN IF EXISTS player_one_commitment,
+    DROP COLUMN IF EXISTS player_two_commitment,
+    DROP COLUMN IF EXISTS player_one_nonce,
+    DROP COLUMN IF EXISTS player_two_nonce;
+
+ALTER TABLE games DROP COLUMN IF EXISTS commit_reveal;
@@ -0,0 +1,7 @@
+ALTER TABLE games ADD COLUMN IF NOT EXISTS commit_reveal BOOLEAN NOT NULL DEFAULT FALSE;
+
+ALTER TABLE rounds
+    ADD COLUMN IF NOT EXISTS player_one_commitment TEXT,
+    ADD COLUMN IF NOT EXISTS player_two_commitment TEXT,
+    ADD COLUMN IF NOT EXISTS player_one_nonce TEXT,
+    ADD COLUMN IF NOT EXISTS player_two_nonce TEXT;
@@ -0,0 +1,23 @@
+-- defaults match domain.DefaultPlayerRating
+ALTER TABLE players ADD COLUMN IF NOT EXISTS rating DOUBLE PRECISION NOT NULL DEFAULT 1500;
+ALTER TABLE players ADD COLUMN IF NOT EXISTS rating_deviation DOUBLE PRECISION NOT NULL DEFAULT 350;
+ALTER TABLE players ADD COLUMN IF NOT EXISTS rating_volatility DOUBLE PRECISION NOT NULL DEFAULT 0.06;
+
+-- one row per player per rated game
+CREATE TABLE IF NOT EXISTS rating_history (
+    id INTEGER GENERATED ALWAYS AS IDENTITY PRIMARY KEY,
+    player_id INTEGER NOT NULL REFERENCES players(id) ON DELETE CASCADE,
+    game_id INTEGER NOT NULL REFERENCES games(id) ON DELETE CASCADE,
+    opponent_id INTEGER NOT NULL REFERENCES players(id) ON DELETE CASCADE,
+    score DOUBLE PRECISION NOT NULL,
+    -- elo or glicko2
+    system TEXT NOT NULL,
+    rating_before DOUBLE PRECISION NOT NULL,
+    rating_deviation_before DOUBLE PRECISION NOT NULL,
+    rating_volatility_before DOUBLE PRECISION NOT NULL,
+    rating_after DOUBLE PRECISION NOT NULL,
+    rating_deviation_after DOUBLE PRECISION NOT NULL,
+    rating_volatility_after DOUBLE PRECISION NOT NULL,
+    created_at timestamptz DEFAULT NOW(),
+    UNIQUE (player_id, game_id)
+);
@@ -0,0 +1,25 @@
+-- rebuilt wholesale by LeaderboardRepository.Refresh; one row per player per
+-- window they finished a game in
+CREATE TABLE IF NOT EXISTS leaderboard (
+    time_window TEXT NOT NULL,
+    player_id INTEGER NOT NULL REFERENCES players(id) ON DELETE CASCADE,
+    rating DOUBLE PRECISION NOT NULL,
+    games_played INTEGER NOT NULL,
+    games_won INTEGER NOT NULL,
+    games_lost INTEGER NOT NULL,
+    games_drawn INTEGER NOT NULL,
+    win_rate DOUBLE PRECISION NOT NULL,
+    longest_win_streak INTEGER NOT NULL,
+    -- rank under each sort; win_rate_rank is NULL below the minimum games
+    rating_rank INTEGER NOT NULL,
+    wins_rank INTEGER NOT NULL,
+    win_rate_rank INTEGER,
+    streak_rank INTEGER NOT NULL,
+    refreshed_at timestamptz NOT NULL,
+    PRIMARY KEY (time_window, player_id)
+);
+
+CREATE INDEX IF NOT EXISTS leaderboard_rating_rank_idx ON leaderboard (time_window, rating_rank);
+CREATE INDEX IF NOT EXISTS leaderboard_wins_rank_idx ON leaderboard (time_window, wins_rank);
+CREATE INDEX IF NOT EXISTS leaderboard_win_rate_rank_idx ON leaderboard (time_window, win_rate_rank);
+CREATE INDEX IF NOT EXISTS leaderboard_streak_rank_idx ON leaderboard (time_window, streak_rank);
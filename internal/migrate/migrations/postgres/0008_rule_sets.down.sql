@@ -0,0 +1,4 @@
+-- hands stay TEXT: custom weapons do not fit the old hand enum
+ALTER TABLE games
+    DROP COLUMN rule_set,
+    DROP COLUMN weapons;
@@ -0,0 +1,15 @@
+-- Games name the rule set their hands are judged by, and a custom rule set
+-- lists its weapons.
+ALTER TABLE games
+    ADD COLUMN IF NOT EXISTS rule_set TEXT NOT NULL DEFAULT 'classic',
+    ADD COLUMN IF NOT EXISTS weapons TEXT NOT NULL DEFAULT 'rock,paper,scissors';
+
+-- Hands are validated against the game's rule set in the app, so rounds store
+-- them as plain text. Databases created from the old db/schema.sql still have
+-- the hand enum; an unplayed hand becomes NULL rather than 'none'. On TEXT
+-- columns this changes nothing.
+ALTER TABLE rounds
+    ALTER COLUMN player_one_hand TYPE TEXT USING NULLIF(player_one_hand::text, 'none'),
+    ALTER COLUMN player_two_hand TYPE TEXT USING NULLIF(player_two_hand::text, 'none');
+
+DROP TYPE IF EXISTS hand;
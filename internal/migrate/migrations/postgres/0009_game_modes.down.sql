@@ -0,0 +1,3 @@
+ALTER TABLE games
+    DROP COLUMN mode,
+    DROP COLUMN target_score;
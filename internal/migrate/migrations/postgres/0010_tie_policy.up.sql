@@ -0,0 +1,2 @@
+-- count, replay or sudden_death
+ALTER TABLE games ADD COLUMN tie_policy TEXT NOT NULL DEFAULT 'count';
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS rounds;
+DROP TABLE IF EXISTS games;
+DROP TABLE IF EXISTS players;
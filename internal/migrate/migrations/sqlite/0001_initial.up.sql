@@ -0,0 +1,29 @@
+CREATE TABLE IF NOT EXISTS players (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    username TEXT NOT NULL UNIQUE
+);
+
+CREATE TABLE IF NOT EXISTS games (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    total_rounds INTEGER NOT NULL DEFAULT 3,
+    current_round INTEGER DEFAULT 1,
+    player_one_id INTEGER REFERENCES players(id) ON DELETE CASCADE,
+    player_two_id INTEGER REFERENCES players(id) ON DELETE CASCADE,
+    player_one_score INTEGER DEFAULT 0,
+    player_two_score INTEGER DEFAULT 0,
+    winner INTEGER REFERENCES players(id),
+    finished BOOLEAN DEFAULT FALSE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS rounds (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    game INTEGER REFERENCES games(id) ON DELETE CASCADE,
+    count INTEGER NOT NULL DEFAULT 1,
+    player_one_id INTEGER REFERENCES players(id),
+    player_two_id INTEGER REFERENCES players(id),
+    player_one_hand TEXT,
+    player_two_hand TEXT,
+    winner INTEGER REFERENCES players(id),
+    finished BOOLEAN DEFAULT FALSE
+);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS players_token_hash_idx;
+
+ALTER TABLE players DROP COLUMN token_hash;
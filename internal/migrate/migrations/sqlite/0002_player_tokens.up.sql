@@ -0,0 +1,3 @@
+ALTER TABLE players ADD COLUMN token_hash TEXT;
+
+CREATE UNIQUE INDEX IF NOT EXISTS players_token_hash_idx ON players (token_hash);
@@ -0,0 +1,6 @@
+ALTER TABLE rounds DROP COLUMN player_one_commitment;
+ALTER TABLE rounds DROP COLUMN player_two_commitment;
+ALTER TABLE rounds DROP COLUMN player_one_nonce;
+ALTER TABLE rounds DROP COLUMN player_two_nonce;
+
+ALTER TABLE games DROP COLUMN commit_reveal;
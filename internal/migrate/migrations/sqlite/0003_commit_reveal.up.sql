@@ -0,0 +1,6 @@
+ALTER TABLE games ADD COLUMN commit_reveal BOOLEAN NOT NULL DEFAULT FALSE;
+
+ALTER TABLE rounds ADD COLUMN player_one_commitment TEXT;
+ALTER TABLE rounds ADD COLUMN player_two_commitment TEXT;
+ALTER TABLE rounds ADD COLUMN player_one_nonce TEXT;
+ALTER TABLE rounds ADD COLUMN player_two_nonce TEXT;
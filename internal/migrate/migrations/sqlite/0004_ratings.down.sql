@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS rating_history;
+
+ALTER TABLE players DROP COLUMN rating_volatility;
+ALTER TABLE players DROP COLUMN rating_deviation;
+ALTER TABLE players DROP COLUMN rating;
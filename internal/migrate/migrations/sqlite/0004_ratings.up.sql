@@ -0,0 +1,20 @@
+ALTER TABLE players ADD COLUMN rating REAL NOT NULL DEFAULT 1500;
+ALTER TABLE players ADD COLUMN rating_deviation REAL NOT NULL DEFAULT 350;
+ALTER TABLE players ADD COLUMN rating_volatility REAL NOT NULL DEFAULT 0.06;
+
+CREATE TABLE IF NOT EXISTS rating_history (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    player_id INTEGER NOT NULL REFERENCES players(id) ON DELETE CASCADE,
+    game_id INTEGER NOT NULL REFERENCES games(id) ON DELETE CASCADE,
+    opponent_id INTEGER NOT NULL REFERENCES players(id) ON DELETE CASCADE,
+    score REAL NOT NULL,
+    system TEXT NOT NULL,
+    rating_before REAL NOT NULL,
+    rating_deviation_before REAL NOT NULL,
+    rating_volatility_before REAL NOT NULL,
+    rating_after REAL NOT NULL,
+    rating_deviation_after REAL NOT NULL,
+    rating_volatility_after REAL NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (player_id, game_id)
+);
@@ -0,0 +1,17 @@
+-- every game event in the order it was recorded; seq numbers a game's events
+-- from 1 and is what SSE clients resume from with Last-Event-ID
+CREATE TABLE IF NOT EXISTS game_events (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    game_id INTEGER NOT NULL REFERENCES games(id) ON DELETE CASCADE,
+    seq INTEGER NOT NULL,
+    type TEXT NOT NULL,
+    player_one_id INTEGER NOT NULL REFERENCES players(id) ON DELETE CASCADE,
+    player_two_id INTEGER NOT NULL REFERENCES players(id) ON DELETE CASCADE,
+    -- the event as JSON
+    payload TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (game_id, seq)
+);
+
+CREATE INDEX IF NOT EXISTS game_events_player_one_idx ON game_events (player_one_id, id);
+CREATE INDEX IF NOT EXISTS game_events_player_two_idx ON game_events (player_two_id, id);
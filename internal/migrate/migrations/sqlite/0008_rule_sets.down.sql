@@ -0,0 +1,2 @@
+ALTER TABLE games DROP COLUMN rule_set;
+ALTER TABLE games DROP COLUMN weapons;
@@ -0,0 +1,4 @@
+-- Games name the rule set their hands are judged by, and a custom rule set
+-- lists its weapons. Hands have always been TEXT here.
+ALTER TABLE games ADD COLUMN rule_set TEXT NOT NULL DEFAULT 'classic';
+ALTER TABLE games ADD COLUMN weapons TEXT NOT NULL DEFAULT 'rock,paper,scissors';
@@ -0,0 +1,2 @@
+ALTER TABLE games DROP COLUMN mode;
+ALTER TABLE games DROP COLUMN target_score;
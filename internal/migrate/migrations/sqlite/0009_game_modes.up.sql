@@ -0,0 +1,7 @@
+-- best_of: stop once the trailing player cannot catch up within total_rounds
+-- first_to: play until someone reaches target_score (total_rounds is 0)
+ALTER TABLE games ADD COLUMN mode TEXT NOT NULL DEFAULT 'best_of';
+ALTER TABLE games ADD COLUMN target_score INTEGER NOT NULL DEFAULT 2;
+
+-- existing games were all best_of; as set by GameCreateRequest.Validate
+UPDATE games SET target_score = total_rounds / 2 + 1;
@@ -1,7 +1,5 @@
-ALTER SYSTEM SET log_statement = 'all';
-ALTER SYSTEM SET log_min_duration_statement = 0;
-ALTER SYSTEM SET log_error_verbosity = 'verbose';
-SELECT pg_reload_conf();
+-- db/schema.sql as it was before migrations, without its logging settings
+-- (now db/logging.sql). Databases created from it must still migrate.
 
 -- 1. Enums
 CREATE TYPE hand AS ENUM ('none','rock', 'paper', 'scissors');
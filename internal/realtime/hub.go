@@ -0,0 +1,105 @@
+// Package realtime fans game events out to the clients following a game or
+// a player.
+package realtime
+
+import (
+	"sync"
+
+	"github.com/ellisbywater/http-rock-paper-scissors/internal/domain"
+)
+
+// subscriptionBuffer is how many events a subscriber may fall behind before
+// it is dropped.
+const subscriptionBuffer = 32
+
+// topic is what a subscription follows: one game, or every game of one
+// player.
+type topic struct {
+	player bool
+	id     int
+}
+
+// Hub delivers each published event to every subscriber of its game and of
+// its players. It never blocks the publisher: a subscriber whose buffer is
+// full is dropped, and its channel closed, so it can reconnect and catch up
+// instead of silently missing events.
+type Hub struct {
+	mu   sync.Mutex
+	subs map[topic]map[*Subscription]struct{}
+}
+
+func NewHub() *Hub {
+	return &Hub{subs: make(map[topic]map[*Subscription]struct{})}
+}
+
+type Subscription struct {
+	hub    *Hub
+	topic  topic
+	events chan domain.GameEvent
+	closed bool
+}
+
+// Subscribe follows the game's events until the subscription is closed.
+func (h *Hub) Subscribe(gameID int) *Subscription {
+	return h.subscribe(topic{id: gameID})
+}
+
+// SubscribePlayer follows the events of every game the player is in until
+// the subscription is closed.
+func (h *Hub) SubscribePlayer(playerID int) *Subscription {
+	return h.subscribe(topic{player: true, id: playerID})
+}
+
+func (h *Hub) subscribe(t topic) *Subscription {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	sub := &Subscription{hub: h, topic: t, events: make(chan domain.GameEvent, subscriptionBuffer)}
+	if h.subs[t] == nil {
+		h.subs[t] = make(map[*Subscription]struct{})
+	}
+	h.subs[t][sub] = struct{}{}
+	return sub
+}
+
+// Events is closed when the subscription is closed or dropped.
+func (s *Subscription) Events() <-chan domain.GameEvent {
+	return s.events
+}
+
+func (s *Subscription) Close() {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+	s.hub.remove(s)
+}
+
+// remove unsubscribes s and closes its channel. Callers hold h.mu.
+func (h *Hub) remove(s *Subscription) {
+	if s.closed {
+		return
+	}
+	s.closed = true
+	close(s.events)
+	delete(h.subs[s.topic], s)
+	if len(h.subs[s.topic]) == 0 {
+		delete(h.subs, s.topic)
+	}
+}
+
+func (h *Hub) PublishGameEvent(event domain.GameEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	topics := []topic{
+		{id: event.GameID},
+		{player: true, id: event.PlayerOneID},
+		{player: true, id: event.PlayerTwoID},
+	}
+	for _, t := range topics {
+		for sub := range h.subs[t] {
+			select {
+			case sub.events <- event:
+			default:
+				h.remove(sub)
+			}
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package realtime
+
+import (
+	"context"
+	"time"
+
+	"github.com/ellisbywater/http-rock-paper-scissors/internal/domain"
+	"github.com/ellisbywater/http-rock-paper-scissors/internal/events"
+)
+
+// appendTimeout bounds how long recording an event may take.
+const appendTimeout = 5 * time.Second
+
+// Recorder turns bus events into the game events clients follow: it records
+// them in the event log, which numbers them, and then hands them to each
+// publisher (the hub, webhooks).
+type Recorder struct {
+	repo       domain.GameEventRepository
+	publishers []domain.GameEventPublisher
+}
+
+func NewRecorder(repo domain.GameEventRepository, publishers ...domain.GameEventPublisher) *Recorder {
+	return &Recorder{repo: repo, publishers: publishers}
+}
+
+// HandleEvent still publishes events it failed to record: live clients get
+// them, only resuming after them is lost. The move behind the event is
+// already committed, so recording does not stop when ctx, usually the
+// request's, is cancelled; it gets appendTimeout of its own instead.
+func (rec *Recorder) HandleEvent(ctx context.Context, event events.Event) error {
+	gameEvents := GameEvents(event)
+	if len(gameEvents) == 0 {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), appendTimeout)
+	defer cancel()
+	err := rec.repo.Append(ctx, gameEvents)
+	for _, publisher := range rec.publishers {
+		for _, gameEvent := range gameEvents {
+			publisher.PublishGameEvent(gameEvent)
+		}
+	}
+	return err
+}
+
+// GameEvents are the game events a bus event stands for, if any.
+func GameEvents(event events.Event) []domain.GameEvent {
+	var game domain.GameResponse
+	var gameEvents []domain.GameEvent
+	switch e := event.(type) {
+	case events.MatchFound:
+		game.ID, game.PlayerOneId, game.PlayerTwoId = e.Game.ID, e.Game.PlayerOneId, e.Game.PlayerTwoId
+		gameEvents = []domain.GameEvent{{Type: domain.EventMatchFound, Time: e.Time}}
+	case events.HandCommitted:
+		game = e.Game
+		gameEvents = []domain.GameEvent{{Type: domain.EventHandCommitted, RoundID: e.Round.ID, PlayerID: e.PlayerID, Time: e.Time}}
+	case events.HandPlayed:
+		game = e.Game
+		gameEvents = []domain.GameEvent{{Type: domain.EventHandPlayed, RoundID: e.Round.ID, PlayerID: e.PlayerID, Time: e.Time}}
+	case events.RoundResolved:
+		game = e.Game
+		round := e.Round
+		gameEvents = []domain.GameEvent{{Type: domain.EventRoundResolved, RoundID: round.ID, Round: &round, Time: e.Time}}
+		// a tied round leaves the score as it was
+		if round.Winner != 0 {
+			gameEvents = append(gameEvents, domain.GameEvent{Type: domain.EventScoreChanged, Score: scoreOf(game), Time: e.Time})
+		}
+	case events.GameFinished:
+		game = e.Game
+		gameEvents = []domain.GameEvent{{Type: domain.EventGameFinished, Score: scoreOf(game), Winner: game.Winner, Time: e.Time}}
+	default:
+		return nil
+	}
+	for i := range gameEvents {
+		gameEvents[i].GameID = game.ID
+		gameEvents[i].PlayerOneID = game.PlayerOneId
+		gameEvents[i].PlayerTwoID = game.PlayerTwoId
+	}
+	return gameEvents
+}
+
+func scoreOf(game domain.GameResponse) *domain.Score {
+	return &domain.Score{
+		PlayerOne: domain.PlayerScore{PlayerID: game.PlayerOneId, Score: game.PlayerOneScore},
+		PlayerTwo: domain.PlayerScore{PlayerID: game.PlayerTwoId, Score: game.PlayerTwoScore},
+	}
+}
@@ -0,0 +1,160 @@
+package realtime_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ellisbywater/http-rock-paper-scissors/internal/domain"
+	"github.com/ellisbywater/http-rock-paper-scissors/internal/events"
+	"github.com/ellisbywater/http-rock-paper-scissors/internal/realtime"
+	"github.com/ellisbywater/http-rock-paper-scissors/internal/repository/memory"
+)
+
+var now = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+func newGame() domain.GameResponse {
+	return domain.GameResponse{ID: 7, PlayerOneId: 1, PlayerTwoId: 2, CurrentRound: 1, TotalRounds: 1}
+}
+
+func TestGameEvents(t *testing.T) {
+	game := newGame()
+	round := domain.RoundContext{ID: 3, GameID: game.ID, PlayerOneID: 1, PlayerTwoID: 2, PlayerOneHand: domain.Paper, PlayerTwoHand: domain.Rock, Winner: 1, Finished: true}
+	tied := round
+	tied.PlayerOneHand, tied.Winner = domain.Rock, 0
+	won := game
+	won.PlayerOneScore, won.Finished, won.Winner = 1, true, 1
+	score := &domain.Score{
+		PlayerOne: domain.PlayerScore{PlayerID: 1, Score: 1},
+		PlayerTwo: domain.PlayerScore{PlayerID: 2, Score: 0},
+	}
+
+	tests := []struct {
+		name  string
+		event events.Event
+		want  []domain.GameEvent
+	}{
+		{"match found", events.MatchFound{Game: domain.GameCreateResponse{ID: 7, PlayerOneId: 1, PlayerTwoId: 2}, Time: now},
+			[]domain.GameEvent{{Type: domain.EventMatchFound}}},
+		{"hand committed", events.HandCommitted{Game: game, Round: round, PlayerID: 2, Time: now},
+			[]domain.GameEvent{{Type: domain.EventHandCommitted, RoundID: 3, PlayerID: 2}}},
+		{"hand played", events.HandPlayed{Game: game, Round: round, PlayerID: 1, Time: now},
+			[]domain.GameEvent{{Type: domain.EventHandPlayed, RoundID: 3, PlayerID: 1}}},
+		{"round won", events.RoundResolved{Game: won, Round: round, Time: now},
+			[]domain.GameEvent{{Type: domain.EventRoundResolved, RoundID: 3, Round: &round}, {Type: domain.EventScoreChanged, Score: score}}},
+		{"round tied", events.RoundResolved{Game: game, Round: tied, Time: now},
+			[]domain.GameEvent{{Type: domain.EventRoundResolved, RoundID: 3, Round: &tied}}},
+		{"game finished", events.GameFinished{Game: won, Time: now},
+			[]domain.GameEvent{{Type: domain.EventGameFinished, Score: score, Winner: 1}}},
+		{"not a game event", events.PlayerCreated{Time: now}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i := range tt.want {
+				tt.want[i].GameID, tt.want[i].PlayerOneID, tt.want[i].PlayerTwoID = 7, 1, 2
+				tt.want[i].Time = now
+			}
+			if got := realtime.GameEvents(tt.event); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("GameEvents() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+type publisher struct {
+	events []domain.GameEvent
+}
+
+func (p *publisher) PublishGameEvent(event domain.GameEvent) {
+	p.events = append(p.events, event)
+}
+
+func TestRecorderRecordsThenPublishes(t *testing.T) {
+	repo := memory.NewGameEventRepository(memory.New())
+	pub := &publisher{}
+	rec := realtime.NewRecorder(repo, pub)
+	ctx := context.Background()
+
+	game := newGame()
+	round := domain.RoundContext{ID: 3, GameID: game.ID, PlayerOneID: 1, PlayerTwoID: 2}
+	if err := rec.HandleEvent(ctx, events.HandPlayed{Game: game, Round: round, PlayerID: 1, Time: now}); err != nil {
+		t.Fatal(err)
+	}
+	round.PlayerOneHand, round.PlayerTwoHand, round.Winner, round.Finished = domain.Paper, domain.Rock, 1, true
+	game.PlayerOneScore, game.Finished, game.Winner = 1, true, 1
+	if err := rec.HandleEvent(ctx, events.RoundResolved{Game: game, Round: round, Time: now}); err != nil {
+		t.Fatal(err)
+	}
+	if err := rec.HandleEvent(ctx, events.GameFinished{Game: game, Time: now}); err != nil {
+		t.Fatal(err)
+	}
+
+	var recorded []domain.GameEvent
+	if err := repo.ListByGame(ctx, game.ID, 0, &recorded); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(pub.events, recorded) {
+		t.Fatalf("published %+v, recorded %+v", pub.events, recorded)
+	}
+	var types []string
+	for i, event := range pub.events {
+		if event.Seq != i+1 || event.ID == 0 {
+			t.Fatalf("event %d was published before it was numbered: %+v", i, event)
+		}
+		types = append(types, event.Type)
+	}
+	want := []string{domain.EventHandPlayed, domain.EventRoundResolved, domain.EventScoreChanged, domain.EventGameFinished}
+	if !reflect.DeepEqual(types, want) {
+		t.Fatalf("published %v, want %v", types, want)
+	}
+}
+
+type failingRepo struct {
+	domain.GameEventRepository
+}
+
+func (failingRepo) Append(ctx context.Context, events []domain.GameEvent) error {
+	return errors.New("boom")
+}
+
+func TestRecorderPublishesWhatItFailedToRecord(t *testing.T) {
+	pub := &publisher{}
+	rec := realtime.NewRecorder(failingRepo{}, pub)
+	game := newGame()
+	err := rec.HandleEvent(context.Background(), events.HandPlayed{Game: game, Round: domain.RoundContext{ID: 3}, PlayerID: 1, Time: now})
+	if err == nil {
+		t.Fatal("HandleEvent() error = nil, want the repository's")
+	}
+	if len(pub.events) != 1 || pub.events[0].Type != domain.EventHandPlayed {
+		t.Fatalf("published %+v, want the hand_played event", pub.events)
+	}
+}
+
+// contextRepo remembers the context events were appended with.
+type contextRepo struct {
+	domain.GameEventRepository
+	err         error
+	hasDeadline bool
+}
+
+func (repo *contextRepo) Append(ctx context.Context, events []domain.GameEvent) error {
+	_, repo.hasDeadline = ctx.Deadline()
+	repo.err = ctx.Err()
+	return nil
+}
+
+func TestRecorderOutlivesTheRequest(t *testing.T) {
+	repo := &contextRepo{}
+	rec := realtime.NewRecorder(repo)
+	ctx, cancel := context.WithCancel(context.Background())
+	// the client went away right after its move was committed
+	cancel()
+	if err := rec.HandleEvent(ctx, events.HandPlayed{Game: newGame(), Round: domain.RoundContext{ID: 3}, PlayerID: 1, Time: now}); err != nil {
+		t.Fatal(err)
+	}
+	if repo.err != nil || !repo.hasDeadline {
+		t.Fatalf("appended with ctx err = %v, deadline = %v; want a live context with a deadline", repo.err, repo.hasDeadline)
+	}
+}
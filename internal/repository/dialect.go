@@ -0,0 +1,147 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ellisbywater/http-rock-paper-scissors/internal/domain"
+	"github.com/lib/pq"
+)
+
+// Dialect is what differs between the databases the repositories run on.
+// Queries are written once, with ? placeholders, in SQL that Postgres and
+// SQLite both accept.
+type Dialect interface {
+	// Placeholder is the n-th (1 based) bind parameter.
+	Placeholder(n int) string
+	// ForUpdate ends the SELECTs that read rows a transaction is about to
+	// change, to lock them.
+	ForUpdate() string
+	// Timestamp is t as a bind argument compared with a timestamp column.
+	Timestamp(t time.Time) any
+	// SnapshotIsolation is the lowest isolation level at which every read in
+	// a transaction sees the same snapshot.
+	SnapshotIsolation() sql.IsolationLevel
+	// TranslateError maps violations of the constraints callers can break,
+	// such as a taken username, to domain errors. Any other error is passed
+	// through unchanged.
+	TranslateError(err error) error
+}
+
+// Postgres is the dialect of the lib/pq driver.
+var Postgres Dialect = postgres{}
+
+type postgres struct{}
+
+func (postgres) Placeholder(n int) string {
+	return "$" + strconv.Itoa(n)
+}
+
+func (postgres) ForUpdate() string {
+	return " FOR UPDATE"
+}
+
+func (postgres) Timestamp(t time.Time) any {
+	return t
+}
+
+func (postgres) SnapshotIsolation() sql.IsolationLevel {
+	return sql.LevelRepeatableRead
+}
+
+func (postgres) TranslateError(err error) error {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return err
+	}
+	switch pqErr.Constraint {
+	case "players_username_key":
+		return fmt.Errorf("%w: %s", domain.ErrUsernameTaken, pqErr.Detail)
+	}
+	return err
+}
+
+// dialectDB runs queries written with ? placeholders against db, numbering
+// the placeholders for dialect on the way in.
+type dialectDB struct {
+	db      *sql.DB
+	dialect Dialect
+}
+
+func (d dialectDB) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	return d.db.QueryContext(ctx, rebind(d.dialect, query), args...)
+}
+
+func (d dialectDB) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	return d.db.QueryRowContext(ctx, rebind(d.dialect, query), args...)
+}
+
+func (d dialectDB) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	return d.db.ExecContext(ctx, rebind(d.dialect, query), args...)
+}
+
+func (d dialectDB) BeginTx(ctx context.Context, opts *sql.TxOptions) (dialectTx, error) {
+	tx, err := d.db.BeginTx(ctx, opts)
+	return dialectTx{tx: tx, dialect: d.dialect}, err
+}
+
+// forUpdate ends a SELECT that locks the rows it reads, see Dialect.
+func (d dialectDB) forUpdate() string {
+	return d.dialect.ForUpdate()
+}
+
+// dialectTx is dialectDB for a transaction.
+type dialectTx struct {
+	tx      *sql.Tx
+	dialect Dialect
+}
+
+func (t dialectTx) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	return t.tx.QueryContext(ctx, rebind(t.dialect, query), args...)
+}
+
+func (t dialectTx) QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row {
+	return t.tx.QueryRowContext(ctx, rebind(t.dialect, query), args...)
+}
+
+func (t dialectTx) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	return t.tx.ExecContext(ctx, rebind(t.dialect, query), args...)
+}
+
+func (t dialectTx) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	return t.tx.PrepareContext(ctx, rebind(t.dialect, query))
+}
+
+func (t dialectTx) Commit() error {
+	return t.tx.Commit()
+}
+
+func (t dialectTx) Rollback() error {
+	return t.tx.Rollback()
+}
+
+// rebind replaces each ? in query with the dialect's placeholder. Queries
+// never contain a literal ?; values always go in as arguments.
+func rebind(dialect Dialect, query string) string {
+	if dialect.Placeholder(1) == "?" {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for {
+		i := strings.IndexByte(query, '?')
+		if i < 0 {
+			b.WriteString(query)
+			return b.String()
+		}
+		n++
+		b.WriteString(query[:i])
+		b.WriteString(dialect.Placeholder(n))
+		query = query[i+1:]
+	}
+}
@@ -0,0 +1,20 @@
+package repository
+
+import "testing"
+
+func TestRebind(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"SELECT 1", "SELECT 1"},
+		{"SELECT id FROM games WHERE id = ?", "SELECT id FROM games WHERE id = $1"},
+		{"(player_one_id = ? OR player_two_id = ?) AND id > ? LIMIT ?", "(player_one_id = $1 OR player_two_id = $2) AND id > $3 LIMIT $4"},
+		{"VALUES (?,?)", "VALUES ($1,$2)"},
+	}
+	for _, tt := range tests {
+		if got := rebind(Postgres, tt.query); got != tt.want {
+			t.Errorf("rebind(%q) = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+}
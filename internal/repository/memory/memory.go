@@ -0,0 +1,661 @@
+// Package memory keeps players, games and rounds in process memory. It is
+// meant for tests and throwaway demo servers; everything is lost on exit.
+package memory
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ellisbywater/http-rock-paper-scissors/internal/domain"
+)
+
+// Store is the shared state behind the repositories. A single mutex guards
+// everything, which also gives Update the same all-or-nothing behaviour as a
+// database transaction.
+type Store struct {
+	mu      sync.Mutex
+	players map[int]domain.PlayerResponse
+	games   map[int]domain.GameResponse
+	rounds  map[int]domain.RoundContext
+	// tokens maps a player's token hash to their id
+	tokens map[string]int
+	// ratings is the rating history of every player, oldest first
+	ratings []domain.RatingChange
+	// leaderboard holds the entries of each window as of the last Refresh
+	leaderboard map[string][]domain.LeaderboardEntry
+	// events is every game event in ID order; eventSeqs the last seq per game
+	events    []domain.GameEvent
+	eventSeqs map[int]int
+	// webhooks by id; deliveries in id order, each with its history
+	webhooks   map[int]domain.Webhook
+	deliveries []domain.WebhookDelivery
+
+	nextPlayerID   int
+	nextGameID     int
+	nextRoundID    int
+	nextWebhookID  int
+	nextDeliveryID int
+}
+
+func New() *Store {
+	return &Store{
+		players:     make(map[int]domain.PlayerResponse),
+		games:       make(map[int]domain.GameResponse),
+		rounds:      make(map[int]domain.RoundContext),
+		tokens:      make(map[string]int),
+		leaderboard: make(map[string][]domain.LeaderboardEntry),
+		eventSeqs:   make(map[int]int),
+		webhooks:    make(map[int]domain.Webhook),
+	}
+}
+
+func copyGame(g domain.GameResponse) domain.GameResponse {
+	g.Weapons = append(domain.Weapons(nil), g.Weapons...)
+	g.Rounds = nil
+	return g
+}
+
+type playerRepository struct {
+	store *Store
+}
+
+func NewPlayerRepository(store *Store) domain.PlayerRepository {
+	return &playerRepository{store}
+}
+
+func (pr *playerRepository) Create(ctx context.Context, player domain.PlayerCreateRequest, res *domain.PlayerResponse) error {
+	s := pr.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, p := range s.players {
+		if p.UserName == player.UserName {
+			return fmt.Errorf("%w: %q", domain.ErrUsernameTaken, player.UserName)
+		}
+	}
+	// mirror the unique index on the SQL backends
+	if _, ok := s.tokens[player.TokenHash]; ok && player.TokenHash != "" {
+		return errors.New("token hash already in use")
+	}
+	s.nextPlayerID++
+	p := domain.PlayerResponse{ID: s.nextPlayerID, UserName: player.UserName, Rating: domain.DefaultPlayerRating()}
+	s.players[p.ID] = p
+	if player.TokenHash != "" {
+		s.tokens[player.TokenHash] = p.ID
+	}
+	*res = p
+	return nil
+}
+
+func (pr *playerRepository) Get(ctx context.Context, id int, res *domain.PlayerResponse) error {
+	s := pr.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.players[id]
+	if !ok {
+		return domain.NotFound(domain.ErrPlayerNotFound, id)
+	}
+	*res = p
+	return nil
+}
+
+func (pr *playerRepository) GetByTokenHash(ctx context.Context, hash string, res *domain.PlayerResponse) error {
+	s := pr.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id, ok := s.tokens[hash]
+	if !ok {
+		return domain.ErrPlayerNotFound
+	}
+	*res = s.players[id]
+	return nil
+}
+
+func (pr *playerRepository) List(ctx context.Context, filter domain.PlayerFilter, res *[]domain.PlayerResponse) error {
+	s := pr.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id := 1
+	if filter.After != nil {
+		id = filter.After.ID + 1
+	}
+	for n := 0; id <= s.nextPlayerID && n < filter.Limit; id++ {
+		if p, ok := s.players[id]; ok {
+			*res = append(*res, p)
+			n++
+		}
+	}
+	return nil
+}
+
+func (pr *playerRepository) GetStats(ctx context.Context, id int, opponentID int, res *domain.PlayerStats) error {
+	s := pr.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	*res = domain.PlayerStats{PlayerID: id, OpponentID: opponentID}
+	filter := domain.GameFilter{PlayerID: id, OpponentID: opponentID}
+	for _, g := range s.sortedGames() {
+		if filter.Matches(&g) {
+			res.AddGame(g.Finished, g.Winner)
+		}
+	}
+	for roundID := 1; roundID <= s.nextRoundID; roundID++ {
+		r, ok := s.rounds[roundID]
+		if !ok || !r.Finished {
+			continue
+		}
+		var hand domain.Hand
+		var opponent int
+		switch id {
+		case r.PlayerOneID:
+			hand, opponent = r.PlayerOneHand, r.PlayerTwoID
+		case r.PlayerTwoID:
+			hand, opponent = r.PlayerTwoHand, r.PlayerOneID
+		default:
+			continue
+		}
+		if opponentID != 0 && opponent != opponentID {
+			continue
+		}
+		won, tied := 0, 0
+		if r.Winner == id {
+			won = 1
+		} else if r.Winner == 0 {
+			tied = 1
+		}
+		res.AddHand(hand, 1, won, tied)
+	}
+	res.Summarize()
+	return nil
+}
+
+func (pr *playerRepository) ListRatingHistory(ctx context.Context, id int, res *[]domain.RatingChange) error {
+	s := pr.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, change := range s.ratings {
+		if change.PlayerID == id {
+			*res = append(*res, change)
+		}
+	}
+	return nil
+}
+
+type gameRepository struct {
+	store *Store
+}
+
+func NewGameRepository(store *Store) domain.GameRepository {
+	return &gameRepository{store}
+}
+
+func (gr *gameRepository) Create(ctx context.Context, game domain.GameCreateRequest, res *domain.GameCreateResponse) error {
+	s := gr.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// mirror the foreign keys on the SQL backends
+	if _, ok := s.players[game.PlayerOneID]; !ok {
+		return domain.NotFound(domain.ErrPlayerNotFound, game.PlayerOneID)
+	}
+	if _, ok := s.players[game.PlayerTwoID]; !ok {
+		return domain.NotFound(domain.ErrPlayerNotFound, game.PlayerTwoID)
+	}
+	s.nextGameID++
+	g := domain.GameResponse{
+		ID:           s.nextGameID,
+		TotalRounds:  game.TotalRounds,
+		CurrentRound: 1,
+		PlayerOneId:  game.PlayerOneID,
+		PlayerTwoId:  game.PlayerTwoID,
+		Mode:         game.Mode,
+		TargetScore:  game.TargetScore,
+		TiePolicy:    game.TiePolicy,
+		RuleSet:      game.RuleSet,
+		Weapons:      append(domain.Weapons(nil), game.Weapons...),
+		CommitReveal: game.CommitReveal,
+		CreatedAt:    time.Now().UTC(),
+	}
+	s.games[g.ID] = g
+	*res = domain.GameCreateResponse{
+		ID:           g.ID,
+		TotalRounds:  g.TotalRounds,
+		CurrentRound: g.CurrentRound,
+		PlayerOneId:  g.PlayerOneId,
+		PlayerTwoId:  g.PlayerTwoId,
+		Mode:         g.Mode,
+		TargetScore:  g.TargetScore,
+		TiePolicy:    g.TiePolicy,
+		RuleSet:      g.RuleSet,
+		Weapons:      append(domain.Weapons(nil), g.Weapons...),
+		CommitReveal: g.CommitReveal,
+		CreatedAt:    g.CreatedAt,
+	}
+	return nil
+}
+
+func (gr *gameRepository) Get(ctx context.Context, id int, res *domain.GameResponse) error {
+	s := gr.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	g, ok := s.games[id]
+	if !ok {
+		return domain.NotFound(domain.ErrGameNotFound, id)
+	}
+	*res = copyGame(g)
+	res.Rounds = s.roundsOf(id)
+	return nil
+}
+
+func (gr *gameRepository) List(ctx context.Context, filter domain.GameFilter, res *[]domain.GameResponse) error {
+	s := gr.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for _, g := range s.sortedGames() {
+		if n == filter.Limit {
+			break
+		}
+		if filter.Matches(&g) {
+			*res = append(*res, copyGame(g))
+			n++
+		}
+	}
+	return nil
+}
+
+// sortedGames returns every game ordered by created_at then id, the order the
+// SQL backends list them in. Callers hold s.mu.
+func (s *Store) sortedGames() []domain.GameResponse {
+	games := make([]domain.GameResponse, 0, len(s.games))
+	for _, g := range s.games {
+		games = append(games, g)
+	}
+	sort.Slice(games, func(i, j int) bool {
+		if !games[i].CreatedAt.Equal(games[j].CreatedAt) {
+			return games[i].CreatedAt.Before(games[j].CreatedAt)
+		}
+		return games[i].ID < games[j].ID
+	})
+	return games
+}
+
+// roundsOf returns the game's rounds in creation order. Callers hold s.mu.
+func (s *Store) roundsOf(gameID int) []domain.RoundContext {
+	rounds := []domain.RoundContext{}
+	for roundID := 1; roundID <= s.nextRoundID; roundID++ {
+		if r, ok := s.rounds[roundID]; ok && r.GameID == gameID {
+			rounds = append(rounds, r)
+		}
+	}
+	return rounds
+}
+
+type roundRepository struct {
+	store *Store
+}
+
+func NewRoundRepository(store *Store) domain.RoundRepository {
+	return &roundRepository{store}
+}
+
+func (rr *roundRepository) Get(ctx context.Context, id int, res *domain.RoundContext) error {
+	s := rr.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, ok := s.rounds[id]
+	if !ok {
+		return domain.NotFound(domain.ErrRoundNotFound, id)
+	}
+	*res = r
+	return nil
+}
+
+func (rr *roundRepository) ListByGame(ctx context.Context, gameID int, res *[]domain.RoundContext) error {
+	s := rr.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.games[gameID]; !ok {
+		return domain.NotFound(domain.ErrGameNotFound, gameID)
+	}
+	*res = append(*res, s.roundsOf(gameID)...)
+	return nil
+}
+
+func (rr *roundRepository) Create(ctx context.Context, res *domain.RoundContext) error {
+	s := rr.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	g, ok := s.games[res.GameID]
+	if !ok {
+		return domain.NotFound(domain.ErrGameNotFound, res.GameID)
+	}
+	if g.Finished {
+		return domain.ErrGameFinished
+	}
+	s.nextRoundID++
+	r := domain.RoundContext{
+		ID:          s.nextRoundID,
+		GameID:      g.ID,
+		Count:       g.CurrentRound,
+		PlayerOneID: g.PlayerOneId,
+		PlayerTwoID: g.PlayerTwoId,
+	}
+	s.rounds[r.ID] = r
+	*res = r
+	return nil
+}
+
+func (rr *roundRepository) Update(ctx context.Context, gameID int, roundID int, fn func(game *domain.GameResponse, round *domain.RoundContext) error) error {
+	s := rr.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	g, ok := s.games[gameID]
+	if !ok {
+		return domain.NotFound(domain.ErrGameNotFound, gameID)
+	}
+	r, ok := s.rounds[roundID]
+	if !ok || r.GameID != gameID {
+		return domain.NotFound(domain.ErrRoundNotFound, roundID)
+	}
+
+	// work on copies so a failed fn leaves the store untouched
+	game := copyGame(g)
+	game.Ratings.PlayerOne = s.players[g.PlayerOneId].Rating
+	game.Ratings.PlayerTwo = s.players[g.PlayerTwoId].Rating
+	before := game.Ratings
+	round := r
+	if err := fn(&game, &round); err != nil {
+		return err
+	}
+
+	// only persist the columns the SQL backends write back
+	r.PlayerOneHand = round.PlayerOneHand
+	r.PlayerTwoHand = round.PlayerTwoHand
+	r.Winner = round.Winner
+	r.Finished = round.Finished
+	r.PlayerOneCommitment = round.PlayerOneCommitment
+	r.PlayerTwoCommitment = round.PlayerTwoCommitment
+	r.PlayerOneNonce = round.PlayerOneNonce
+	r.PlayerTwoNonce = round.PlayerTwoNonce
+	s.rounds[r.ID] = r
+
+	if game.Finished && !g.Finished && game.Ratings.System != "" {
+		now := time.Now().UTC()
+		for _, change := range domain.RatingChanges(&game, before) {
+			p := s.players[change.PlayerID]
+			p.Rating = change.After
+			s.players[p.ID] = p
+			change.CreatedAt = now
+			s.ratings = append(s.ratings, change)
+		}
+	}
+
+	g.CurrentRound = game.CurrentRound
+	g.TotalRounds = game.TotalRounds
+	g.PlayerOneScore = game.PlayerOneScore
+	g.PlayerTwoScore = game.PlayerTwoScore
+	g.Finished = game.Finished
+	g.Winner = game.Winner
+	s.games[g.ID] = g
+	return nil
+}
+
+type leaderboardRepository struct {
+	store *Store
+}
+
+func NewLeaderboardRepository(store *Store) domain.LeaderboardRepository {
+	return &leaderboardRepository{store}
+}
+
+func (lr *leaderboardRepository) Refresh(ctx context.Context, now time.Time, minGames int) error {
+	s := lr.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	players := make([]domain.PlayerResponse, 0, len(s.players))
+	for _, p := range s.players {
+		players = append(players, p)
+	}
+	games := s.sortedGames()
+	for window, span := range domain.LeaderboardWindows {
+		var since time.Time
+		if span != 0 {
+			since = now.Add(-span)
+		}
+		s.leaderboard[window] = domain.BuildLeaderboard(window, since, games, players, minGames, now)
+	}
+	return nil
+}
+
+func (lr *leaderboardRepository) List(ctx context.Context, filter domain.LeaderboardFilter, res *[]domain.LeaderboardEntry) error {
+	s := lr.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	after := 0
+	if filter.After != nil {
+		after = filter.After.ID
+	}
+	var entries []domain.LeaderboardEntry
+	for _, e := range s.leaderboard[filter.Window] {
+		if rank := e.SortRank(filter.Sort); rank > after {
+			e.Rank = rank
+			entries = append(entries, e)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Rank < entries[j].Rank })
+	if len(entries) > filter.Limit {
+		entries = entries[:filter.Limit]
+	}
+	*res = append(*res, entries...)
+	return nil
+}
+
+type gameEventRepository struct {
+	store *Store
+}
+
+func NewGameEventRepository(store *Store) domain.GameEventRepository {
+	return &gameEventRepository{store}
+}
+
+func (er *gameEventRepository) Append(ctx context.Context, events []domain.GameEvent) error {
+	s := er.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range events {
+		s.eventSeqs[events[i].GameID]++
+		events[i].Seq = s.eventSeqs[events[i].GameID]
+		events[i].ID = len(s.events) + 1
+		s.events = append(s.events, events[i])
+	}
+	return nil
+}
+
+func (er *gameEventRepository) ListByGame(ctx context.Context, gameID int, afterSeq int, res *[]domain.GameEvent) error {
+	s := er.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, event := range s.events {
+		if event.GameID == gameID && event.Seq > afterSeq {
+			*res = append(*res, event)
+		}
+	}
+	return nil
+}
+
+func (er *gameEventRepository) ListByPlayer(ctx context.Context, playerID int, afterID int, res *[]domain.GameEvent) error {
+	s := er.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, event := range s.events {
+		if (event.PlayerOneID == playerID || event.PlayerTwoID == playerID) && event.ID > afterID {
+			*res = append(*res, event)
+		}
+	}
+	return nil
+}
+
+type webhookRepository struct {
+	store *Store
+}
+
+func NewWebhookRepository(store *Store) domain.WebhookRepository {
+	return &webhookRepository{store}
+}
+
+func copyWebhook(w domain.Webhook) domain.Webhook {
+	w.Events = append(domain.WebhookEvents{}, w.Events...)
+	return w
+}
+
+func copyDelivery(d domain.WebhookDelivery) domain.WebhookDelivery {
+	d.History = append([]domain.WebhookAttempt{}, d.History...)
+	return d
+}
+
+func (wr *webhookRepository) Create(ctx context.Context, req domain.WebhookCreateRequest, res *domain.Webhook) error {
+	s := wr.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.players[req.PlayerID]; !ok {
+		return domain.NotFound(domain.ErrPlayerNotFound, req.PlayerID)
+	}
+	s.nextWebhookID++
+	webhook := domain.Webhook{
+		ID:        s.nextWebhookID,
+		PlayerID:  req.PlayerID,
+		URL:       req.URL,
+		Events:    req.Events,
+		Secret:    req.Secret,
+		CreatedAt: time.Now().UTC(),
+	}
+	s.webhooks[webhook.ID] = copyWebhook(webhook)
+	*res = copyWebhook(webhook)
+	return nil
+}
+
+func (wr *webhookRepository) Get(ctx context.Context, id int, res *domain.Webhook) error {
+	s := wr.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	webhook, ok := s.webhooks[id]
+	if !ok {
+		return domain.NotFound(domain.ErrWebhookNotFound, id)
+	}
+	*res = copyWebhook(webhook)
+	return nil
+}
+
+func (wr *webhookRepository) ListByPlayer(ctx context.Context, playerID int, res *[]domain.Webhook) error {
+	s := wr.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id := 1; id <= s.nextWebhookID; id++ {
+		if webhook, ok := s.webhooks[id]; ok && webhook.PlayerID == playerID {
+			*res = append(*res, copyWebhook(webhook))
+		}
+	}
+	return nil
+}
+
+func (wr *webhookRepository) Delete(ctx context.Context, id int) error {
+	s := wr.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.webhooks[id]; !ok {
+		return domain.NotFound(domain.ErrWebhookNotFound, id)
+	}
+	delete(s.webhooks, id)
+	kept := s.deliveries[:0]
+	for _, delivery := range s.deliveries {
+		if delivery.WebhookID != id {
+			kept = append(kept, delivery)
+		}
+	}
+	s.deliveries = kept
+	return nil
+}
+
+func (wr *webhookRepository) Enqueue(ctx context.Context, event domain.GameEvent, now time.Time) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	s := wr.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id := 1; id <= s.nextWebhookID; id++ {
+		webhook, ok := s.webhooks[id]
+		if !ok || (webhook.PlayerID != event.PlayerOneID && webhook.PlayerID != event.PlayerTwoID) || !webhook.Wants(event.Type) {
+			continue
+		}
+		s.nextDeliveryID++
+		s.deliveries = append(s.deliveries, domain.WebhookDelivery{
+			ID:            s.nextDeliveryID,
+			WebhookID:     webhook.ID,
+			EventID:       event.ID,
+			EventType:     event.Type,
+			Payload:       payload,
+			Status:        domain.DeliveryPending,
+			NextAttemptAt: now,
+			CreatedAt:     now,
+		})
+	}
+	return nil
+}
+
+func (wr *webhookRepository) ListDue(ctx context.Context, now time.Time, limit int, res *[]domain.WebhookDelivery) error {
+	s := wr.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var due []domain.WebhookDelivery
+	for _, delivery := range s.deliveries {
+		if delivery.Status == domain.DeliveryPending && !delivery.NextAttemptAt.After(now) {
+			delivery.History = nil
+			due = append(due, delivery)
+		}
+	}
+	sort.SliceStable(due, func(i, j int) bool { return due[i].NextAttemptAt.Before(due[j].NextAttemptAt) })
+	if len(due) > limit {
+		due = due[:limit]
+	}
+	*res = append(*res, due...)
+	return nil
+}
+
+func (wr *webhookRepository) RecordAttempt(ctx context.Context, delivery domain.WebhookDelivery, attempt domain.WebhookAttempt) error {
+	s := wr.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.deliveries {
+		if s.deliveries[i].ID == delivery.ID {
+			saved := &s.deliveries[i]
+			saved.Status = delivery.Status
+			saved.Attempts = delivery.Attempts
+			saved.NextAttemptAt = delivery.NextAttemptAt
+			saved.History = append(saved.History, attempt)
+			return nil
+		}
+	}
+	return nil
+}
+
+func (wr *webhookRepository) ListDeliveries(ctx context.Context, webhookID int, filter domain.WebhookDeliveryFilter, res *[]domain.WebhookDelivery) error {
+	s := wr.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	count := 0
+	for i := len(s.deliveries) - 1; i >= 0 && count < filter.Limit; i-- {
+		delivery := s.deliveries[i]
+		if delivery.WebhookID != webhookID || (filter.After != nil && delivery.ID >= filter.After.ID) {
+			continue
+		}
+		*res = append(*res, copyDelivery(delivery))
+		count++
+	}
+	return nil
+}
@@ -0,0 +1,22 @@
+package memory_test
+
+import (
+	"testing"
+
+	"github.com/ellisbywater/http-rock-paper-scissors/internal/repository/memory"
+	"github.com/ellisbywater/http-rock-paper-scissors/internal/repository/repositorytest"
+)
+
+func TestRepositories(t *testing.T) {
+	repositorytest.Run(t, func(t *testing.T) repositorytest.Repositories {
+		store := memory.New()
+		return repositorytest.Repositories{
+			Players:     memory.NewPlayerRepository(store),
+			Games:       memory.NewGameRepository(store),
+			Rounds:      memory.NewRoundRepository(store),
+			Leaderboard: memory.NewLeaderboardRepository(store),
+			Events:      memory.NewGameEventRepository(store),
+			Webhooks:    memory.NewWebhookRepository(store),
+		}
+	})
+}
@@ -1,36 +1,122 @@
+// Package repository stores players, games and rounds in SQL. The same
+// repositories run on Postgres and, through package sqlite, on SQLite; see
+// Dialect for what differs between the two.
 package repository
 
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
-	"fmt"
+	"strings"
+	"time"
 
 	"github.com/ellisbywater/http-rock-paper-scissors/internal/domain"
 )
 
+// gameColumns is the column list scanGame expects, in order.
+const gameColumns = `id, total_rounds, current_round, player_one_id, player_two_id, player_one_score, player_two_score,
+	COALESCE(winner, 0), COALESCE(finished, False), mode, target_score, tie_policy, rule_set, weapons, commit_reveal, created_at`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanGame(row rowScanner, game *domain.GameResponse) error {
+	return row.Scan(
+		&game.ID,
+		&game.TotalRounds,
+		&game.CurrentRound,
+		&game.PlayerOneId,
+		&game.PlayerTwoId,
+		&game.PlayerOneScore,
+		&game.PlayerTwoScore,
+		&game.Winner,
+		&game.Finished,
+		&game.Mode,
+		&game.TargetScore,
+		&game.TiePolicy,
+		&game.RuleSet,
+		&game.Weapons,
+		&game.CommitReveal,
+		&game.CreatedAt,
+	)
+}
+
+// roundColumns is the column list scanRound expects, in order.
+const roundColumns = `id, game, count, player_one_id, player_two_id, player_one_hand, player_two_hand,
+	COALESCE(winner, 0), COALESCE(finished, False),
+	COALESCE(player_one_commitment, ''), COALESCE(player_two_commitment, ''),
+	COALESCE(player_one_nonce, ''), COALESCE(player_two_nonce, '')`
+
+func scanRound(row rowScanner, round *domain.RoundContext) error {
+	return row.Scan(
+		&round.ID,
+		&round.GameID,
+		&round.Count,
+		&round.PlayerOneID,
+		&round.PlayerTwoID,
+		&round.PlayerOneHand,
+		&round.PlayerTwoHand,
+		&round.Winner,
+		&round.Finished,
+		&round.PlayerOneCommitment,
+		&round.PlayerTwoCommitment,
+		&round.PlayerOneNonce,
+		&round.PlayerTwoNonce,
+	)
+}
+
+// playerColumns is the column list scanPlayer expects, in order.
+const playerColumns = `id, username, rating, rating_deviation, rating_volatility`
+
+func scanPlayer(row rowScanner, player *domain.PlayerResponse) error {
+	return row.Scan(
+		&player.ID,
+		&player.UserName,
+		&player.Rating.Rating,
+		&player.Rating.Deviation,
+		&player.Rating.Volatility,
+	)
+}
+
 type gameRepository struct {
-	db *sql.DB
+	db dialectDB
 }
 
-func NewGameRepository(db *sql.DB) domain.GameRepository {
-	return &gameRepository{db}
+func NewGameRepository(db *sql.DB, dialect Dialect) domain.GameRepository {
+	return &gameRepository{dialectDB{db, dialect}}
 }
 
 func (gr *gameRepository) Create(ctx context.Context, game domain.GameCreateRequest, res *domain.GameCreateResponse) error {
+	if err := playersExist(ctx, gr.db, game.PlayerOneID, game.PlayerTwoID); err != nil {
+		return err
+	}
 	query := `
 		INSERT INTO games (
 			total_rounds,
 			current_round,
 			player_one_id,
-			player_two_id
+			player_two_id,
+			mode,
+			target_score,
+			tie_policy,
+			rule_set,
+			weapons,
+			commit_reveal
 		) Values (
-		 	$1,
+		 	?,
 			1,
-			$2,
-			$3
+			?,
+			?,
+			?,
+			?,
+			?,
+			?,
+			?,
+			?
 		 )
-		RETURNING id, total_rounds, current_round, created_at, player_one_id, player_two_id;
+		RETURNING id, total_rounds, current_round, created_at, player_one_id, player_two_id, mode, target_score, tie_policy, rule_set, weapons, commit_reveal;
 	`
 	err := gr.db.QueryRowContext(
 		ctx,
@@ -38,137 +124,307 @@ func (gr *gameRepository) Create(ctx context.Context, game domain.GameCreateRequ
 		game.TotalRounds,
 		game.PlayerOneID,
 		game.PlayerTwoID,
-	).Scan(&res.ID, &res.TotalRounds, &res.CurrentRound, &res.CreatedAt, &res.PlayerOneId, &res.PlayerTwoId)
+		game.Mode,
+		game.TargetScore,
+		game.TiePolicy,
+		game.RuleSet,
+		game.Weapons,
+		game.CommitReveal,
+	).Scan(&res.ID, &res.TotalRounds, &res.CurrentRound, &res.CreatedAt, &res.PlayerOneId, &res.PlayerTwoId, &res.Mode, &res.TargetScore, &res.TiePolicy, &res.RuleSet, &res.Weapons, &res.CommitReveal)
 
 	if err != nil {
-		return err
+		return gr.db.dialect.TranslateError(err)
 	}
 	return nil
 }
 
 func (gr *gameRepository) Get(ctx context.Context, id int, res *domain.GameResponse) error {
-	// TODO: update query to join rounds
-	query := `
-		SELECT id, total_rounds, current_round, player_one_id, player_two_id, COALESCE(winner, 0), created_at
-		FROM games
-		WHERE id = $1;
-	`
-	err := gr.db.QueryRowContext(ctx, query, id).Scan(
-		&res.ID,
-		&res.TotalRounds,
-		&res.CurrentRound,
-		&res.PlayerOneId,
-		&res.PlayerTwoId,
-		&res.Winner,
-		&res.CreatedAt,
-	)
+	query := `SELECT ` + gameColumns + ` FROM games WHERE id = ?;`
+	err := scanGame(gr.db.QueryRowContext(ctx, query, id), res)
+	if err != nil {
+		return notFound(err, domain.ErrGameNotFound, id)
+	}
+	res.Rounds = []domain.RoundContext{}
+	return listRounds(ctx, gr.db, id, &res.Rounds)
+}
+
+func (gr *gameRepository) List(ctx context.Context, filter domain.GameFilter, res *[]domain.GameResponse) error {
+	var where whereBuilder
+	if filter.PlayerID != 0 {
+		where.add("(player_one_id = ? OR player_two_id = ?)", filter.PlayerID, filter.PlayerID)
+	}
+	if filter.OpponentID != 0 {
+		where.add("(player_one_id = ? OR player_two_id = ?)", filter.OpponentID, filter.OpponentID)
+	}
+	switch filter.Status {
+	case domain.GameStatusFinished:
+		where.add("COALESCE(finished, FALSE) = TRUE")
+	case domain.GameStatusInProgress:
+		where.add("COALESCE(finished, FALSE) = FALSE")
+	}
+	switch filter.Result {
+	case domain.GameResultWon:
+		where.add("winner = ?", filter.PlayerID)
+	case domain.GameResultLost:
+		where.add("winner IS NOT NULL AND winner <> ?", filter.PlayerID)
+	}
+	if !filter.CreatedFrom.IsZero() {
+		where.add("created_at >= ?", gr.db.dialect.Timestamp(filter.CreatedFrom))
+	}
+	if !filter.CreatedTo.IsZero() {
+		where.add("created_at < ?", gr.db.dialect.Timestamp(filter.CreatedTo))
+	}
+	if filter.After != nil {
+		after := gr.db.dialect.Timestamp(filter.After.CreatedAt)
+		where.add("(created_at > ? OR (created_at = ? AND id > ?))", after, after, filter.After.ID)
+	}
+	query := `SELECT ` + gameColumns + ` FROM games` + where.String() + ` ORDER BY created_at, id LIMIT ` + where.arg(filter.Limit)
+	rows, err := gr.db.QueryContext(ctx, query, where.args...)
 	if err != nil {
 		return err
 	}
-	return nil
+	defer rows.Close()
+	for rows.Next() {
+		var game domain.GameResponse
+		if err := scanGame(rows, &game); err != nil {
+			return err
+		}
+		*res = append(*res, game)
+	}
+	return rows.Err()
+}
+
+// whereBuilder collects the conditions of a list query and their arguments.
+type whereBuilder struct {
+	conds []string
+	args  []any
+}
+
+func (wb *whereBuilder) add(cond string, args ...any) {
+	wb.conds = append(wb.conds, cond)
+	wb.args = append(wb.args, args...)
+}
+
+// arg adds a bind argument and returns its placeholder.
+func (wb *whereBuilder) arg(a any) string {
+	wb.args = append(wb.args, a)
+	return "?"
+}
+
+func (wb *whereBuilder) String() string {
+	if len(wb.conds) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(wb.conds, " AND ")
+}
+
+// listRounds appends the game's rounds, oldest first. A replayed round shares
+// its count with the tie before it, so rounds are ordered by id.
+func listRounds(ctx context.Context, db dialectDB, gameID int, res *[]domain.RoundContext) error {
+	query := `SELECT ` + roundColumns + ` FROM rounds WHERE game = ? ORDER BY id`
+	rows, err := db.QueryContext(ctx, query, gameID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var round domain.RoundContext
+		if err := scanRound(rows, &round); err != nil {
+			return err
+		}
+		*res = append(*res, round)
+	}
+	return rows.Err()
 }
 
 type playerRepository struct {
-	db *sql.DB
+	db dialectDB
 }
 
-func NewPlayerRepository(db *sql.DB) domain.PlayerRepository {
-	return &playerRepository{db}
+func NewPlayerRepository(db *sql.DB, dialect Dialect) domain.PlayerRepository {
+	return &playerRepository{dialectDB{db, dialect}}
 }
 
 func (pr *playerRepository) Create(ctx context.Context, player domain.PlayerCreateRequest, res *domain.PlayerResponse) error {
 	query := `
 		INSERT INTO players (
-			username
+			username,
+			token_hash
 		) VALUES (
-		 	$1
-		) RETURNING id, username
-	`
-	err := pr.db.QueryRowContext(ctx, query, player.UserName).Scan(
-		&res.ID,
-		&res.UserName,
-	)
+		 	?,
+		 	?
+		) RETURNING ` + playerColumns
+	err := scanPlayer(pr.db.QueryRowContext(ctx, query, player.UserName, nullableString(player.TokenHash)), res)
 	if err != nil {
-		return err
+		return pr.db.dialect.TranslateError(err)
 	}
 	return nil
 }
 
 func (pr *playerRepository) Get(ctx context.Context, id int, res *domain.PlayerResponse) error {
-	query := `
-		SELECT * FROM players WHERE id=$1;
-	`
-	err := pr.db.QueryRowContext(ctx, query, id).Scan(&res.ID, &res.UserName)
+	query := `SELECT ` + playerColumns + ` FROM players WHERE id=?;`
+	err := scanPlayer(pr.db.QueryRowContext(ctx, query, id), res)
 	if err != nil {
-		return err
+		return notFound(err, domain.ErrPlayerNotFound, id)
 	}
 	return nil
 }
 
-func (pr *playerRepository) GetGames(ctx context.Context, id int, res *[]domain.GameResponse) error {
-	query := `
-		SELECT 
-		id,
-		total_rounds,
-		current_round,
-		player_one_id,
-		player_two_id,
-		player_one_score,
-		player_two_score,
-		COALESCE(winner, 0),
-		finished,
-		created_at FROM games WHERE player_one_id = $1 OR player_two_id = $1
-	`
-	rows, err := pr.db.QueryContext(ctx, query, id)
+func (pr *playerRepository) GetByTokenHash(ctx context.Context, hash string, res *domain.PlayerResponse) error {
+	query := `SELECT ` + playerColumns + ` FROM players WHERE token_hash=?;`
+	err := scanPlayer(pr.db.QueryRowContext(ctx, query, hash), res)
+	if errors.Is(err, sql.ErrNoRows) {
+		return domain.ErrPlayerNotFound
+	}
+	return err
+}
+
+func (pr *playerRepository) List(ctx context.Context, filter domain.PlayerFilter, res *[]domain.PlayerResponse) error {
+	var where whereBuilder
+	if filter.After != nil {
+		where.add("id > ?", filter.After.ID)
+	}
+	query := `SELECT ` + playerColumns + ` FROM players` + where.String() + ` ORDER BY id LIMIT ` + where.arg(filter.Limit)
+	rows, err := pr.db.QueryContext(ctx, query, where.args...)
 	if err != nil {
 		return err
 	}
+	defer rows.Close()
 	for rows.Next() {
-		var game domain.GameResponse
-		err := rows.Scan(
-			&game.ID,
-			&game.TotalRounds,
-			&game.CurrentRound,
-			&game.PlayerOneId,
-			&game.PlayerTwoId,
-			&game.PlayerOneScore,
-			&game.PlayerTwoScore,
-			&game.Winner,
-			&game.Finished,
-			&game.CreatedAt,
-		)
-		if err != nil {
+		var player domain.PlayerResponse
+		if err := scanPlayer(rows, &player); err != nil {
 			return err
 		}
-		*res = append(*res, game)
-
+		*res = append(*res, player)
 	}
+	return rows.Err()
+}
+
+func (pr *playerRepository) GetStats(ctx context.Context, id int, opponentID int, res *domain.PlayerStats) error {
+	*res = domain.PlayerStats{PlayerID: id, OpponentID: opponentID}
 
+	games_query := `
+		SELECT COALESCE(finished, FALSE), COALESCE(winner, 0) FROM games
+		WHERE (player_one_id = ? OR player_two_id = ?)
+			AND (? = 0 OR player_one_id = ? OR player_two_id = ?)
+		ORDER BY created_at, id
+	`
+	rows, err := pr.db.QueryContext(ctx, games_query, id, id, opponentID, opponentID, opponentID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var finished bool
+		var winner int
+		if err := rows.Scan(&finished, &winner); err != nil {
+			return err
+		}
+		res.AddGame(finished, winner)
+	}
 	if err := rows.Err(); err != nil {
 		return err
 	}
+
+	// one row per hand the player threw in a finished round
+	hands_query := `
+		SELECT hand, COUNT(*),
+			SUM(CASE WHEN winner = ? THEN 1 ELSE 0 END),
+			SUM(CASE WHEN winner IS NULL THEN 1 ELSE 0 END)
+		FROM (
+			SELECT player_one_hand AS hand, winner FROM rounds
+			WHERE player_one_id = ? AND (? = 0 OR player_two_id = ?) AND finished
+			UNION ALL
+			SELECT player_two_hand AS hand, winner FROM rounds
+			WHERE player_two_id = ? AND (? = 0 OR player_one_id = ?) AND finished
+		) AS played
+		GROUP BY hand
+	`
+	hand_rows, err := pr.db.QueryContext(ctx, hands_query, id, id, opponentID, opponentID, id, opponentID, opponentID)
+	if err != nil {
+		return err
+	}
+	defer hand_rows.Close()
+	for hand_rows.Next() {
+		var hand domain.Hand
+		var played, won, tied int
+		if err := hand_rows.Scan(&hand, &played, &won, &tied); err != nil {
+			return err
+		}
+		res.AddHand(hand, played, won, tied)
+	}
+	if err := hand_rows.Err(); err != nil {
+		return err
+	}
+	res.Summarize()
 	return nil
 }
 
+// ratingChangeColumns is the column list scanRatingChange expects, in order.
+const ratingChangeColumns = `player_id, game_id, opponent_id, score, system,
+	rating_before, rating_deviation_before, rating_volatility_before,
+	rating_after, rating_deviation_after, rating_volatility_after, created_at`
+
+func scanRatingChange(row rowScanner, change *domain.RatingChange) error {
+	return row.Scan(
+		&change.PlayerID,
+		&change.GameID,
+		&change.OpponentID,
+		&change.Score,
+		&change.System,
+		&change.Before.Rating,
+		&change.Before.Deviation,
+		&change.Before.Volatility,
+		&change.After.Rating,
+		&change.After.Deviation,
+		&change.After.Volatility,
+		&change.CreatedAt,
+	)
+}
+
+func (pr *playerRepository) ListRatingHistory(ctx context.Context, id int, res *[]domain.RatingChange) error {
+	query := `SELECT ` + ratingChangeColumns + ` FROM rating_history WHERE player_id = ? ORDER BY id`
+	rows, err := pr.db.QueryContext(ctx, query, id)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var change domain.RatingChange
+		if err := scanRatingChange(rows, &change); err != nil {
+			return err
+		}
+		*res = append(*res, change)
+	}
+	return rows.Err()
+}
+
 type roundRepository struct {
-	db *sql.DB
+	db dialectDB
 }
 
-func NewRoundRepository(db *sql.DB) domain.RoundRepository {
-	return &roundRepository{db}
+func NewRoundRepository(db *sql.DB, dialect Dialect) domain.RoundRepository {
+	return &roundRepository{dialectDB{db, dialect}}
 }
 
 func (rr *roundRepository) Get(ctx context.Context, id int, res *domain.RoundContext) error {
-	query := `
-		SELECT * FROM rounds WHERE id=$1;
-	`
-	err := rr.db.QueryRowContext(ctx, query, id).Scan(&res.ID, &res.Count, &res.PlayerOneHand, &res.PlayerTwoHand)
+	query := `SELECT ` + roundColumns + ` FROM rounds WHERE id=?;`
+	err := scanRound(rr.db.QueryRowContext(ctx, query, id), res)
 	if err != nil {
-		return err
+		return notFound(err, domain.ErrRoundNotFound, id)
 	}
 	return nil
 }
 
+func (rr *roundRepository) ListByGame(ctx context.Context, gameID int, res *[]domain.RoundContext) error {
+	var id int
+	err := rr.db.QueryRowContext(ctx, `SELECT id FROM games WHERE id = ?`, gameID).Scan(&id)
+	if err != nil {
+		return notFound(err, domain.ErrGameNotFound, gameID)
+	}
+	return listRounds(ctx, rr.db, gameID, res)
+}
+
 func (rr *roundRepository) Create(ctx context.Context, res *domain.RoundContext) error {
 	type gameContext struct {
 		current_round int
@@ -178,15 +434,22 @@ func (rr *roundRepository) Create(ctx context.Context, res *domain.RoundContext)
 		player_two_id int
 	}
 	var newGameContext gameContext
+	tx, err := rr.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Lock the game so a round cannot be added while another request finishes it
 	check_count_query := `
-		SELECT current_round, total_rounds, player_one_id, player_two_id, finished FROM games WHERE id=$1;
+		SELECT current_round, total_rounds, player_one_id, player_two_id, finished FROM games WHERE id=?` + rr.db.forUpdate() + `;
 	`
-	err := rr.db.QueryRowContext(ctx, check_count_query, res.GameID).Scan(&newGameContext.current_round, &newGameContext.total_rounds, &newGameContext.player_one_id, &newGameContext.player_two_id, &newGameContext.finished)
+	err = tx.QueryRowContext(ctx, check_count_query, res.GameID).Scan(&newGameContext.current_round, &newGameContext.total_rounds, &newGameContext.player_one_id, &newGameContext.player_two_id, &newGameContext.finished)
 	if err != nil {
-		return err
+		return notFound(err, domain.ErrGameNotFound, res.GameID)
 	}
 	if newGameContext.finished {
-		return errors.New("Game Already Finished! Start a new round: /game/{gameId}/round/create")
+		return domain.ErrGameFinished
 	}
 	query := `
 		INSERT INTO rounds (
@@ -195,13 +458,13 @@ func (rr *roundRepository) Create(ctx context.Context, res *domain.RoundContext)
 			player_one_id,
 			player_two_id
 		) VALUES (
-		 	$1,
-			$2,
-			$3,
-			$4
+		 	?,
+			?,
+			?,
+			?
 		) RETURNING id, game, count, player_one_id, player_two_id;
 	`
-	err = rr.db.QueryRowContext(
+	err = tx.QueryRowContext(
 		ctx,
 		query,
 		res.GameID,
@@ -213,167 +476,729 @@ func (rr *roundRepository) Create(ctx context.Context, res *domain.RoundContext)
 	if err != nil {
 		return err
 	}
+	return tx.Commit()
+}
+
+// notFound turns sql.ErrNoRows into the given domain not-found error.
+func notFound(err error, sentinel *domain.Error, id int) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return domain.NotFound(sentinel, id)
+	}
+	return err
+}
+
+// playersExist returns ErrPlayerNotFound for the first of ids that is not a
+// player. Rows that refer to players check them first: the foreign keys
+// would catch a missing one too, but SQLite does not say which key failed.
+// Players are never deleted, so the check cannot go stale.
+func playersExist(ctx context.Context, db dialectDB, ids ...int) error {
+	for _, id := range ids {
+		var found int
+		err := db.QueryRowContext(ctx, `SELECT id FROM players WHERE id = ?`, id).Scan(&found)
+		if err != nil {
+			return notFound(err, domain.ErrPlayerNotFound, id)
+		}
+	}
 	return nil
 }
 
-// TODO: Has to be someway to simplify or condense the queries
-// Checks For Winner
-// Updates Score
-// Updates game finished
-func (rr *roundRepository) CheckForWinner(ctx context.Context, res *domain.RoundContext) error {
+// nullableID maps the "nobody" id 0 to NULL for player foreign keys.
+func nullableID(id int) sql.NullInt64 {
+	if id == 0 {
+		return sql.NullInt64{}
+	}
+	return sql.NullInt64{Int64: int64(id), Valid: true}
+}
+
+// nullableString maps "" to NULL so unset values stay out of unique indexes.
+func nullableString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+func (rr *roundRepository) Update(ctx context.Context, gameID int, roundID int, fn func(game *domain.GameResponse, round *domain.RoundContext) error) error {
+	tx, err := rr.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Lock the game before the round; every writer takes them in this order
+	var game domain.GameResponse
+	err = scanGame(tx.QueryRowContext(ctx, `SELECT `+gameColumns+` FROM games WHERE id = ?`+rr.db.forUpdate(), gameID), &game)
+	if err != nil {
+		return notFound(err, domain.ErrGameNotFound, gameID)
+	}
+	var round domain.RoundContext
+	round_query := `SELECT ` + roundColumns + ` FROM rounds WHERE id = ? AND game = ?` + rr.db.forUpdate()
+	err = scanRound(tx.QueryRowContext(ctx, round_query, roundID, gameID), &round)
+	if err != nil {
+		return notFound(err, domain.ErrRoundNotFound, roundID)
+	}
+	// Players come last, in id order, since a finishing move rewrites both ratings
+	ratings_query := `SELECT ` + playerColumns + ` FROM players WHERE id IN (?, ?) ORDER BY id` + rr.db.forUpdate()
+	rating_rows, err := tx.QueryContext(ctx, ratings_query, game.PlayerOneId, game.PlayerTwoId)
+	if err != nil {
+		return err
+	}
+	if err := scanRatings(rating_rows, &game); err != nil {
+		return err
+	}
+	was_finished, before := game.Finished, game.Ratings
+
+	if err := fn(&game, &round); err != nil {
+		return err
+	}
+
+	// Save hands, commitments and outcome
+	round_update := `
+		UPDATE rounds SET
+			player_one_hand = ?,
+			player_two_hand = ?,
+			winner = ?,
+			finished = ?,
+			player_one_commitment = ?,
+			player_two_commitment = ?,
+			player_one_nonce = ?,
+			player_two_nonce = ?
+		WHERE id = ?
+	`
+	_, err = tx.ExecContext(
+		ctx,
+		round_update,
+		round.PlayerOneHand,
+		round.PlayerTwoHand,
+		nullableID(round.Winner),
+		round.Finished,
+		nullableString(round.PlayerOneCommitment),
+		nullableString(round.PlayerTwoCommitment),
+		nullableString(round.PlayerOneNonce),
+		nullableString(round.PlayerTwoNonce),
+		round.ID,
+	)
+	if err != nil {
+		return err
+	}
 
-	query_player_select := `
-		SELECT player_one_id, player_two_id, COALESCE(player_one_hand, 'none'), COALESCE(player_two_hand, 'none') FROM rounds WHERE id = $1
+	// Save score, current round and game finished
+	game_update := `
+		UPDATE games SET
+			current_round = ?,
+			total_rounds = ?,
+			player_one_score = ?,
+			player_two_score = ?,
+			finished = ?,
+			winner = ?
+		WHERE id = ?
 	`
-	// Retrieve Fields for comparison
-	err := rr.db.QueryRowContext(ctx, query_player_select, res.ID).Scan(&res.PlayerOneID, &res.PlayerTwoID, &res.PlayerOneHand, &res.PlayerTwoHand)
+	_, err = tx.ExecContext(
+		ctx,
+		game_update,
+		game.CurrentRound,
+		game.TotalRounds,
+		game.PlayerOneScore,
+		game.PlayerTwoScore,
+		game.Finished,
+		nullableID(game.Winner),
+		game.ID,
+	)
 	if err != nil {
 		return err
 	}
 
-	winner_query := `UPDATE rounds SET winner = $1, finished = True WHERE id = $2 RETURNING * `
+	if game.Finished && !was_finished && game.Ratings.System != "" {
+		if err := saveRatings(ctx, tx, &game, before); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// scanRatings fills game.Ratings from the rows of its two players and closes
+// rows.
+func scanRatings(rows *sql.Rows, game *domain.GameResponse) error {
+	defer rows.Close()
+	for rows.Next() {
+		var player domain.PlayerResponse
+		if err := scanPlayer(rows, &player); err != nil {
+			return err
+		}
+		switch player.ID {
+		case game.PlayerOneId:
+			game.Ratings.PlayerOne = player.Rating
+		case game.PlayerTwoId:
+			game.Ratings.PlayerTwo = player.Rating
+		}
+	}
+	return rows.Err()
+}
 
-	var player_score_name string //dynamic query string
-	// Calculate score and create respective queries
-	winner := res.CalculateWinner()
-	if winner.PlayerID != 0 {
-		fmt.Println("Winner: ", winner)
-		switch winner.PlayerID {
-		case res.PlayerOneID:
-			player_score_name = "player_one_score"
-		case res.PlayerTwoID:
-			player_score_name = "player_two_score"
-		default:
-			winner_query = `UPDATE rounds SET winner=NULL, finished=True WHERE id=$1 RETURNING *`
-			player_score_name = ""
+// saveRatings writes the players' new ratings from game.Ratings and a history
+// row for each.
+func saveRatings(ctx context.Context, tx dialectTx, game *domain.GameResponse, before domain.GameRatings) error {
+	player_update := `UPDATE players SET rating = ?, rating_deviation = ?, rating_volatility = ? WHERE id = ?`
+	history_insert := `
+		INSERT INTO rating_history (
+			player_id,
+			game_id,
+			opponent_id,
+			score,
+			system,
+			rating_before,
+			rating_deviation_before,
+			rating_volatility_before,
+			rating_after,
+			rating_deviation_after,
+			rating_volatility_after
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`
+	for _, change := range domain.RatingChanges(game, before) {
+		_, err := tx.ExecContext(ctx, player_update, change.After.Rating, change.After.Deviation, change.After.Volatility, change.PlayerID)
+		if err != nil {
+			return err
 		}
-	} else {
-		// query for no winner (sad); write to res
-		no_winner_query := `SELECT
-							id,
-							game, 
-							count, 
-							player_one_id, 
-							player_two_id, 
-							COALESCE(player_one_hand, 'none'), 
-							COALESCE(player_two_hand, 'none'), 
-							COALESCE(winner, 0), 
-							finished
-							FROM rounds WHERE id=$1`
-		err := rr.db.QueryRowContext(ctx, no_winner_query, res.ID).Scan(&res.ID, &res.GameID, &res.Count, &res.PlayerOneID, &res.PlayerTwoID, &res.PlayerOneHand, &res.PlayerTwoHand, &res.Winner, &res.Finished)
+		_, err = tx.ExecContext(
+			ctx,
+			history_insert,
+			change.PlayerID,
+			change.GameID,
+			change.OpponentID,
+			change.Score,
+			change.System,
+			change.Before.Rating,
+			change.Before.Deviation,
+			change.Before.Volatility,
+			change.After.Rating,
+			change.After.Deviation,
+			change.After.Volatility,
+		)
 		if err != nil {
 			return err
 		}
-		return nil
 	}
+	return nil
+}
+
+type leaderboardRepository struct {
+	db dialectDB
+}
+
+func NewLeaderboardRepository(db *sql.DB, dialect Dialect) domain.LeaderboardRepository {
+	return &leaderboardRepository{dialectDB{db, dialect}}
+}
+
+// leaderboardRankColumns maps each sort to the column holding its rank.
+var leaderboardRankColumns = map[string]string{
+	domain.LeaderboardSortRating:  "rating_rank",
+	domain.LeaderboardSortWins:    "wins_rank",
+	domain.LeaderboardSortWinRate: "win_rate_rank",
+	domain.LeaderboardSortStreak:  "streak_rank",
+}
 
-	// Update Round Winner
-	row := rr.db.QueryRowContext(ctx, winner_query, winner.PlayerID, res.ID)
-	fmt.Println("Update round winner row context: ", row)
+// leaderboardStats is the query counting each player's games among those
+// where picks, longest run of wins included, so Refresh reads one row per
+// player rather than every game. Runs follow the created order: a game's
+// number among the player's games, less its number among those with the same
+// result, stays put for as long as the result does.
+func leaderboardStats(where whereBuilder) string {
+	return `
+	WITH finished AS (
+		SELECT id, created_at, player_one_id, player_two_id, COALESCE(winner, 0) AS winner
+		FROM games` + where.String() + `
+	), played AS (
+		SELECT id, created_at, player_one_id AS player_id, winner FROM finished
+		UNION ALL
+		SELECT id, created_at, player_two_id, winner FROM finished
+	), results AS (
+		SELECT player_id,
+			CASE WHEN winner = player_id THEN 1 ELSE 0 END AS won,
+			CASE WHEN winner = 0 THEN 1 ELSE 0 END AS drawn,
+			ROW_NUMBER() OVER (PARTITION BY player_id ORDER BY created_at, id) AS n
+		FROM played
+	), runs AS (
+		SELECT player_id, won, drawn,
+			n - ROW_NUMBER() OVER (PARTITION BY player_id, won ORDER BY n) AS run
+		FROM results
+	), streaks AS (
+		SELECT player_id, COUNT(*) AS length FROM runs WHERE won = 1 GROUP BY player_id, run
+	)
+	SELECT r.player_id, p.rating, COUNT(*), SUM(r.won), SUM(r.drawn),
+		COALESCE((SELECT MAX(s.length) FROM streaks s WHERE s.player_id = r.player_id), 0)
+	FROM runs r JOIN players p ON p.id = r.player_id
+	GROUP BY r.player_id, p.rating`
+}
 
-	err = row.Scan(&res.ID, &res.GameID, &res.Count, &res.PlayerOneID, &res.PlayerTwoID, &res.PlayerOneHand, &res.PlayerTwoHand, &res.Winner, &res.Finished)
+// leaderboardEntries returns the unranked entries of the finished games
+// created at or after since, or of every finished game for a zero since.
+func leaderboardEntries(ctx context.Context, tx dialectTx, window string, since time.Time, now time.Time) ([]domain.LeaderboardEntry, error) {
+	var where whereBuilder
+	where.add("COALESCE(finished, FALSE)")
+	if !since.IsZero() {
+		where.add("created_at >= ?", tx.dialect.Timestamp(since))
+	}
+	rows, err := tx.QueryContext(ctx, leaderboardStats(where), where.args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var entries []domain.LeaderboardEntry
+	for rows.Next() {
+		entry := domain.LeaderboardEntry{Window: window, RefreshedAt: now}
+		err := rows.Scan(
+			&entry.PlayerID,
+			&entry.Rating,
+			&entry.GamesPlayed,
+			&entry.GamesWon,
+			&entry.GamesDrawn,
+			&entry.LongestWinStreak,
+		)
+		if err != nil {
+			return nil, err
+		}
+		entry.GamesLost = entry.GamesPlayed - entry.GamesWon - entry.GamesDrawn
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+func (lr *leaderboardRepository) Refresh(ctx context.Context, now time.Time, minGames int) error {
+	// Repeatable read so every window is counted from the same snapshot
+	tx, err := lr.db.BeginTx(ctx, &sql.TxOptions{Isolation: lr.db.dialect.SnapshotIsolation()})
 	if err != nil {
 		return err
 	}
+	defer tx.Rollback()
 
-	type GameContext struct {
-		TotalRounds    int `json:"total_rounds"`
-		CurrentRound   int `json:"current_round"`
-		PlayerOneScore int `json:"player_one_score"`
-		PlayerTwoScore int `json:"player_two_score"`
+	windows := map[string][]domain.LeaderboardEntry{}
+	for window, span := range domain.LeaderboardWindows {
+		var since time.Time
+		if span != 0 {
+			since = now.Add(-span)
+		}
+		entries, err := leaderboardEntries(ctx, tx, window, since, now)
+		if err != nil {
+			return err
+		}
+		domain.RankLeaderboard(entries, minGames)
+		windows[window] = entries
 	}
-	var gameCtx GameContext
-	// Update current round
-	err = rr.db.QueryRowContext(ctx, "UPDATE games SET current_round = current_round + 1 WHERE id=$1 RETURNING current_round, total_rounds", res.GameID).Scan(&gameCtx.CurrentRound, &gameCtx.TotalRounds)
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM leaderboard`); err != nil {
+		return err
+	}
+	insert, err := tx.PrepareContext(ctx, `
+		INSERT INTO leaderboard (
+			time_window,
+			player_id,
+			rating,
+			games_played,
+			games_won,
+			games_lost,
+			games_drawn,
+			win_rate,
+			longest_win_streak,
+			rating_rank,
+			wins_rank,
+			win_rate_rank,
+			streak_rank,
+			refreshed_at
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`)
 	if err != nil {
 		return err
 	}
+	defer insert.Close()
+	for _, entries := range windows {
+		for _, e := range entries {
+			_, err := insert.ExecContext(
+				ctx,
+				e.Window,
+				e.PlayerID,
+				e.Rating,
+				e.GamesPlayed,
+				e.GamesWon,
+				e.GamesLost,
+				e.GamesDrawn,
+				e.WinRate,
+				e.LongestWinStreak,
+				e.RatingRank,
+				e.WinsRank,
+				nullableID(e.WinRateRank),
+				e.StreakRank,
+				e.RefreshedAt,
+			)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return tx.Commit()
+}
 
-	// Update Score
-	var score_query string
-	if len(player_score_name) != 0 {
-		switch player_score_name {
-		case "player_one_score":
-			score_query = `UPDATE games SET player_one_score=player_one_score + 1 WHERE id=$1 RETURNING player_one_score, player_two_score`
-		case "player_two_score":
-			score_query = `UPDATE games SET player_two_score=player_two_score +1 WHERE id=$1 RETURNING player_one_score, player_two_score`
-		default:
-			score_query = "SELECT player_one_score, player_two_score WHERE id=$1"
+func (lr *leaderboardRepository) List(ctx context.Context, filter domain.LeaderboardFilter, res *[]domain.LeaderboardEntry) error {
+	rank := "l." + leaderboardRankColumns[filter.Sort]
+	var where whereBuilder
+	where.add("l.time_window = ?", filter.Window)
+	where.add(rank + " IS NOT NULL")
+	if filter.After != nil {
+		where.add(rank+" > ?", filter.After.ID)
+	}
+	query := `
+		SELECT ` + rank + `, l.player_id, p.username, l.rating, l.games_played, l.games_won, l.games_lost,
+			l.games_drawn, l.win_rate, l.longest_win_streak,
+			l.rating_rank, l.wins_rank, COALESCE(l.win_rate_rank, 0), l.streak_rank, l.refreshed_at
+		FROM leaderboard l JOIN players p ON p.id = l.player_id` + where.String() + `
+		ORDER BY ` + rank + ` LIMIT ` + where.arg(filter.Limit)
+	rows, err := lr.db.QueryContext(ctx, query, where.args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		entry := domain.LeaderboardEntry{Window: filter.Window}
+		err := rows.Scan(
+			&entry.Rank,
+			&entry.PlayerID,
+			&entry.UserName,
+			&entry.Rating,
+			&entry.GamesPlayed,
+			&entry.GamesWon,
+			&entry.GamesLost,
+			&entry.GamesDrawn,
+			&entry.WinRate,
+			&entry.LongestWinStreak,
+			&entry.RatingRank,
+			&entry.WinsRank,
+			&entry.WinRateRank,
+			&entry.StreakRank,
+			&entry.RefreshedAt,
+		)
+		if err != nil {
+			return err
 		}
-		err = rr.db.QueryRowContext(ctx, score_query, res.GameID).Scan(&gameCtx.PlayerOneScore, &gameCtx.PlayerTwoScore)
+		*res = append(*res, entry)
+	}
+	return rows.Err()
+}
 
+type gameEventRepository struct {
+	db dialectDB
+}
+
+func NewGameEventRepository(db *sql.DB, dialect Dialect) domain.GameEventRepository {
+	return &gameEventRepository{dialectDB{db, dialect}}
+}
+
+func (er *gameEventRepository) Append(ctx context.Context, events []domain.GameEvent) error {
+	tx, err := er.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
 	}
+	defer tx.Rollback()
 
-	var gameWinner int
-	switch {
-	case gameCtx.PlayerOneScore > gameCtx.PlayerTwoScore:
-		gameWinner = res.PlayerOneID
-	case gameCtx.PlayerOneScore < gameCtx.PlayerTwoScore:
-		gameWinner = res.PlayerTwoID
-	default:
-		gameWinner = 0
+	for i := range events {
+		event := &events[i]
+		// Lock the game so concurrent appends cannot take the same seq
+		_, err := tx.ExecContext(ctx, `SELECT id FROM games WHERE id = ?`+er.db.forUpdate(), event.GameID)
+		if err != nil {
+			return err
+		}
+		seq_query := `SELECT COALESCE(MAX(seq), 0) + 1 FROM game_events WHERE game_id = ?`
+		if err := tx.QueryRowContext(ctx, seq_query, event.GameID).Scan(&event.Seq); err != nil {
+			return err
+		}
+		payload, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		insert := `
+			INSERT INTO game_events (game_id, seq, type, player_one_id, player_two_id, payload)
+			VALUES (?, ?, ?, ?, ?, ?)
+			RETURNING id
+		`
+		err = tx.QueryRowContext(ctx, insert, event.GameID, event.Seq, event.Type, event.PlayerOneID, event.PlayerTwoID, string(payload)).Scan(&event.ID)
+		if err != nil {
+			return err
+		}
 	}
+	return tx.Commit()
+}
+
+func (er *gameEventRepository) ListByGame(ctx context.Context, gameID int, afterSeq int, res *[]domain.GameEvent) error {
+	query := `SELECT id, seq, payload FROM game_events WHERE game_id = ? AND seq > ? ORDER BY seq`
+	return er.list(ctx, res, query, gameID, afterSeq)
+}
 
-	if gameCtx.CurrentRound > gameCtx.TotalRounds {
-		_ = rr.db.QueryRowContext(ctx, "UPDATE games SET finished=True, winner=$1 WHERE id=$2 RETURNING player_one_score, player_two_score", gameWinner, res.GameID)
+func (er *gameEventRepository) ListByPlayer(ctx context.Context, playerID int, afterID int, res *[]domain.GameEvent) error {
+	query := `
+		SELECT id, seq, payload FROM game_events
+		WHERE (player_one_id = ? OR player_two_id = ?) AND id > ?
+		ORDER BY id
+	`
+	return er.list(ctx, res, query, playerID, playerID, afterID)
+}
+
+func (er *gameEventRepository) list(ctx context.Context, res *[]domain.GameEvent, query string, args ...any) error {
+	rows, err := er.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
 	}
+	defer rows.Close()
+	for rows.Next() {
+		var id, seq int
+		var payload string
+		if err := rows.Scan(&id, &seq, &payload); err != nil {
+			return err
+		}
+		var event domain.GameEvent
+		if err := json.Unmarshal([]byte(payload), &event); err != nil {
+			return err
+		}
+		event.ID, event.Seq = id, seq
+		*res = append(*res, event)
+	}
+	return rows.Err()
+}
+
+type webhookRepository struct {
+	db dialectDB
+}
+
+func NewWebhookRepository(db *sql.DB, dialect Dialect) domain.WebhookRepository {
+	return &webhookRepository{dialectDB{db, dialect}}
+}
 
+// webhookColumns is the column list scanWebhook expects, in order.
+const webhookColumns = `id, player_id, url, events, secret, created_at`
+
+func scanWebhook(row rowScanner, webhook *domain.Webhook) error {
+	return row.Scan(
+		&webhook.ID,
+		&webhook.PlayerID,
+		&webhook.URL,
+		&webhook.Events,
+		&webhook.Secret,
+		&webhook.CreatedAt,
+	)
+}
+
+// deliveryColumns is the column list scanDelivery expects, in order.
+const deliveryColumns = `id, webhook_id, event_id, event_type, payload, status, attempts, next_attempt_at, created_at`
+
+func scanDelivery(row rowScanner, delivery *domain.WebhookDelivery) error {
+	var payload string
+	var next sql.NullTime
+	err := row.Scan(
+		&delivery.ID,
+		&delivery.WebhookID,
+		&delivery.EventID,
+		&delivery.EventType,
+		&payload,
+		&delivery.Status,
+		&delivery.Attempts,
+		&next,
+		&delivery.CreatedAt,
+	)
+	if err != nil {
+		return err
+	}
+	delivery.Payload = json.RawMessage(payload)
+	delivery.NextAttemptAt = next.Time
 	return nil
 }
 
-func (rr *roundRepository) UpdateHand(ctx context.Context, hand string, res *domain.RoundContext) error {
-	// Query Game player ids
-	player_query := `
-		SELECT player_one_id, player_two_id FROM games WHERE id = $1;
-	`
-	err := rr.db.QueryRowContext(ctx, player_query, &res.GameID).Scan(&res.PlayerOneID, &res.PlayerTwoID)
+func (wr *webhookRepository) Create(ctx context.Context, req domain.WebhookCreateRequest, res *domain.Webhook) error {
+	if err := playersExist(ctx, wr.db, req.PlayerID); err != nil {
+		return err
+	}
+	query := `INSERT INTO webhooks (player_id, url, events, secret) VALUES (?, ?, ?, ?) RETURNING ` + webhookColumns
+	return scanWebhook(wr.db.QueryRowContext(ctx, query, req.PlayerID, req.URL, req.Events, req.Secret), res)
+}
+
+func (wr *webhookRepository) Get(ctx context.Context, id int, res *domain.Webhook) error {
+	query := `SELECT ` + webhookColumns + ` FROM webhooks WHERE id = ?`
+	return notFound(scanWebhook(wr.db.QueryRowContext(ctx, query, id), res), domain.ErrWebhookNotFound, id)
+}
+
+func (wr *webhookRepository) ListByPlayer(ctx context.Context, playerID int, res *[]domain.Webhook) error {
+	query := `SELECT ` + webhookColumns + ` FROM webhooks WHERE player_id = ? ORDER BY id`
+	rows, err := wr.db.QueryContext(ctx, query, playerID)
 	if err != nil {
 		return err
 	}
+	defer rows.Close()
+	for rows.Next() {
+		var webhook domain.Webhook
+		if err := scanWebhook(rows, &webhook); err != nil {
+			return err
+		}
+		*res = append(*res, webhook)
+	}
+	return rows.Err()
+}
 
-	err = res.CheckCurrentPlayer()
+func (wr *webhookRepository) Delete(ctx context.Context, id int) error {
+	result, err := wr.db.ExecContext(ctx, `DELETE FROM webhooks WHERE id = ?`, id)
 	if err != nil {
 		return err
 	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if deleted == 0 {
+		return domain.NotFound(domain.ErrWebhookNotFound, id)
+	}
+	return nil
+}
+
+func (wr *webhookRepository) Enqueue(ctx context.Context, event domain.GameEvent, now time.Time) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	var webhooks []domain.Webhook
+	if err := wr.listByPlayers(ctx, event.PlayerOneID, event.PlayerTwoID, &webhooks); err != nil {
+		return err
+	}
 
-	if res.CurrentPlayer == res.PlayerOneID {
-		truth := res.HasPlayerOnePlayed()
-		if truth {
-			return errors.New("Sneaky, Sneaky, You have already played.")
+	tx, err := wr.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	insert := `
+		INSERT INTO webhook_deliveries (webhook_id, event_id, event_type, payload, status, next_attempt_at, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+	`
+	for _, webhook := range webhooks {
+		if !webhook.Wants(event.Type) {
+			continue
 		}
-	} else if res.CurrentPlayer == res.PlayerTwoID {
-		truth := res.HasPlayerTwoPlayed()
-		if truth {
-			return errors.New("Sneaky, Sneaky, You have already played.")
+		_, err := tx.ExecContext(ctx, insert, webhook.ID, event.ID, event.Type, string(payload), domain.DeliveryPending, wr.db.dialect.Timestamp(now), now)
+		if err != nil {
+			return err
 		}
 	}
+	return tx.Commit()
+}
 
-	err = res.SetHandOnCurrentPlayer(hand)
+func (wr *webhookRepository) listByPlayers(ctx context.Context, playerOneID int, playerTwoID int, res *[]domain.Webhook) error {
+	query := `SELECT ` + webhookColumns + ` FROM webhooks WHERE player_id IN (?, ?) ORDER BY id`
+	rows, err := wr.db.QueryContext(ctx, query, playerOneID, playerTwoID)
 	if err != nil {
 		return err
 	}
+	defer rows.Close()
+	for rows.Next() {
+		var webhook domain.Webhook
+		if err := scanWebhook(rows, &webhook); err != nil {
+			return err
+		}
+		*res = append(*res, webhook)
+	}
+	return rows.Err()
+}
 
-	currentPlayerContext := res.CurrentPlayerContext()
-	if currentPlayerContext.ID == 0 {
-		return errors.New("Current Player is not in this game.")
+func (wr *webhookRepository) ListDue(ctx context.Context, now time.Time, limit int, res *[]domain.WebhookDelivery) error {
+	query := `
+		SELECT ` + deliveryColumns + ` FROM webhook_deliveries
+		WHERE status = ? AND next_attempt_at <= ?
+		ORDER BY next_attempt_at, id
+		LIMIT ?
+	`
+	rows, err := wr.db.QueryContext(ctx, query, domain.DeliveryPending, wr.db.dialect.Timestamp(now), limit)
+	if err != nil {
+		return err
 	}
+	defer rows.Close()
+	for rows.Next() {
+		var delivery domain.WebhookDelivery
+		if err := scanDelivery(rows, &delivery); err != nil {
+			return err
+		}
+		*res = append(*res, delivery)
+	}
+	return rows.Err()
+}
 
-	var set_player_hand_query string
-	switch currentPlayerContext.ID {
-	case res.PlayerOneID:
-		set_player_hand_query = `UPDATE rounds SET player_one_hand = $1 WHERE id = $2`
-	case res.PlayerTwoID:
-		set_player_hand_query = "UPDATE rounds SET player_two_hand = $1 WHERE id = $2"
-	default:
-		return errors.New("Player does not belong here or is missing")
+func (wr *webhookRepository) RecordAttempt(ctx context.Context, delivery domain.WebhookDelivery, attempt domain.WebhookAttempt) error {
+	tx, err := wr.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
 	}
-	// Query to set the player hand
-	_ = rr.db.QueryRowContext(ctx, set_player_hand_query, res.CurrentPlayerHand(), &res.ID)
-	err = rr.CheckForWinner(ctx, res)
+	defer tx.Rollback()
 
+	// NULL once the delivery is settled
+	var next any
+	if !delivery.NextAttemptAt.IsZero() {
+		next = wr.db.dialect.Timestamp(delivery.NextAttemptAt)
+	}
+	update := `UPDATE webhook_deliveries SET status = ?, attempts = ?, next_attempt_at = ? WHERE id = ?`
+	if _, err := tx.ExecContext(ctx, update, delivery.Status, delivery.Attempts, next, delivery.ID); err != nil {
+		return err
+	}
+	insert := `
+		INSERT INTO webhook_attempts (delivery_id, attempt, status_code, error, duration_ms, attempted_at)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`
+	_, err = tx.ExecContext(ctx, insert, delivery.ID, attempt.Attempt, nullableID(attempt.StatusCode), attempt.Error, attempt.DurationMS, attempt.AttemptedAt)
 	if err != nil {
 		return err
 	}
-	fmt.Println("CheckForWinner Response: ", res)
-	return nil
+	return tx.Commit()
+}
+
+func (wr *webhookRepository) ListDeliveries(ctx context.Context, webhookID int, filter domain.WebhookDeliveryFilter, res *[]domain.WebhookDelivery) error {
+	var where whereBuilder
+	where.add("webhook_id = ?", webhookID)
+	if filter.After != nil {
+		where.add("id < ?", filter.After.ID)
+	}
+	query := `SELECT ` + deliveryColumns + ` FROM webhook_deliveries` + where.String() + ` ORDER BY id DESC LIMIT ` + where.arg(filter.Limit)
+	rows, err := wr.db.QueryContext(ctx, query, where.args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	first := len(*res)
+	byID := make(map[int]int)
+	for rows.Next() {
+		delivery := domain.WebhookDelivery{History: []domain.WebhookAttempt{}}
+		if err := scanDelivery(rows, &delivery); err != nil {
+			return err
+		}
+		byID[delivery.ID] = len(*res)
+		*res = append(*res, delivery)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if len(*res) == first {
+		return nil
+	}
+
+	// the page is a run of ids, so one range query finds its attempts
+	page := (*res)[first:]
+	attempts := `
+		SELECT a.delivery_id, a.attempt, COALESCE(a.status_code, 0), a.error, a.duration_ms, a.attempted_at
+		FROM webhook_attempts a JOIN webhook_deliveries d ON d.id = a.delivery_id
+		WHERE d.webhook_id = ? AND d.id BETWEEN ? AND ?
+		ORDER BY a.delivery_id, a.attempt
+	`
+	attempt_rows, err := wr.db.QueryContext(ctx, attempts, webhookID, page[len(page)-1].ID, page[0].ID)
+	if err != nil {
+		return err
+	}
+	defer attempt_rows.Close()
+	for attempt_rows.Next() {
+		var deliveryID int
+		var attempt domain.WebhookAttempt
+		err := attempt_rows.Scan(&deliveryID, &attempt.Attempt, &attempt.StatusCode, &attempt.Error, &attempt.DurationMS, &attempt.AttemptedAt)
+		if err != nil {
+			return err
+		}
+		i := byID[deliveryID]
+		(*res)[i].History = append((*res)[i].History, attempt)
+	}
+	return attempt_rows.Err()
 }
@@ -0,0 +1,50 @@
+package repository_test
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"testing"
+
+	"github.com/ellisbywater/http-rock-paper-scissors/internal/migrate"
+	"github.com/ellisbywater/http-rock-paper-scissors/internal/repository"
+	"github.com/ellisbywater/http-rock-paper-scissors/internal/repository/repositorytest"
+	_ "github.com/lib/pq"
+)
+
+// TestRepositories runs against the Postgres database in TEST_DATABASE_URL.
+// Migrations are applied and every table is truncated between subtests, so
+// never point it at real data.
+func TestRepositories(t *testing.T) {
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	migrator, err := migrate.New(db, migrate.DialectPostgres)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := migrator.Up(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	repositorytest.Run(t, func(t *testing.T) repositorytest.Repositories {
+		_, err := db.Exec(`TRUNCATE rounds, games, players RESTART IDENTITY CASCADE`)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return repositorytest.Repositories{
+			Players:     repository.NewPlayerRepository(db, repository.Postgres),
+			Games:       repository.NewGameRepository(db, repository.Postgres),
+			Rounds:      repository.NewRoundRepository(db, repository.Postgres),
+			Leaderboard: repository.NewLeaderboardRepository(db, repository.Postgres),
+			Events:      repository.NewGameEventRepository(db, repository.Postgres),
+			Webhooks:    repository.NewWebhookRepository(db, repository.Postgres),
+		}
+	})
+}
@@ -0,0 +1,1270 @@
+// Package repositorytest is the behaviour every storage backend must share.
+// A backend's tests call Run with a factory that returns empty repositories.
+package repositorytest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ellisbywater/http-rock-paper-scissors/internal/domain"
+)
+
+type Repositories struct {
+	Players     domain.PlayerRepository
+	Games       domain.GameRepository
+	Rounds      domain.RoundRepository
+	Leaderboard domain.LeaderboardRepository
+	Events      domain.GameEventRepository
+	Webhooks    domain.WebhookRepository
+}
+
+// Factory returns repositories backed by fresh, empty storage. It is called
+// once per subtest.
+type Factory func(t *testing.T) Repositories
+
+func Run(t *testing.T, factory Factory) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, repos Repositories)
+	}{
+		{"PlayerCreateAndGet", testPlayerCreateAndGet},
+		{"PlayerDuplicateUsername", testPlayerDuplicateUsername},
+		{"PlayerDuplicateTokenHash", testPlayerDuplicateTokenHash},
+		{"PlayerUnknownID", testPlayerUnknownID},
+		{"PlayerGetByTokenHash", testPlayerGetByTokenHash},
+		{"PlayerList", testPlayerList},
+		{"PlayerStats", testPlayerStats},
+		{"PlayerStatsAgainstOpponent", testPlayerStatsAgainstOpponent},
+		{"GameListByPlayer", testGameListByPlayer},
+		{"GameListFilters", testGameListFilters},
+		{"GameListPaging", testGameListPaging},
+		{"GameCreateAndGet", testGameCreateAndGet},
+		{"GameUnknownID", testGameUnknownID},
+		{"RoundCreateAndGet", testRoundCreateAndGet},
+		{"RoundUnknownIDs", testRoundUnknownIDs},
+		{"RoundListByGame", testRoundListByGame},
+		{"RoundUpdateRollsBackOnError", testRoundUpdateRollsBackOnError},
+		{"RoundTieReplay", testRoundTieReplay},
+		{"RoundCommitReveal", testRoundCommitReveal},
+		{"GameFinishes", testGameFinishes},
+		{"GameRatings", testGameRatings},
+		{"ConcurrentPlays", testConcurrentPlays},
+		{"Leaderboard", testLeaderboard},
+		{"LeaderboardStreaks", testLeaderboardStreaks},
+		{"GameEvents", testGameEvents},
+		{"Webhooks", testWebhooks},
+		{"WebhookUnknownPlayer", testWebhookUnknownPlayer},
+		{"WebhookDeliveries", testWebhookDeliveries},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.fn(t, factory(t))
+		})
+	}
+}
+
+func createPlayer(t *testing.T, repos Repositories, username string) domain.PlayerResponse {
+	t.Helper()
+	var player domain.PlayerResponse
+	err := repos.Players.Create(context.Background(), domain.PlayerCreateRequest{UserName: username}, &player)
+	if err != nil {
+		t.Fatalf("create player %q: %v", username, err)
+	}
+	return player
+}
+
+func createGame(t *testing.T, repos Repositories, req domain.GameCreateRequest) domain.GameCreateResponse {
+	t.Helper()
+	if err := req.Validate(); err != nil {
+		t.Fatalf("validate game: %v", err)
+	}
+	rules, err := domain.NewRuleSet(req.RuleSet, req.Weapons)
+	if err != nil {
+		t.Fatalf("rule set: %v", err)
+	}
+	req.RuleSet = rules.Name()
+	req.Weapons = rules.Hands()
+	var game domain.GameCreateResponse
+	if err := repos.Games.Create(context.Background(), req, &game); err != nil {
+		t.Fatalf("create game: %v", err)
+	}
+	return game
+}
+
+func createRound(t *testing.T, repos Repositories, gameID int) domain.RoundContext {
+	t.Helper()
+	round := domain.RoundContext{GameID: gameID}
+	if err := repos.Rounds.Create(context.Background(), &round); err != nil {
+		t.Fatalf("create round: %v", err)
+	}
+	return round
+}
+
+func play(repos Repositories, gameID int, roundID int, playerID int, hand domain.Hand) error {
+	return repos.Rounds.Update(context.Background(), gameID, roundID, func(game *domain.GameResponse, round *domain.RoundContext) error {
+		return playHand(game, round, playerID, hand)
+	})
+}
+
+// playHand is the least of what the game engine does with a move: record the
+// hand and, once both are in, settle the round on the game. The rules of play
+// are tested with the engine; the suite only needs moves to save.
+func playHand(game *domain.GameResponse, round *domain.RoundContext, playerID int, hand domain.Hand) error {
+	if err := round.SetCurrentPlayer(playerID); err != nil {
+		return err
+	}
+	if err := round.SetHandOnCurrentPlayer(hand); err != nil {
+		return err
+	}
+	return settle(game, round)
+}
+
+func settle(game *domain.GameResponse, round *domain.RoundContext) error {
+	if !round.HasPlayerOnePlayed() || !round.HasPlayerTwoPlayed() {
+		return nil
+	}
+	rules, err := game.Rules()
+	if err != nil {
+		return err
+	}
+	round.Winner = round.CalculateWinner(rules).PlayerID
+	round.Finished = true
+	game.ApplyRoundResult(round.Winner)
+	return nil
+}
+
+func mustPlay(t *testing.T, repos Repositories, gameID int, roundID int, playerID int, hand domain.Hand) {
+	t.Helper()
+	if err := play(repos, gameID, roundID, playerID, hand); err != nil {
+		t.Fatalf("player %d plays %s: %v", playerID, hand, err)
+	}
+}
+
+func getGame(t *testing.T, repos Repositories, id int) domain.GameResponse {
+	t.Helper()
+	var game domain.GameResponse
+	if err := repos.Games.Get(context.Background(), id, &game); err != nil {
+		t.Fatalf("get game %d: %v", id, err)
+	}
+	return game
+}
+
+func getRound(t *testing.T, repos Repositories, id int) domain.RoundContext {
+	t.Helper()
+	var round domain.RoundContext
+	if err := repos.Rounds.Get(context.Background(), id, &round); err != nil {
+		t.Fatalf("get round %d: %v", id, err)
+	}
+	return round
+}
+
+func testPlayerCreateAndGet(t *testing.T, repos Repositories) {
+	created := createPlayer(t, repos, "adrian")
+	if created.ID == 0 || created.UserName != "adrian" {
+		t.Fatalf("created player = %+v", created)
+	}
+	var got domain.PlayerResponse
+	if err := repos.Players.Get(context.Background(), created.ID, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got != created {
+		t.Fatalf("Get = %+v, want %+v", got, created)
+	}
+}
+
+func testPlayerDuplicateUsername(t *testing.T, repos Repositories) {
+	createPlayer(t, repos, "maurice")
+	var player domain.PlayerResponse
+	err := repos.Players.Create(context.Background(), domain.PlayerCreateRequest{UserName: "maurice"}, &player)
+	if !errors.Is(err, domain.ErrUsernameTaken) {
+		t.Fatalf("duplicate username: err = %v, want ErrUsernameTaken", err)
+	}
+}
+
+// testPlayerDuplicateTokenHash breaks a unique constraint other than the
+// username's, which must not be reported as a taken username.
+func testPlayerDuplicateTokenHash(t *testing.T, repos Repositories) {
+	ctx := context.Background()
+	var player domain.PlayerResponse
+	if err := repos.Players.Create(ctx, domain.PlayerCreateRequest{UserName: "a", TokenHash: "hash"}, &player); err != nil {
+		t.Fatal(err)
+	}
+	err := repos.Players.Create(ctx, domain.PlayerCreateRequest{UserName: "b", TokenHash: "hash"}, &player)
+	if err == nil || errors.Is(err, domain.ErrUsernameTaken) {
+		t.Fatalf("duplicate token hash: err = %v, want an error other than ErrUsernameTaken", err)
+	}
+	if _, ok := domain.AsError(err); ok {
+		t.Fatalf("duplicate token hash: err = %v, want an internal error", err)
+	}
+}
+
+func testPlayerUnknownID(t *testing.T, repos Repositories) {
+	var player domain.PlayerResponse
+	err := repos.Players.Get(context.Background(), 4242, &player)
+	if !errors.Is(err, domain.ErrPlayerNotFound) {
+		t.Fatalf("Get unknown player: err = %v, want ErrPlayerNotFound", err)
+	}
+	var games []domain.GameResponse
+	if err := repos.Games.List(context.Background(), domain.GameFilter{PlayerID: 4242, Limit: 10}, &games); err != nil {
+		t.Fatalf("List games of unknown player: %v", err)
+	}
+	if len(games) != 0 {
+		t.Fatalf("List games of unknown player returned %d games", len(games))
+	}
+}
+
+func testPlayerGetByTokenHash(t *testing.T, repos Repositories) {
+	ctx := context.Background()
+	// players without a token must not collide with each other
+	createPlayer(t, repos, "tokenless")
+	createPlayer(t, repos, "also-tokenless")
+
+	_, hash, err := domain.NewToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var created domain.PlayerResponse
+	if err := repos.Players.Create(ctx, domain.PlayerCreateRequest{UserName: "alice", TokenHash: hash}, &created); err != nil {
+		t.Fatalf("Create with token: %v", err)
+	}
+
+	var got domain.PlayerResponse
+	if err := repos.Players.GetByTokenHash(ctx, hash, &got); err != nil {
+		t.Fatalf("GetByTokenHash: %v", err)
+	}
+	if got != created {
+		t.Fatalf("GetByTokenHash = %+v, want %+v", got, created)
+	}
+	for _, unknown := range []string{"", domain.HashToken("not a token")} {
+		err := repos.Players.GetByTokenHash(ctx, unknown, &got)
+		if !errors.Is(err, domain.ErrPlayerNotFound) {
+			t.Fatalf("GetByTokenHash(%q): err = %v, want ErrPlayerNotFound", unknown, err)
+		}
+	}
+}
+
+func testPlayerList(t *testing.T, repos Repositories) {
+	ctx := context.Background()
+	var created []domain.PlayerResponse
+	for _, name := range []string{"a", "b", "c", "d", "e"} {
+		created = append(created, createPlayer(t, repos, name))
+	}
+
+	var first []domain.PlayerResponse
+	if err := repos.Players.List(ctx, domain.PlayerFilter{Limit: 2}, &first); err != nil {
+		t.Fatal(err)
+	}
+	if len(first) != 2 || first[0] != created[0] || first[1] != created[1] {
+		t.Fatalf("first page = %+v", first)
+	}
+	var rest []domain.PlayerResponse
+	after := &domain.Cursor{ID: first[1].ID}
+	if err := repos.Players.List(ctx, domain.PlayerFilter{Limit: 10, After: after}, &rest); err != nil {
+		t.Fatal(err)
+	}
+	if len(rest) != 3 || rest[0] != created[2] || rest[2] != created[4] {
+		t.Fatalf("second page = %+v", rest)
+	}
+}
+
+func testPlayerStats(t *testing.T, repos Repositories) {
+	a := createPlayer(t, repos, "a")
+	b := createPlayer(t, repos, "b")
+	playGame := func(hands ...domain.Hand) int {
+		t.Helper()
+		game := createGame(t, repos, domain.GameCreateRequest{TotalRounds: len(hands) / 2, PlayerOneID: a.ID, PlayerTwoID: b.ID})
+		for i := 0; i < len(hands); i += 2 {
+			round := createRound(t, repos, game.ID)
+			mustPlay(t, repos, game.ID, round.ID, a.ID, hands[i])
+			mustPlay(t, repos, game.ID, round.ID, b.ID, hands[i+1])
+		}
+		return game.ID
+	}
+	// a wins, loses, wins twice in a row; then a game is left unfinished
+	// with a's hand already in, which must not be counted
+	playGame(domain.Paper, domain.Rock)
+	playGame(domain.Rock, domain.Paper)
+	playGame(domain.Rock, domain.Scissors, domain.Rock, domain.Rock, domain.Paper, domain.Rock)
+	playGame(domain.Scissors, domain.Paper)
+	open := createGame(t, repos, domain.GameCreateRequest{TotalRounds: 1, PlayerOneID: a.ID, PlayerTwoID: b.ID})
+	round := createRound(t, repos, open.ID)
+	mustPlay(t, repos, open.ID, round.ID, a.ID, domain.Scissors)
+
+	var stats domain.PlayerStats
+	if err := repos.Players.GetStats(context.Background(), a.ID, 0, &stats); err != nil {
+		t.Fatal(err)
+	}
+	want := domain.PlayerStats{
+		PlayerID:         a.ID,
+		GamesPlayed:      4,
+		GamesWon:         3,
+		GamesLost:        1,
+		GamesInProgress:  1,
+		WinRate:          0.75,
+		CurrentWinStreak: 2,
+		LongestWinStreak: 2,
+		RoundsPlayed:     6,
+		RoundsWon:        4,
+		RoundsLost:       1,
+		RoundsTied:       1,
+		Hands: []domain.HandStats{
+			{Hand: domain.Rock, Played: 3, Won: 1, Lost: 1, Tied: 1, Usage: 0.5, WinRate: 0.3333},
+			{Hand: domain.Paper, Played: 2, Won: 2, Usage: 0.3333, WinRate: 1},
+			{Hand: domain.Scissors, Played: 1, Won: 1, Usage: 0.1667, WinRate: 1},
+		},
+	}
+	if !reflect.DeepEqual(stats, want) {
+		t.Fatalf("stats = %+v\nwant    %+v", stats, want)
+	}
+
+	var none domain.PlayerStats
+	c := createPlayer(t, repos, "c")
+	if err := repos.Players.GetStats(context.Background(), c.ID, 0, &none); err != nil {
+		t.Fatal(err)
+	}
+	if none.GamesPlayed != 0 || none.Hands == nil || len(none.Hands) != 0 {
+		t.Fatalf("stats of a new player = %+v", none)
+	}
+}
+
+func testPlayerStatsAgainstOpponent(t *testing.T, repos Repositories) {
+	a := createPlayer(t, repos, "a")
+	b := createPlayer(t, repos, "b")
+	c := createPlayer(t, repos, "c")
+	playGame := func(one, two domain.PlayerResponse, oneHand, twoHand domain.Hand) {
+		t.Helper()
+		game := createGame(t, repos, domain.GameCreateRequest{TotalRounds: 1, PlayerOneID: one.ID, PlayerTwoID: two.ID})
+		round := createRound(t, repos, game.ID)
+		mustPlay(t, repos, game.ID, round.ID, one.ID, oneHand)
+		mustPlay(t, repos, game.ID, round.ID, two.ID, twoHand)
+	}
+	// a against b in both seats, and a game against c that must not count
+	playGame(a, b, domain.Rock, domain.Scissors)
+	playGame(b, a, domain.Paper, domain.Rock)
+	playGame(a, c, domain.Paper, domain.Rock)
+
+	var ab, ba domain.PlayerStats
+	if err := repos.Players.GetStats(context.Background(), a.ID, b.ID, &ab); err != nil {
+		t.Fatal(err)
+	}
+	if err := repos.Players.GetStats(context.Background(), b.ID, a.ID, &ba); err != nil {
+		t.Fatal(err)
+	}
+	if ab.OpponentID != b.ID || ab.GamesPlayed != 2 || ab.GamesWon != 1 || ab.GamesLost != 1 || ab.RoundsPlayed != 2 {
+		t.Fatalf("a against b = %+v", ab)
+	}
+	if len(ab.Hands) != 1 || ab.Hands[0].Hand != domain.Rock || ab.Hands[0].Played != 2 {
+		t.Fatalf("a's hands against b = %+v", ab.Hands)
+	}
+	if ba.GamesWon != 1 || ba.GamesLost != 1 || len(ba.Hands) != 2 {
+		t.Fatalf("b against a = %+v", ba)
+	}
+}
+
+func listGames(t *testing.T, repos Repositories, filter domain.GameFilter) []int {
+	t.Helper()
+	if filter.Limit == 0 {
+		filter.Limit = 100
+	}
+	var games []domain.GameResponse
+	if err := repos.Games.List(context.Background(), filter, &games); err != nil {
+		t.Fatalf("List %+v: %v", filter, err)
+	}
+	ids := []int{}
+	for _, g := range games {
+		ids = append(ids, g.ID)
+	}
+	return ids
+}
+
+func sameIDs(got []int, want ...int) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func testGameListFilters(t *testing.T, repos Repositories) {
+	a := createPlayer(t, repos, "a")
+	b := createPlayer(t, repos, "b")
+	c := createPlayer(t, repos, "c")
+	// a beats b, c beats a, a and c still playing
+	won := createGame(t, repos, domain.GameCreateRequest{TotalRounds: 1, PlayerOneID: a.ID, PlayerTwoID: b.ID})
+	lost := createGame(t, repos, domain.GameCreateRequest{TotalRounds: 1, PlayerOneID: c.ID, PlayerTwoID: a.ID})
+	open := createGame(t, repos, domain.GameCreateRequest{TotalRounds: 3, PlayerOneID: a.ID, PlayerTwoID: c.ID})
+	bc := createGame(t, repos, domain.GameCreateRequest{TotalRounds: 1, PlayerOneID: b.ID, PlayerTwoID: c.ID})
+	for _, g := range []struct {
+		id     int
+		winner int
+		loser  int
+	}{{won.ID, a.ID, b.ID}, {lost.ID, c.ID, a.ID}} {
+		round := createRound(t, repos, g.id)
+		mustPlay(t, repos, g.id, round.ID, g.winner, domain.Paper)
+		mustPlay(t, repos, g.id, round.ID, g.loser, domain.Rock)
+	}
+
+	tests := []struct {
+		name   string
+		filter domain.GameFilter
+		want   []int
+	}{
+		{"all", domain.GameFilter{}, []int{won.ID, lost.ID, open.ID, bc.ID}},
+		{"player", domain.GameFilter{PlayerID: a.ID}, []int{won.ID, lost.ID, open.ID}},
+		{"opponent", domain.GameFilter{PlayerID: a.ID, OpponentID: c.ID}, []int{lost.ID, open.ID}},
+		{"finished", domain.GameFilter{PlayerID: a.ID, Status: domain.GameStatusFinished}, []int{won.ID, lost.ID}},
+		{"in progress", domain.GameFilter{Status: domain.GameStatusInProgress}, []int{open.ID, bc.ID}},
+		{"won", domain.GameFilter{PlayerID: a.ID, Result: domain.GameResultWon}, []int{won.ID}},
+		{"lost", domain.GameFilter{PlayerID: a.ID, Result: domain.GameResultLost}, []int{lost.ID}},
+		{"from", domain.GameFilter{CreatedFrom: won.CreatedAt}, []int{won.ID, lost.ID, open.ID, bc.ID}},
+		{"to", domain.GameFilter{CreatedTo: won.CreatedAt}, []int{}},
+		{"to future", domain.GameFilter{CreatedTo: time.Now().Add(time.Hour)}, []int{won.ID, lost.ID, open.ID, bc.ID}},
+	}
+	for _, tt := range tests {
+		if got := listGames(t, repos, tt.filter); !sameIDs(got, tt.want...) {
+			t.Errorf("%s: List = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func testGameListPaging(t *testing.T, repos Repositories) {
+	a := createPlayer(t, repos, "a")
+	b := createPlayer(t, repos, "b")
+	var want []int
+	for i := 0; i < 5; i++ {
+		want = append(want, createGame(t, repos, domain.GameCreateRequest{TotalRounds: 1, PlayerOneID: a.ID, PlayerTwoID: b.ID}).ID)
+	}
+
+	var got []int
+	filter := domain.GameFilter{PlayerID: a.ID, Limit: 2}
+	for pages := 0; pages < 10; pages++ {
+		var games []domain.GameResponse
+		if err := repos.Games.List(context.Background(), filter, &games); err != nil {
+			t.Fatal(err)
+		}
+		if len(games) > filter.Limit {
+			t.Fatalf("page of %d games, limit %d", len(games), filter.Limit)
+		}
+		for _, g := range games {
+			got = append(got, g.ID)
+		}
+		if len(games) < filter.Limit {
+			break
+		}
+		last := games[len(games)-1]
+		filter.After = &domain.Cursor{CreatedAt: last.CreatedAt, ID: last.ID}
+	}
+	if !sameIDs(got, want...) {
+		t.Fatalf("paged through %v, want %v", got, want)
+	}
+}
+
+func testGameListByPlayer(t *testing.T, repos Repositories) {
+	a := createPlayer(t, repos, "a")
+	b := createPlayer(t, repos, "b")
+	c := createPlayer(t, repos, "c")
+	first := createGame(t, repos, domain.GameCreateRequest{TotalRounds: 1, PlayerOneID: a.ID, PlayerTwoID: b.ID})
+	createGame(t, repos, domain.GameCreateRequest{TotalRounds: 1, PlayerOneID: b.ID, PlayerTwoID: c.ID})
+	third := createGame(t, repos, domain.GameCreateRequest{TotalRounds: 1, PlayerOneID: c.ID, PlayerTwoID: a.ID})
+
+	var games []domain.GameResponse
+	if err := repos.Games.List(context.Background(), domain.GameFilter{PlayerID: a.ID, Limit: 10}, &games); err != nil {
+		t.Fatal(err)
+	}
+	if len(games) != 2 || games[0].ID != first.ID || games[1].ID != third.ID {
+		t.Fatalf("List = %+v, want games %d then %d", games, first.ID, third.ID)
+	}
+}
+
+func testGameCreateAndGet(t *testing.T, repos Repositories) {
+	a := createPlayer(t, repos, "a")
+	b := createPlayer(t, repos, "b")
+	created := createGame(t, repos, domain.GameCreateRequest{
+		TotalRounds: 5,
+		PlayerOneID: a.ID,
+		PlayerTwoID: b.ID,
+		TiePolicy:   domain.TiePolicySuddenDeath,
+		RuleSet:     domain.RuleSetRPSLS,
+	})
+	if created.ID == 0 || created.CurrentRound != 1 || created.CreatedAt.IsZero() {
+		t.Fatalf("created game = %+v", created)
+	}
+
+	got := getGame(t, repos, created.ID)
+	if got.TotalRounds != 5 || got.PlayerOneId != a.ID || got.PlayerTwoId != b.ID {
+		t.Fatalf("Get = %+v", got)
+	}
+	if got.Mode != domain.GameModeBestOf || got.TargetScore != 3 || got.TiePolicy != domain.TiePolicySuddenDeath {
+		t.Fatalf("mode settings = %q/%d/%q", got.Mode, got.TargetScore, got.TiePolicy)
+	}
+	if got.RuleSet != domain.RuleSetRPSLS || got.Weapons.String() != "rock, paper, scissors, spock, lizard" {
+		t.Fatalf("rules = %q %v", got.RuleSet, got.Weapons)
+	}
+	if got.Finished || got.Winner != 0 || got.PlayerOneScore != 0 || got.PlayerTwoScore != 0 {
+		t.Fatalf("new game state = %+v", got)
+	}
+}
+
+func testGameUnknownID(t *testing.T, repos Repositories) {
+	var game domain.GameResponse
+	err := repos.Games.Get(context.Background(), 4242, &game)
+	if !errors.Is(err, domain.ErrGameNotFound) {
+		t.Fatalf("Get unknown game: err = %v, want ErrGameNotFound", err)
+	}
+
+	a := createPlayer(t, repos, "a")
+	var created domain.GameCreateResponse
+	req := domain.GameCreateRequest{TotalRounds: 1, PlayerOneID: a.ID, PlayerTwoID: 4242, RuleSet: domain.RuleSetClassic, Weapons: domain.ClassicRules().Hands()}
+	for _, req := range []domain.GameCreateRequest{req, {TotalRounds: 1, PlayerOneID: 4242, PlayerTwoID: a.ID, RuleSet: domain.RuleSetClassic, Weapons: domain.ClassicRules().Hands()}} {
+		err = repos.Games.Create(context.Background(), req, &created)
+		if !errors.Is(err, domain.ErrPlayerNotFound) || !strings.Contains(err.Error(), "4242") {
+			t.Fatalf("Create with unknown player: err = %v, want ErrPlayerNotFound for 4242", err)
+		}
+	}
+}
+
+func testRoundCreateAndGet(t *testing.T, repos Repositories) {
+	a := createPlayer(t, repos, "a")
+	b := createPlayer(t, repos, "b")
+	game := createGame(t, repos, domain.GameCreateRequest{TotalRounds: 3, PlayerOneID: a.ID, PlayerTwoID: b.ID})
+
+	created := createRound(t, repos, game.ID)
+	if created.ID == 0 || created.GameID != game.ID || created.Count != 1 {
+		t.Fatalf("created round = %+v", created)
+	}
+	if created.PlayerOneID != a.ID || created.PlayerTwoID != b.ID {
+		t.Fatalf("round players = %d, %d", created.PlayerOneID, created.PlayerTwoID)
+	}
+
+	got := getRound(t, repos, created.ID)
+	if got != created {
+		t.Fatalf("Get = %+v, want %+v", got, created)
+	}
+	if !got.PlayerOneHand.IsNone() || !got.PlayerTwoHand.IsNone() || got.Finished {
+		t.Fatalf("new round state = %+v", got)
+	}
+}
+
+func testRoundUnknownIDs(t *testing.T, repos Repositories) {
+	a := createPlayer(t, repos, "a")
+	b := createPlayer(t, repos, "b")
+	game := createGame(t, repos, domain.GameCreateRequest{TotalRounds: 3, PlayerOneID: a.ID, PlayerTwoID: b.ID})
+	other := createGame(t, repos, domain.GameCreateRequest{TotalRounds: 3, PlayerOneID: a.ID, PlayerTwoID: b.ID})
+	round := createRound(t, repos, game.ID)
+
+	var got domain.RoundContext
+	if err := repos.Rounds.Get(context.Background(), 4242, &got); !errors.Is(err, domain.ErrRoundNotFound) {
+		t.Fatalf("Get unknown round: err = %v, want ErrRoundNotFound", err)
+	}
+	missing := domain.RoundContext{GameID: 4242}
+	if err := repos.Rounds.Create(context.Background(), &missing); !errors.Is(err, domain.ErrGameNotFound) {
+		t.Fatalf("Create for unknown game: err = %v, want ErrGameNotFound", err)
+	}
+	if err := play(repos, 4242, round.ID, a.ID, domain.Rock); !errors.Is(err, domain.ErrGameNotFound) {
+		t.Fatalf("Update for unknown game: err = %v, want ErrGameNotFound", err)
+	}
+	// a round is only reachable through its own game
+	if err := play(repos, other.ID, round.ID, a.ID, domain.Rock); !errors.Is(err, domain.ErrRoundNotFound) {
+		t.Fatalf("Update through the wrong game: err = %v, want ErrRoundNotFound", err)
+	}
+}
+
+func testRoundListByGame(t *testing.T, repos Repositories) {
+	ctx := context.Background()
+	a := createPlayer(t, repos, "a")
+	b := createPlayer(t, repos, "b")
+	game := createGame(t, repos, domain.GameCreateRequest{TotalRounds: 3, PlayerOneID: a.ID, PlayerTwoID: b.ID, TiePolicy: domain.TiePolicyReplay})
+	other := createGame(t, repos, domain.GameCreateRequest{TotalRounds: 1, PlayerOneID: a.ID, PlayerTwoID: b.ID})
+
+	if got := getGame(t, repos, game.ID); got.Rounds == nil || len(got.Rounds) != 0 {
+		t.Fatalf("rounds of a new game = %#v, want empty", got.Rounds)
+	}
+
+	tie := createRound(t, repos, game.ID)
+	mustPlay(t, repos, game.ID, tie.ID, a.ID, domain.Rock)
+	mustPlay(t, repos, game.ID, tie.ID, b.ID, domain.Rock)
+	createRound(t, repos, other.ID)
+	replay := createRound(t, repos, game.ID)
+	mustPlay(t, repos, game.ID, replay.ID, a.ID, domain.Paper)
+
+	var rounds []domain.RoundContext
+	if err := repos.Rounds.ListByGame(ctx, game.ID, &rounds); err != nil {
+		t.Fatal(err)
+	}
+	if len(rounds) != 2 || rounds[0].ID != tie.ID || rounds[1].ID != replay.ID {
+		t.Fatalf("ListByGame = %+v, want rounds %d then %d", rounds, tie.ID, replay.ID)
+	}
+	if rounds[0].PlayerOneHand != domain.Rock || !rounds[0].Finished || rounds[1].PlayerOneHand != domain.Paper || rounds[1].Finished {
+		t.Fatalf("ListByGame = %+v", rounds)
+	}
+
+	got := getGame(t, repos, game.ID)
+	if len(got.Rounds) != 2 || got.Rounds[0] != rounds[0] || got.Rounds[1] != rounds[1] {
+		t.Fatalf("game rounds = %+v, want %+v", got.Rounds, rounds)
+	}
+
+	err := repos.Rounds.ListByGame(ctx, 4242, &rounds)
+	if !errors.Is(err, domain.ErrGameNotFound) {
+		t.Fatalf("ListByGame unknown game: err = %v, want ErrGameNotFound", err)
+	}
+}
+
+func testRoundUpdateRollsBackOnError(t *testing.T, repos Repositories) {
+	a := createPlayer(t, repos, "a")
+	b := createPlayer(t, repos, "b")
+	game := createGame(t, repos, domain.GameCreateRequest{TotalRounds: 3, PlayerOneID: a.ID, PlayerTwoID: b.ID})
+	round := createRound(t, repos, game.ID)
+
+	boom := errors.New("boom")
+	err := repos.Rounds.Update(context.Background(), game.ID, round.ID, func(g *domain.GameResponse, r *domain.RoundContext) error {
+		r.PlayerOneHand = domain.Rock
+		g.PlayerOneScore = 99
+		return boom
+	})
+	if !errors.Is(err, boom) {
+		t.Fatalf("Update err = %v, want the callback's error", err)
+	}
+	if got := getRound(t, repos, round.ID); !got.PlayerOneHand.IsNone() {
+		t.Fatalf("round saved despite error: %+v", got)
+	}
+	if got := getGame(t, repos, game.ID); got.PlayerOneScore != 0 {
+		t.Fatalf("game saved despite error: %+v", got)
+	}
+}
+
+func testRoundTieReplay(t *testing.T, repos Repositories) {
+	a := createPlayer(t, repos, "a")
+	b := createPlayer(t, repos, "b")
+	game := createGame(t, repos, domain.GameCreateRequest{TotalRounds: 1, PlayerOneID: a.ID, PlayerTwoID: b.ID, TiePolicy: domain.TiePolicyReplay})
+	round := createRound(t, repos, game.ID)
+
+	mustPlay(t, repos, game.ID, round.ID, a.ID, domain.Rock)
+	mustPlay(t, repos, game.ID, round.ID, b.ID, domain.Rock)
+
+	tied := getRound(t, repos, round.ID)
+	if !tied.Finished || tied.Winner != 0 {
+		t.Fatalf("tied round = %+v", tied)
+	}
+	if g := getGame(t, repos, game.ID); g.CurrentRound != 1 || g.Finished {
+		t.Fatalf("game after replayed tie = %+v", g)
+	}
+	if replay := createRound(t, repos, game.ID); replay.Count != 1 {
+		t.Fatalf("replayed round count = %d, want 1", replay.Count)
+	}
+}
+
+func testRoundCommitReveal(t *testing.T, repos Repositories) {
+	a := createPlayer(t, repos, "a")
+	b := createPlayer(t, repos, "b")
+	game := createGame(t, repos, domain.GameCreateRequest{TotalRounds: 1, PlayerOneID: a.ID, PlayerTwoID: b.ID, CommitReveal: true})
+	if got := getGame(t, repos, game.ID); !got.CommitReveal {
+		t.Fatalf("game = %+v, want commit_reveal", got)
+	}
+	round := createRound(t, repos, game.ID)
+
+	commit := func(playerID int, commitment string) {
+		t.Helper()
+		err := repos.Rounds.Update(context.Background(), game.ID, round.ID, func(game *domain.GameResponse, round *domain.RoundContext) error {
+			if err := round.SetCurrentPlayer(playerID); err != nil {
+				return err
+			}
+			return round.SetCommitmentOnCurrentPlayer(commitment)
+		})
+		if err != nil {
+			t.Fatalf("commit %d: %v", playerID, err)
+		}
+	}
+	reveal := func(playerID int, hand domain.Hand, nonce string) {
+		t.Helper()
+		err := repos.Rounds.Update(context.Background(), game.ID, round.ID, func(game *domain.GameResponse, round *domain.RoundContext) error {
+			if err := round.SetCurrentPlayer(playerID); err != nil {
+				return err
+			}
+			if err := round.SetNonceOnCurrentPlayer(nonce); err != nil {
+				return err
+			}
+			return playHand(game, round, playerID, hand)
+		})
+		if err != nil {
+			t.Fatalf("reveal %d: %v", playerID, err)
+		}
+	}
+
+	aCommitment := domain.HandCommitment(domain.Paper, "a-nonce")
+	bCommitment := domain.HandCommitment(domain.Rock, "b-nonce")
+	commit(a.ID, aCommitment)
+	commit(b.ID, bCommitment)
+	got := getRound(t, repos, round.ID)
+	if !got.BothCommitted() || got.HasPlayerOnePlayed() || got.HasPlayerTwoPlayed() {
+		t.Fatalf("committed round = %+v", got)
+	}
+	reveal(a.ID, domain.Paper, "a-nonce")
+	reveal(b.ID, domain.Rock, "b-nonce")
+
+	got = getRound(t, repos, round.ID)
+	if !got.Finished || got.Winner != a.ID {
+		t.Fatalf("revealed round = %+v", got)
+	}
+	if got.PlayerOneCommitment != aCommitment || got.PlayerTwoCommitment != bCommitment ||
+		got.PlayerOneNonce != "a-nonce" || got.PlayerTwoNonce != "b-nonce" {
+		t.Fatalf("round audit trail = %+v", got)
+	}
+}
+
+func testGameFinishes(t *testing.T, repos Repositories) {
+	a := createPlayer(t, repos, "a")
+	b := createPlayer(t, repos, "b")
+	game := createGame(t, repos, domain.GameCreateRequest{TotalRounds: 3, PlayerOneID: a.ID, PlayerTwoID: b.ID})
+
+	for i := 0; i < 2; i++ {
+		round := createRound(t, repos, game.ID)
+		mustPlay(t, repos, game.ID, round.ID, a.ID, domain.Paper)
+		mustPlay(t, repos, game.ID, round.ID, b.ID, domain.Rock)
+		if got := getRound(t, repos, round.ID); got.Winner != a.ID || !got.Finished {
+			t.Fatalf("round %d = %+v", i+1, got)
+		}
+	}
+
+	got := getGame(t, repos, game.ID)
+	if !got.Finished || got.Winner != a.ID || got.PlayerOneScore != 2 || got.PlayerTwoScore != 0 || got.CurrentRound != 3 {
+		t.Fatalf("game after 2-0 in a best of 3 = %+v", got)
+	}
+	round := domain.RoundContext{GameID: game.ID}
+	if err := repos.Rounds.Create(context.Background(), &round); !errors.Is(err, domain.ErrGameFinished) {
+		t.Fatalf("Create on a finished game: err = %v, want ErrGameFinished", err)
+	}
+}
+
+// playRated plays like play and, if the move finishes the game, hands the
+// repository the new ratings to save with it: the winner gains 16 points and
+// the loser drops 16, as Elo with a K-factor of 32 has it between new players.
+func playRated(t *testing.T, repos Repositories, gameID int, roundID int, playerID int, hand domain.Hand) {
+	t.Helper()
+	err := repos.Rounds.Update(context.Background(), gameID, roundID, func(game *domain.GameResponse, round *domain.RoundContext) error {
+		if err := playHand(game, round, playerID, hand); err != nil {
+			return err
+		}
+		rate(game)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("player %d plays %s: %v", playerID, hand, err)
+	}
+}
+
+func rate(game *domain.GameResponse) {
+	if !game.Finished {
+		return
+	}
+	one, two := game.Ratings.PlayerOne, game.Ratings.PlayerTwo
+	if game.Winner == game.PlayerOneId {
+		one.Rating, two.Rating = one.Rating+16, two.Rating-16
+	} else {
+		one.Rating, two.Rating = one.Rating-16, two.Rating+16
+	}
+	game.Ratings = domain.GameRatings{System: domain.RatingSystemElo, PlayerOne: one, PlayerTwo: two}
+}
+
+func ratingHistory(t *testing.T, repos Repositories, playerID int) []domain.RatingChange {
+	t.Helper()
+	var history []domain.RatingChange
+	if err := repos.Players.ListRatingHistory(context.Background(), playerID, &history); err != nil {
+		t.Fatalf("rating history of %d: %v", playerID, err)
+	}
+	return history
+}
+
+func testGameRatings(t *testing.T, repos Repositories) {
+	a := createPlayer(t, repos, "a")
+	b := createPlayer(t, repos, "b")
+	if a.Rating != domain.DefaultPlayerRating() {
+		t.Fatalf("new player rating = %+v, want %+v", a.Rating, domain.DefaultPlayerRating())
+	}
+	// ratings only move when the game finishes
+	game := createGame(t, repos, domain.GameCreateRequest{TotalRounds: 3, PlayerOneID: a.ID, PlayerTwoID: b.ID})
+	for i := 0; i < 2; i++ {
+		round := createRound(t, repos, game.ID)
+		playRated(t, repos, game.ID, round.ID, a.ID, domain.Paper)
+		playRated(t, repos, game.ID, round.ID, b.ID, domain.Rock)
+		if i == 0 && len(ratingHistory(t, repos, a.ID)) != 0 {
+			t.Fatal("rating history written before the game finished")
+		}
+	}
+
+	want := map[int]float64{a.ID: 1516, b.ID: 1484}
+	for id, rating := range want {
+		var player domain.PlayerResponse
+		if err := repos.Players.Get(context.Background(), id, &player); err != nil {
+			t.Fatal(err)
+		}
+		if player.Rating.Rating != rating || player.Rating.Deviation != domain.DefaultRatingDeviation {
+			t.Fatalf("player %d rating = %+v, want %v", id, player.Rating, rating)
+		}
+		history := ratingHistory(t, repos, id)
+		if len(history) != 1 {
+			t.Fatalf("player %d history = %+v, want one entry", id, history)
+		}
+		change := history[0]
+		if change.GameID != game.ID || change.System != domain.RatingSystemElo ||
+			change.Before != domain.DefaultPlayerRating() || change.After != player.Rating || change.CreatedAt.IsZero() {
+			t.Fatalf("player %d history entry = %+v", id, change)
+		}
+	}
+	if got := ratingHistory(t, repos, a.ID)[0]; got.OpponentID != b.ID || got.Score != 1 {
+		t.Fatalf("winner's entry = %+v, want opponent %d and score 1", got, b.ID)
+	}
+	if got := ratingHistory(t, repos, b.ID)[0]; got.OpponentID != a.ID || got.Score != 0 {
+		t.Fatalf("loser's entry = %+v, want opponent %d and score 0", got, a.ID)
+	}
+
+	// a rejected finishing move rates nobody
+	rematch := createGame(t, repos, domain.GameCreateRequest{TotalRounds: 1, PlayerOneID: a.ID, PlayerTwoID: b.ID})
+	round := createRound(t, repos, rematch.ID)
+	playRated(t, repos, rematch.ID, round.ID, a.ID, domain.Rock)
+	err := repos.Rounds.Update(context.Background(), rematch.ID, round.ID, func(game *domain.GameResponse, round *domain.RoundContext) error {
+		if err := playHand(game, round, b.ID, domain.Paper); err != nil {
+			return err
+		}
+		rate(game)
+		return errors.New("boom")
+	})
+	if err == nil {
+		t.Fatal("Update with a failing fn: err = nil")
+	}
+	if got := len(ratingHistory(t, repos, b.ID)); got != 1 {
+		t.Fatalf("history after a rolled back finish has %d entries, want 1", got)
+	}
+}
+
+func testConcurrentPlays(t *testing.T, repos Repositories) {
+	a := createPlayer(t, repos, "a")
+	b := createPlayer(t, repos, "b")
+	game := createGame(t, repos, domain.GameCreateRequest{TotalRounds: 3, PlayerOneID: a.ID, PlayerTwoID: b.ID})
+	round := createRound(t, repos, game.ID)
+
+	var wg sync.WaitGroup
+	errs := make([]error, 2)
+	for i, p := range []struct {
+		id   int
+		hand domain.Hand
+	}{{a.ID, domain.Scissors}, {b.ID, domain.Paper}} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = play(repos, game.ID, round.ID, p.id, p.hand)
+		}()
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			t.Fatalf("concurrent play: %v", err)
+		}
+	}
+
+	got := getGame(t, repos, game.ID)
+	if got.CurrentRound != 2 || got.PlayerOneScore != 1 || got.PlayerTwoScore != 0 {
+		t.Fatalf("game after one round = %+v, want current_round 2 and score 1-0", got)
+	}
+}
+
+// finishGame plays a one round game between one and two. The hands decide
+// who wins it, or that it is drawn.
+func finishGame(t *testing.T, repos Repositories, one int, oneHand domain.Hand, two int, twoHand domain.Hand) {
+	t.Helper()
+	game := createGame(t, repos, domain.GameCreateRequest{TotalRounds: 1, PlayerOneID: one, PlayerTwoID: two})
+	round := createRound(t, repos, game.ID)
+	mustPlay(t, repos, game.ID, round.ID, one, oneHand)
+	mustPlay(t, repos, game.ID, round.ID, two, twoHand)
+	if got := getGame(t, repos, game.ID); !got.Finished {
+		t.Fatalf("game %d did not finish: %+v", game.ID, got)
+	}
+}
+
+func listLeaderboard(t *testing.T, repos Repositories, filter domain.LeaderboardFilter) []domain.LeaderboardEntry {
+	t.Helper()
+	if err := filter.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	var entries []domain.LeaderboardEntry
+	if err := repos.Leaderboard.List(context.Background(), filter, &entries); err != nil {
+		t.Fatalf("list leaderboard %+v: %v", filter, err)
+	}
+	return entries
+}
+
+func testLeaderboard(t *testing.T, repos Repositories) {
+	a := createPlayer(t, repos, "a")
+	b := createPlayer(t, repos, "b")
+	c := createPlayer(t, repos, "c")
+	createPlayer(t, repos, "idle")
+	finishGame(t, repos, a.ID, domain.Paper, b.ID, domain.Rock)
+	finishGame(t, repos, a.ID, domain.Paper, b.ID, domain.Rock)
+	finishGame(t, repos, c.ID, domain.Rock, a.ID, domain.Scissors)
+	finishGame(t, repos, b.ID, domain.Rock, c.ID, domain.Rock)
+
+	if got := listLeaderboard(t, repos, domain.LeaderboardFilter{}); len(got) != 0 {
+		t.Fatalf("leaderboard before the first refresh = %+v, want none", got)
+	}
+	now := time.Now().UTC()
+	if err := repos.Leaderboard.Refresh(context.Background(), now, 3); err != nil {
+		t.Fatal(err)
+	}
+
+	players := func(entries []domain.LeaderboardEntry) []int {
+		ids := []int{}
+		for i, e := range entries {
+			if e.Rank != i+1 {
+				t.Fatalf("entry %d has rank %d: %+v", i, e.Rank, entries)
+			}
+			ids = append(ids, e.PlayerID)
+		}
+		return ids
+	}
+	for _, tt := range []struct {
+		sort string
+		want []int
+	}{
+		// no game was rated, so ratings tie and ids decide
+		{domain.LeaderboardSortRating, []int{a.ID, b.ID, c.ID}},
+		{domain.LeaderboardSortWins, []int{a.ID, c.ID, b.ID}},
+		// c has two games, below the minimum of three
+		{domain.LeaderboardSortWinRate, []int{a.ID, b.ID}},
+		{domain.LeaderboardSortStreak, []int{a.ID, c.ID, b.ID}},
+	} {
+		got := listLeaderboard(t, repos, domain.LeaderboardFilter{Sort: tt.sort})
+		if !sameIDs(players(got), tt.want...) {
+			t.Errorf("sort %s = %+v, want players %v", tt.sort, got, tt.want)
+		}
+	}
+
+	top := listLeaderboard(t, repos, domain.LeaderboardFilter{Sort: domain.LeaderboardSortWins, Limit: 1})
+	want := domain.LeaderboardEntry{
+		Rank: 1, PlayerID: a.ID, UserName: "a", Rating: domain.DefaultRating,
+		GamesPlayed: 3, GamesWon: 2, GamesLost: 1, WinRate: 0.6667, LongestWinStreak: 2,
+		Window: domain.LeaderboardWindowAll, RatingRank: 1, WinsRank: 1, WinRateRank: 1, StreakRank: 1,
+	}
+	if len(top) != 1 || top[0].RefreshedAt.IsZero() {
+		t.Fatalf("top of the wins board = %+v", top)
+	}
+	top[0].RefreshedAt = time.Time{}
+	if top[0] != want {
+		t.Fatalf("top of the wins board = %+v, want %+v", top[0], want)
+	}
+	next := listLeaderboard(t, repos, domain.LeaderboardFilter{Sort: domain.LeaderboardSortWins, Limit: 1, After: &domain.Cursor{ID: 1}})
+	if len(next) != 1 || next[0].PlayerID != c.ID || next[0].Rank != 2 {
+		t.Fatalf("second page of the wins board = %+v, want player %d at rank 2", next, c.ID)
+	}
+
+	// the same games, seen from eight days on, fall out of the weekly window
+	if err := repos.Leaderboard.Refresh(context.Background(), now.Add(8*24*time.Hour), 3); err != nil {
+		t.Fatal(err)
+	}
+	if got := listLeaderboard(t, repos, domain.LeaderboardFilter{Window: domain.LeaderboardWindowWeek}); len(got) != 0 {
+		t.Fatalf("weekly board = %+v, want none", got)
+	}
+	if got := listLeaderboard(t, repos, domain.LeaderboardFilter{Window: domain.LeaderboardWindowMonth}); len(got) != 3 {
+		t.Fatalf("monthly board = %+v, want 3 players", got)
+	}
+}
+
+func testLeaderboardStreaks(t *testing.T, repos Repositories) {
+	d := createPlayer(t, repos, "d")
+	e := createPlayer(t, repos, "e")
+	// d wins, loses, wins three, draws and wins; the unfinished game does not
+	// break a run
+	finishGame(t, repos, d.ID, domain.Paper, e.ID, domain.Rock)
+	finishGame(t, repos, d.ID, domain.Rock, e.ID, domain.Paper)
+	finishGame(t, repos, d.ID, domain.Paper, e.ID, domain.Rock)
+	createGame(t, repos, domain.GameCreateRequest{TotalRounds: 1, PlayerOneID: d.ID, PlayerTwoID: e.ID})
+	finishGame(t, repos, e.ID, domain.Rock, d.ID, domain.Paper)
+	finishGame(t, repos, d.ID, domain.Scissors, e.ID, domain.Paper)
+	finishGame(t, repos, d.ID, domain.Rock, e.ID, domain.Rock)
+	finishGame(t, repos, d.ID, domain.Paper, e.ID, domain.Rock)
+
+	if err := repos.Leaderboard.Refresh(context.Background(), time.Now().UTC(), 1); err != nil {
+		t.Fatal(err)
+	}
+	got := listLeaderboard(t, repos, domain.LeaderboardFilter{Sort: domain.LeaderboardSortStreak})
+	if len(got) != 2 {
+		t.Fatalf("streak board = %+v, want 2 players", got)
+	}
+	for i, want := range []domain.LeaderboardEntry{
+		{PlayerID: d.ID, GamesPlayed: 7, GamesWon: 5, GamesLost: 1, GamesDrawn: 1, WinRate: 0.7143, LongestWinStreak: 3},
+		{PlayerID: e.ID, GamesPlayed: 7, GamesWon: 1, GamesLost: 5, GamesDrawn: 1, WinRate: 0.1429, LongestWinStreak: 1},
+	} {
+		entry := got[i]
+		if entry.PlayerID != want.PlayerID || entry.GamesPlayed != want.GamesPlayed || entry.GamesWon != want.GamesWon ||
+			entry.GamesLost != want.GamesLost || entry.GamesDrawn != want.GamesDrawn || entry.WinRate != want.WinRate ||
+			entry.LongestWinStreak != want.LongestWinStreak {
+			t.Errorf("entry %d = %+v, want %+v", i+1, entry, want)
+		}
+	}
+}
+
+func testGameEvents(t *testing.T, repos Repositories) {
+	ctx := context.Background()
+	a := createPlayer(t, repos, "a")
+	b := createPlayer(t, repos, "b")
+	c := createPlayer(t, repos, "c")
+	first := createGame(t, repos, domain.GameCreateRequest{TotalRounds: 1, PlayerOneID: a.ID, PlayerTwoID: b.ID})
+	second := createGame(t, repos, domain.GameCreateRequest{TotalRounds: 1, PlayerOneID: b.ID, PlayerTwoID: c.ID})
+	firstRound := createRound(t, repos, first.ID)
+	secondRound := createRound(t, repos, second.ID)
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	// interleave the games so their seqs and the global ids diverge
+	var appended []domain.GameEvent
+	move := func(gameID int, roundID int, playerID int, hand domain.Hand) {
+		t.Helper()
+		mustPlay(t, repos, gameID, roundID, playerID, hand)
+		game := getGame(t, repos, gameID)
+		round := getRound(t, repos, roundID)
+		gameEvents := []domain.GameEvent{{Type: domain.EventHandPlayed, RoundID: round.ID, PlayerID: playerID}}
+		if round.Finished {
+			score := &domain.Score{
+				PlayerOne: domain.PlayerScore{PlayerID: game.PlayerOneId, Score: game.PlayerOneScore},
+				PlayerTwo: domain.PlayerScore{PlayerID: game.PlayerTwoId, Score: game.PlayerTwoScore},
+			}
+			gameEvents = append(gameEvents,
+				domain.GameEvent{Type: domain.EventRoundResolved, RoundID: round.ID, Round: &round},
+				domain.GameEvent{Type: domain.EventScoreChanged, Score: score})
+			if game.Finished {
+				gameEvents = append(gameEvents, domain.GameEvent{Type: domain.EventGameFinished, Score: score, Winner: game.Winner})
+			}
+		}
+		for i := range gameEvents {
+			gameEvents[i].GameID, gameEvents[i].PlayerOneID, gameEvents[i].PlayerTwoID = game.ID, game.PlayerOneId, game.PlayerTwoId
+			gameEvents[i].Time = now
+		}
+		if err := repos.Events.Append(ctx, gameEvents); err != nil {
+			t.Fatalf("append %+v: %v", gameEvents, err)
+		}
+		appended = append(appended, gameEvents...)
+	}
+	move(first.ID, firstRound.ID, a.ID, domain.Rock)
+	move(second.ID, secondRound.ID, b.ID, domain.Paper)
+	move(first.ID, firstRound.ID, b.ID, domain.Scissors)
+
+	var seqs []int
+	for i, event := range appended {
+		if i > 0 && event.ID <= appended[i-1].ID {
+			t.Fatalf("event ids do not increase: %+v", appended)
+		}
+		if event.GameID == first.ID {
+			seqs = append(seqs, event.Seq)
+		} else if event.Seq != 1 {
+			t.Fatalf("only event of game %d has seq %d", second.ID, event.Seq)
+		}
+	}
+	// hand_played, then the winning move's hand_played, round_resolved,
+	// score_changed and game_finished
+	if !reflect.DeepEqual(seqs, []int{1, 2, 3, 4, 5}) {
+		t.Fatalf("seqs of game %d = %v, want 1 to 5", first.ID, seqs)
+	}
+
+	var byGame []domain.GameEvent
+	if err := repos.Events.ListByGame(ctx, first.ID, 2, &byGame); err != nil {
+		t.Fatal(err)
+	}
+	want := appended[3:]
+	if !reflect.DeepEqual(byGame, want) {
+		t.Fatalf("events of game %d after seq 2 = %+v, want %+v", first.ID, byGame, want)
+	}
+	if byGame[0].Round == nil || byGame[0].Round.PlayerOneHand != domain.Rock {
+		t.Fatalf("round_resolved lost its round: %+v", byGame[0])
+	}
+
+	var byPlayer []domain.GameEvent
+	if err := repos.Events.ListByPlayer(ctx, c.ID, 0, &byPlayer); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(byPlayer, appended[1:2]) {
+		t.Fatalf("events of player %d = %+v, want %+v", c.ID, byPlayer, appended[1:2])
+	}
+	byPlayer = nil
+	if err := repos.Events.ListByPlayer(ctx, b.ID, appended[1].ID, &byPlayer); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(byPlayer, appended[2:]) {
+		t.Fatalf("events of player %d after id %d = %+v, want %+v", b.ID, appended[1].ID, byPlayer, appended[2:])
+	}
+}
+
+func createWebhook(t *testing.T, repos Repositories, playerID int, events ...string) domain.Webhook {
+	t.Helper()
+	req := domain.WebhookCreateRequest{PlayerID: playerID, URL: "http://example.com/hook", Events: events, Secret: "secret"}
+	var webhook domain.Webhook
+	if err := repos.Webhooks.Create(context.Background(), req, &webhook); err != nil {
+		t.Fatalf("create webhook: %v", err)
+	}
+	return webhook
+}
+
+func testWebhookUnknownPlayer(t *testing.T, repos Repositories) {
+	req := domain.WebhookCreateRequest{PlayerID: 4242, URL: "http://example.com/hook", Secret: "secret"}
+	var webhook domain.Webhook
+	err := repos.Webhooks.Create(context.Background(), req, &webhook)
+	if !errors.Is(err, domain.ErrPlayerNotFound) || !strings.Contains(err.Error(), "4242") {
+		t.Fatalf("Create for unknown player: err = %v, want ErrPlayerNotFound for 4242", err)
+	}
+}
+
+func testWebhooks(t *testing.T, repos Repositories) {
+	ctx := context.Background()
+	a := createPlayer(t, repos, "a")
+	b := createPlayer(t, repos, "b")
+	all := createWebhook(t, repos, a.ID)
+	finished := createWebhook(t, repos, a.ID, domain.EventRoundResolved, domain.EventGameFinished)
+	createWebhook(t, repos, b.ID)
+	if all.ID == 0 || all.CreatedAt.IsZero() || all.Secret != "secret" {
+		t.Fatalf("created webhook = %+v", all)
+	}
+
+	var got domain.Webhook
+	if err := repos.Webhooks.Get(ctx, finished.ID, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.PlayerID != a.ID || got.URL != "http://example.com/hook" || got.Secret != "secret" ||
+		!reflect.DeepEqual(got.Events, domain.WebhookEvents{domain.EventRoundResolved, domain.EventGameFinished}) {
+		t.Fatalf("get webhook = %+v", got)
+	}
+
+	var mine []domain.Webhook
+	if err := repos.Webhooks.ListByPlayer(ctx, a.ID, &mine); err != nil {
+		t.Fatal(err)
+	}
+	if len(mine) != 2 || mine[0].ID != all.ID || mine[1].ID != finished.ID {
+		t.Fatalf("webhooks of player %d = %+v", a.ID, mine)
+	}
+	if mine[0].Events == nil || len(mine[0].Events) != 0 {
+		t.Fatalf("webhook for every event has events %#v, want empty", mine[0].Events)
+	}
+
+	if err := repos.Webhooks.Delete(ctx, all.ID); err != nil {
+		t.Fatal(err)
+	}
+	for _, err := range []error{repos.Webhooks.Get(ctx, all.ID, &got), repos.Webhooks.Delete(ctx, all.ID)} {
+		if !errors.Is(err, domain.ErrWebhookNotFound) {
+			t.Fatalf("deleted webhook: err = %v, want %v", err, domain.ErrWebhookNotFound)
+		}
+	}
+}
+
+func testWebhookDeliveries(t *testing.T, repos Repositories) {
+	ctx := context.Background()
+	a := createPlayer(t, repos, "a")
+	b := createPlayer(t, repos, "b")
+	c := createPlayer(t, repos, "c")
+	all := createWebhook(t, repos, a.ID)
+	finished := createWebhook(t, repos, b.ID, domain.EventGameFinished)
+	outsider := createWebhook(t, repos, c.ID)
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	played := domain.GameEvent{ID: 7, Seq: 1, Type: domain.EventHandPlayed, GameID: 1, PlayerOneID: a.ID, PlayerTwoID: b.ID, PlayerID: a.ID, Time: now}
+	over := domain.GameEvent{ID: 8, Seq: 2, Type: domain.EventGameFinished, GameID: 1, PlayerOneID: a.ID, PlayerTwoID: b.ID, Winner: a.ID, Time: now}
+	for _, event := range []domain.GameEvent{played, over} {
+		if err := repos.Webhooks.Enqueue(ctx, event, now); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	due := func(at time.Time) []domain.WebhookDelivery {
+		t.Helper()
+		var deliveries []domain.WebhookDelivery
+		if err := repos.Webhooks.ListDue(ctx, at, 10, &deliveries); err != nil {
+			t.Fatal(err)
+		}
+		return deliveries
+	}
+	queued := due(now)
+	type target struct {
+		webhook int
+		event   int
+	}
+	var targets []target
+	for _, d := range queued {
+		if d.Status != domain.DeliveryPending || d.Attempts != 0 {
+			t.Fatalf("queued delivery = %+v", d)
+		}
+		targets = append(targets, target{d.WebhookID, d.EventID})
+	}
+	// the outsider is in neither game; finished only wants game_finished
+	if want := []target{{all.ID, 7}, {all.ID, 8}, {finished.ID, 8}}; !reflect.DeepEqual(targets, want) {
+		t.Fatalf("queued deliveries %v, want %v", targets, want)
+	}
+	var payload domain.GameEvent
+	if err := json.Unmarshal(queued[1].Payload, &payload); err != nil || !reflect.DeepEqual(payload, over) {
+		t.Fatalf("payload %s = %+v (%v), want %+v", queued[1].Payload, payload, err, over)
+	}
+	if got := due(now.Add(-time.Minute)); len(got) != 0 {
+		t.Fatalf("due before they were queued: %+v", got)
+	}
+
+	retry := queued[0]
+	retry.Attempts, retry.NextAttemptAt = 1, now.Add(30*time.Second)
+	if err := repos.Webhooks.RecordAttempt(ctx, retry, domain.WebhookAttempt{Attempt: 1, StatusCode: 500, DurationMS: 12, AttemptedAt: now}); err != nil {
+		t.Fatal(err)
+	}
+	done := queued[1]
+	done.Attempts, done.Status, done.NextAttemptAt = 1, domain.DeliverySucceeded, time.Time{}
+	if err := repos.Webhooks.RecordAttempt(ctx, done, domain.WebhookAttempt{Attempt: 1, StatusCode: 204, DurationMS: 3, AttemptedAt: now}); err != nil {
+		t.Fatal(err)
+	}
+	if got := due(now); len(got) != 1 || got[0].ID != queued[2].ID {
+		t.Fatalf("due after the attempts = %+v, want only delivery %d", got, queued[2].ID)
+	}
+	if got := due(now.Add(time.Minute)); len(got) != 2 || got[0].ID != queued[2].ID || got[1].ID != retry.ID {
+		t.Fatalf("due a minute on = %+v, want deliveries %d and %d", got, queued[2].ID, retry.ID)
+	}
+
+	list := func(filter domain.WebhookDeliveryFilter) []domain.WebhookDelivery {
+		t.Helper()
+		if err := filter.Validate(); err != nil {
+			t.Fatal(err)
+		}
+		var deliveries []domain.WebhookDelivery
+		if err := repos.Webhooks.ListDeliveries(ctx, all.ID, filter, &deliveries); err != nil {
+			t.Fatal(err)
+		}
+		return deliveries
+	}
+	history := list(domain.WebhookDeliveryFilter{})
+	if len(history) != 2 || history[0].ID != done.ID || history[1].ID != retry.ID {
+		t.Fatalf("deliveries of webhook %d = %+v, want %d then %d", all.ID, history, done.ID, retry.ID)
+	}
+	if h := history[0]; h.Status != domain.DeliverySucceeded || h.Attempts != 1 || !h.NextAttemptAt.IsZero() {
+		t.Fatalf("succeeded delivery = %+v", h)
+	}
+	h := history[1]
+	if h.Status != domain.DeliveryPending || !h.NextAttemptAt.Equal(now.Add(30*time.Second)) || len(h.History) != 1 {
+		t.Fatalf("retried delivery = %+v", h)
+	}
+	if at := h.History[0]; at.Attempt != 1 || at.StatusCode != 500 || at.DurationMS != 12 || !at.AttemptedAt.Equal(now) {
+		t.Fatalf("attempt = %+v", at)
+	}
+	if next := list(domain.WebhookDeliveryFilter{Limit: 1, After: &domain.Cursor{ID: done.ID}}); len(next) != 1 || next[0].ID != retry.ID {
+		t.Fatalf("page after delivery %d = %+v", done.ID, next)
+	}
+
+	var none []domain.WebhookDelivery
+	if err := repos.Webhooks.ListDeliveries(ctx, outsider.ID, domain.WebhookDeliveryFilter{Limit: 10}, &none); err != nil || len(none) != 0 {
+		t.Fatalf("deliveries of the outsider = %+v, %v", none, err)
+	}
+	// deleting a webhook drops its queue
+	if err := repos.Webhooks.Delete(ctx, all.ID); err != nil {
+		t.Fatal(err)
+	}
+	if got := due(now.Add(time.Hour)); len(got) != 1 || got[0].WebhookID != finished.ID {
+		t.Fatalf("due after deleting webhook %d = %+v", all.ID, got)
+	}
+}
@@ -0,0 +1,25 @@
+package sqlite
+
+import "testing"
+
+func TestWithDefaults(t *testing.T) {
+	tests := []struct {
+		dsn  string
+		want string
+	}{
+		{"rps.db", "rps.db?_txlock=immediate&_foreign_keys=on&_busy_timeout=5000"},
+		{"rps.db?", "rps.db?_txlock=immediate&_foreign_keys=on&_busy_timeout=5000"},
+		{"file:rps.db?cache=shared", "file:rps.db?cache=shared&_txlock=immediate&_foreign_keys=on&_busy_timeout=5000"},
+		{"file:rps.db?_fk=off&_timeout=10", "file:rps.db?_fk=off&_timeout=10&_txlock=immediate"},
+		{"rps.db?_txlock=deferred&_foreign_keys=on&_busy_timeout=1", "rps.db?_txlock=deferred&_foreign_keys=on&_busy_timeout=1"},
+	}
+	for _, tt := range tests {
+		got, err := withDefaults(tt.dsn)
+		if err != nil || got != tt.want {
+			t.Errorf("withDefaults(%q) = %q, %v; want %q", tt.dsn, got, err, tt.want)
+		}
+	}
+	if _, err := withDefaults("rps.db?cache=%zz"); err == nil {
+		t.Error("malformed query was accepted")
+	}
+}
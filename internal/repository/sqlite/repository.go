@@ -0,0 +1,80 @@
+package sqlite
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/ellisbywater/http-rock-paper-scissors/internal/domain"
+	"github.com/ellisbywater/http-rock-paper-scissors/internal/repository"
+	"github.com/mattn/go-sqlite3"
+)
+
+// The repositories are the shared SQL ones from package repository; only the
+// dialect below is SQLite's own.
+
+func NewPlayerRepository(db *sql.DB) domain.PlayerRepository {
+	return repository.NewPlayerRepository(db, dialect{})
+}
+
+func NewGameRepository(db *sql.DB) domain.GameRepository {
+	return repository.NewGameRepository(db, dialect{})
+}
+
+func NewRoundRepository(db *sql.DB) domain.RoundRepository {
+	return repository.NewRoundRepository(db, dialect{})
+}
+
+func NewLeaderboardRepository(db *sql.DB) domain.LeaderboardRepository {
+	return repository.NewLeaderboardRepository(db, dialect{})
+}
+
+func NewGameEventRepository(db *sql.DB) domain.GameEventRepository {
+	return repository.NewGameEventRepository(db, dialect{})
+}
+
+func NewWebhookRepository(db *sql.DB) domain.WebhookRepository {
+	return repository.NewWebhookRepository(db, dialect{})
+}
+
+type dialect struct{}
+
+func (dialect) Placeholder(n int) string {
+	return "?"
+}
+
+// ForUpdate is empty: SQLite cannot lock rows, but every transaction takes
+// the write lock when it begins (see Open), which serialises writers just as
+// well.
+func (dialect) ForUpdate() string {
+	return ""
+}
+
+// Timestamp formats t the way CURRENT_TIMESTAMP stores it, so timestamp
+// columns can be compared as text.
+func (dialect) Timestamp(t time.Time) any {
+	return t.UTC().Format("2006-01-02 15:04:05")
+}
+
+// SnapshotIsolation is the default: a SQLite transaction always reads from
+// one snapshot.
+func (dialect) SnapshotIsolation() sql.IsolationLevel {
+	return sql.LevelDefault
+}
+
+func (dialect) TranslateError(err error) error {
+	var sqliteErr sqlite3.Error
+	if !errors.As(err, &sqliteErr) {
+		return err
+	}
+	if sqliteErr.ExtendedCode != sqlite3.ErrConstraintUnique {
+		return err
+	}
+	// SQLite names the columns of the violated constraint only in the message
+	switch strings.TrimPrefix(sqliteErr.Error(), "UNIQUE constraint failed: ") {
+	case "players.username":
+		return domain.ErrUsernameTaken
+	}
+	return err
+}
@@ -0,0 +1,76 @@
+// Package sqlite stores players, games and rounds in a single SQLite file so
+// the server can run without a Postgres container.
+package sqlite
+
+import (
+	"database/sql"
+	"fmt"
+	"net/url"
+	"strings"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// defaultParams are added to every DSN that does not set them (or one of
+// their aliases) itself.
+var defaultParams = []struct {
+	names []string
+	value string
+}{
+	// transactions take the write lock up front, which gives the same
+	// serialisation the Postgres backend gets from SELECT ... FOR UPDATE
+	{[]string{"_txlock"}, "immediate"},
+	{[]string{"_foreign_keys", "_fk"}, "on"},
+	{[]string{"_busy_timeout", "_timeout"}, "5000"},
+}
+
+// Open opens (creating if needed) the SQLite database at dsn. The schema is
+// applied separately by the migrate package.
+func Open(dsn string) (*sql.DB, error) {
+	dsn, err := withDefaults(dsn)
+	if err != nil {
+		return nil, err
+	}
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// withDefaults appends each of defaultParams that dsn leaves out, keeping
+// the parameters it does have as they are.
+func withDefaults(dsn string) (string, error) {
+	_, query, _ := strings.Cut(dsn, "?")
+	params, err := url.ParseQuery(query)
+	if err != nil {
+		return "", fmt.Errorf("sqlite dsn %q: %w", dsn, err)
+	}
+	var missing []string
+	for _, param := range defaultParams {
+		set := false
+		for _, name := range param.names {
+			if params.Has(name) {
+				set = true
+			}
+		}
+		if !set {
+			missing = append(missing, param.names[0]+"="+param.value)
+		}
+	}
+	if len(missing) == 0 {
+		return dsn, nil
+	}
+	separator := "&"
+	switch {
+	case !strings.Contains(dsn, "?"):
+		separator = "?"
+	case query == "" || strings.HasSuffix(query, "&"):
+		separator = ""
+	}
+	return dsn + separator + strings.Join(missing, "&"), nil
+}
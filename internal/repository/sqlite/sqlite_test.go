@@ -0,0 +1,36 @@
+package sqlite_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/ellisbywater/http-rock-paper-scissors/internal/migrate"
+	"github.com/ellisbywater/http-rock-paper-scissors/internal/repository/repositorytest"
+	"github.com/ellisbywater/http-rock-paper-scissors/internal/repository/sqlite"
+)
+
+func TestRepositories(t *testing.T) {
+	repositorytest.Run(t, func(t *testing.T) repositorytest.Repositories {
+		db, err := sqlite.Open(filepath.Join(t.TempDir(), "rps.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { db.Close() })
+		migrator, err := migrate.New(db, migrate.DialectSQLite)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := migrator.Up(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		return repositorytest.Repositories{
+			Players:     sqlite.NewPlayerRepository(db),
+			Games:       sqlite.NewGameRepository(db),
+			Rounds:      sqlite.NewRoundRepository(db),
+			Leaderboard: sqlite.NewLeaderboardRepository(db),
+			Events:      sqlite.NewGameEventRepository(db),
+			Webhooks:    sqlite.NewWebhookRepository(db),
+		}
+	})
+}
@@ -0,0 +1,130 @@
+package service
+
+import (
+	"github.com/ellisbywater/http-rock-paper-scissors/internal/domain"
+)
+
+// The game engine owns the rules of play. It only works on domain values, so
+// it behaves the same whichever repository loaded and saves them.
+
+// PlayHand records playerID's hand on the round and, once both hands are in,
+// resolves the round and applies the result to the game.
+func PlayHand(game *domain.GameResponse, round *domain.RoundContext, playerID int, hand domain.Hand) error {
+	if game.CommitReveal {
+		return domain.ErrCommitRequired
+	}
+	rules, err := prepareMove(game, round, playerID, hand)
+	if err != nil {
+		return err
+	}
+	if err := round.SetHandOnCurrentPlayer(hand); err != nil {
+		return err
+	}
+
+	ResolveRound(game, round, rules)
+	return nil
+}
+
+// CommitHand records playerID's commitment in a commit-reveal game.
+func CommitHand(game *domain.GameResponse, round *domain.RoundContext, playerID int, commitment string) error {
+	if !game.CommitReveal {
+		return domain.ErrNotCommitReveal
+	}
+	if game.Finished {
+		return domain.ErrGameFinished
+	}
+	if round.Finished {
+		return domain.ErrRoundFinished
+	}
+	commitment, err := domain.ParseCommitment(commitment)
+	if err != nil {
+		return err
+	}
+	if err := round.SetCurrentPlayer(playerID); err != nil {
+		return domain.ErrNotParticipant
+	}
+	if round.CurrentPlayerCommitment() != "" {
+		return domain.ErrAlreadyCommitted
+	}
+	return round.SetCommitmentOnCurrentPlayer(commitment)
+}
+
+// RevealHand opens playerID's commitment in a commit-reveal game. The hand is
+// only accepted once both players have committed and if it matches the
+// commitment; the round resolves when the second hand is revealed.
+func RevealHand(game *domain.GameResponse, round *domain.RoundContext, playerID int, hand domain.Hand, nonce string) error {
+	if !game.CommitReveal {
+		return domain.ErrNotCommitReveal
+	}
+	rules, err := prepareMove(game, round, playerID, hand)
+	if err != nil {
+		return err
+	}
+	if !round.BothCommitted() {
+		return domain.ErrCommitmentPending
+	}
+	if err := domain.VerifyCommitment(round.CurrentPlayerCommitment(), hand, nonce); err != nil {
+		return err
+	}
+	if err := round.SetHandOnCurrentPlayer(hand); err != nil {
+		return err
+	}
+	if err := round.SetNonceOnCurrentPlayer(nonce); err != nil {
+		return err
+	}
+
+	ResolveRound(game, round, rules)
+	return nil
+}
+
+// prepareMove runs the checks shared by every way of playing a hand and makes
+// playerID the round's current player.
+func prepareMove(game *domain.GameResponse, round *domain.RoundContext, playerID int, hand domain.Hand) (domain.RuleSet, error) {
+	if game.Finished {
+		return nil, domain.ErrGameFinished
+	}
+	if round.Finished {
+		return nil, domain.ErrRoundFinished
+	}
+	rules, err := game.Rules()
+	if err != nil {
+		return nil, err
+	}
+	if err := rules.Validate(hand); err != nil {
+		return nil, err
+	}
+
+	if err := round.SetCurrentPlayer(playerID); err != nil {
+		return nil, domain.ErrNotParticipant
+	}
+	if round.CurrentPlayer == round.PlayerOneID && round.HasPlayerOnePlayed() {
+		return nil, domain.ErrRoundAlreadyPlayed
+	}
+	if round.CurrentPlayer == round.PlayerTwoID && round.HasPlayerTwoPlayed() {
+		return nil, domain.ErrRoundAlreadyPlayed
+	}
+	return rules, nil
+}
+
+// ResolveRound settles a round once both players have played: the round gets
+// its winner (0 on a tie) and the game its new score, round counter and status.
+func ResolveRound(game *domain.GameResponse, round *domain.RoundContext, rules domain.RuleSet) {
+	if round.Finished || !round.HasPlayerOnePlayed() || !round.HasPlayerTwoPlayed() {
+		return
+	}
+	winner := round.CalculateWinner(rules)
+	round.Winner = winner.PlayerID
+	round.Finished = true
+	game.ApplyRoundResult(round.Winner)
+}
+
+// RateGame works out both players' new ratings once the game is finished. The
+// repository saves them along with the move that finished the game.
+func RateGame(game *domain.GameResponse, system domain.RatingSystem) {
+	if !game.Finished || system == nil {
+		return
+	}
+	score := domain.ScoreFor(game, game.PlayerOneId)
+	one, two := system.Rate(game.Ratings.PlayerOne, game.Ratings.PlayerTwo, score)
+	game.Ratings = domain.GameRatings{System: system.Name(), PlayerOne: one, PlayerTwo: two}
+}
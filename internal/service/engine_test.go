@@ -0,0 +1,332 @@
+package service_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/ellisbywater/http-rock-paper-scissors/internal/domain"
+	"github.com/ellisbywater/http-rock-paper-scissors/internal/service"
+)
+
+const (
+	one     = 1
+	two     = 2
+	outside = 3
+)
+
+func newGame() *domain.GameResponse {
+	return &domain.GameResponse{
+		ID:           1,
+		PlayerOneId:  one,
+		PlayerTwoId:  two,
+		CurrentRound: 1,
+		TotalRounds:  3,
+		Mode:         domain.GameModeBestOf,
+		TargetScore:  2,
+		TiePolicy:    domain.TiePolicyCount,
+		RuleSet:      domain.RuleSetClassic,
+	}
+}
+
+func newRound(game *domain.GameResponse) *domain.RoundContext {
+	return &domain.RoundContext{GameID: game.ID, Count: game.CurrentRound, PlayerOneID: one, PlayerTwoID: two}
+}
+
+// Nonces for commit-reveal games, 128 bits each.
+const (
+	nonce1 = "00112233445566778899aabbccddeeff"
+	nonce2 = "ffeeddccbbaa99887766554433221100"
+	nonce3 = "0123456789abcdef0123456789abcdef"
+)
+
+// move is one call to PlayHand.
+type move struct {
+	player int
+	hand   domain.Hand
+}
+
+func TestPlayHand(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(game *domain.GameResponse, round *domain.RoundContext)
+		moves []move
+		// err is what the last move returns
+		err error
+		// the round and game after the moves
+		roundFinished bool
+		roundWinner   int
+		score         [2]int
+		currentRound  int
+	}{
+		{name: "first hand waits for the second", moves: []move{{one, domain.Rock}}, currentRound: 1},
+		{name: "second hand wins the round", moves: []move{{one, domain.Rock}, {two, domain.Paper}}, roundFinished: true, roundWinner: two, score: [2]int{0, 1}, currentRound: 2},
+		{name: "either player may go first", moves: []move{{two, domain.Scissors}, {one, domain.Rock}}, roundFinished: true, roundWinner: one, score: [2]int{1, 0}, currentRound: 2},
+		{name: "a tie finishes the round", moves: []move{{one, domain.Rock}, {two, domain.Rock}}, roundFinished: true, currentRound: 2},
+		{name: "playing twice", moves: []move{{one, domain.Rock}, {one, domain.Paper}}, err: domain.ErrRoundAlreadyPlayed, currentRound: 1},
+		{name: "outsider", moves: []move{{outside, domain.Rock}}, err: domain.ErrNotParticipant, currentRound: 1},
+		{name: "hand outside the rule set", moves: []move{{one, domain.Lizard}}, err: domain.ErrInvalidHand, currentRound: 1},
+		{
+			name:          "hand from the game's rule set",
+			setup:         func(game *domain.GameResponse, round *domain.RoundContext) { game.RuleSet = domain.RuleSetRPSLS },
+			moves:         []move{{one, domain.Lizard}, {two, domain.Spock}},
+			roundFinished: true, roundWinner: one, score: [2]int{1, 0}, currentRound: 2,
+		},
+		{
+			name:         "finished game",
+			setup:        func(game *domain.GameResponse, round *domain.RoundContext) { game.Finished = true },
+			moves:        []move{{one, domain.Rock}},
+			err:          domain.ErrGameFinished,
+			currentRound: 1,
+		},
+		{
+			name:          "finished round",
+			setup:         func(game *domain.GameResponse, round *domain.RoundContext) { round.Finished = true },
+			moves:         []move{{one, domain.Rock}},
+			err:           domain.ErrRoundFinished,
+			roundFinished: true,
+			currentRound:  1,
+		},
+		{
+			name:         "commit-reveal game",
+			setup:        func(game *domain.GameResponse, round *domain.RoundContext) { game.CommitReveal = true },
+			moves:        []move{{one, domain.Rock}},
+			err:          domain.ErrCommitRequired,
+			currentRound: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			game := newGame()
+			round := newRound(game)
+			if tt.setup != nil {
+				tt.setup(game, round)
+			}
+			var err error
+			for i, m := range tt.moves {
+				err = service.PlayHand(game, round, m.player, m.hand)
+				if err != nil && i < len(tt.moves)-1 {
+					t.Fatalf("move %d: %v", i+1, err)
+				}
+			}
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("PlayHand() error = %v, want %v", err, tt.err)
+			}
+			if round.Finished != tt.roundFinished || round.Winner != tt.roundWinner {
+				t.Errorf("round finished=%v winner=%d, want finished=%v winner=%d", round.Finished, round.Winner, tt.roundFinished, tt.roundWinner)
+			}
+			if score := [2]int{game.PlayerOneScore, game.PlayerTwoScore}; score != tt.score || game.CurrentRound != tt.currentRound {
+				t.Errorf("game score=%v current_round=%d, want score=%v current_round=%d", score, game.CurrentRound, tt.score, tt.currentRound)
+			}
+		})
+	}
+}
+
+func TestPlayHandKeepsTheRejectedHand(t *testing.T) {
+	game := newGame()
+	round := newRound(game)
+	if err := service.PlayHand(game, round, one, domain.Rock); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.PlayHand(game, round, one, domain.Paper); !errors.Is(err, domain.ErrRoundAlreadyPlayed) {
+		t.Fatalf("second hand error = %v", err)
+	}
+	if round.PlayerOneHand != domain.Rock || round.HasPlayerTwoPlayed() {
+		t.Fatalf("hands = %s/%s, want rock/none", round.PlayerOneHand, round.PlayerTwoHand)
+	}
+}
+
+func TestPlayHandFinishesTheGame(t *testing.T) {
+	game := newGame()
+	for _, winner := range []int{one, two, one} {
+		round := newRound(game)
+		hands := map[int]domain.Hand{one: domain.Rock, two: domain.Scissors}
+		if winner == two {
+			hands[one], hands[two] = domain.Scissors, domain.Rock
+		}
+		for _, player := range []int{one, two} {
+			if err := service.PlayHand(game, round, player, hands[player]); err != nil {
+				t.Fatalf("round %d: %v", round.Count, err)
+			}
+		}
+	}
+	if !game.Finished || game.Winner != one || game.PlayerOneScore != 2 || game.PlayerTwoScore != 1 {
+		t.Fatalf("game = %+v, want won 2-1 by player one", game)
+	}
+	if err := service.PlayHand(game, newRound(game), one, domain.Rock); !errors.Is(err, domain.ErrGameFinished) {
+		t.Fatalf("move after the game finished: %v", err)
+	}
+}
+
+func TestCommitReveal(t *testing.T) {
+	game := newGame()
+	game.CommitReveal = true
+	round := newRound(game)
+
+	if err := service.CommitHand(game, round, one, "not hex"); !errors.Is(err, domain.ErrInvalidCommitment) {
+		t.Fatalf("malformed commitment: %v", err)
+	}
+	if err := service.CommitHand(game, round, outside, domain.HandCommitment(domain.Rock, nonce3)); !errors.Is(err, domain.ErrNotParticipant) {
+		t.Fatalf("outsider commit: %v", err)
+	}
+	if err := service.CommitHand(game, round, one, domain.HandCommitment(domain.Rock, nonce1)); err != nil {
+		t.Fatal(err)
+	}
+	if err := service.CommitHand(game, round, one, domain.HandCommitment(domain.Paper, nonce1)); !errors.Is(err, domain.ErrAlreadyCommitted) {
+		t.Fatalf("second commit: %v", err)
+	}
+	if err := service.RevealHand(game, round, one, domain.Rock, nonce1); !errors.Is(err, domain.ErrCommitmentPending) {
+		t.Fatalf("reveal before both committed: %v", err)
+	}
+	if err := service.PlayHand(game, round, two, domain.Paper); !errors.Is(err, domain.ErrCommitRequired) {
+		t.Fatalf("plain play in a commit-reveal game: %v", err)
+	}
+	// commitments are normalised
+	upper := []byte(domain.HandCommitment(domain.Paper, nonce2))
+	for i, c := range upper {
+		if c >= 'a' && c <= 'f' {
+			upper[i] = c - 'a' + 'A'
+		}
+	}
+	if err := service.CommitHand(game, round, two, " "+string(upper)+" "); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := service.RevealHand(game, round, one, domain.Paper, nonce1); !errors.Is(err, domain.ErrCommitmentMismatch) {
+		t.Fatalf("reveal of another hand: %v", err)
+	}
+	if err := service.RevealHand(game, round, one, domain.Rock, nonce2); !errors.Is(err, domain.ErrCommitmentMismatch) {
+		t.Fatalf("reveal with another nonce: %v", err)
+	}
+	if err := service.RevealHand(game, round, one, domain.Rock, nonce1); err != nil {
+		t.Fatal(err)
+	}
+	if round.Finished || round.PlayerOneNonce != nonce1 {
+		t.Fatalf("round after one reveal = %+v", round)
+	}
+	if err := service.RevealHand(game, round, one, domain.Rock, nonce1); !errors.Is(err, domain.ErrRoundAlreadyPlayed) {
+		t.Fatalf("second reveal: %v", err)
+	}
+	if err := service.RevealHand(game, round, two, domain.Paper, nonce2); err != nil {
+		t.Fatal(err)
+	}
+	if !round.Finished || round.Winner != two || game.PlayerTwoScore != 1 || game.CurrentRound != 2 {
+		t.Fatalf("round = %+v, game = %+v, want round won by player two", round, game)
+	}
+}
+
+func TestRevealRejectsWeakNonces(t *testing.T) {
+	tests := []struct {
+		name  string
+		nonce string
+	}{
+		{"empty", ""},
+		{"short", "n1"},
+		{"one hex character short", nonce1[1:]},
+		{"not hex", "zz" + nonce1[2:]},
+		{"too long", strings.Repeat(nonce1, 5)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			game := newGame()
+			game.CommitReveal = true
+			round := newRound(game)
+			for _, player := range []int{one, two} {
+				if err := service.CommitHand(game, round, player, domain.HandCommitment(domain.Rock, tt.nonce)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := service.RevealHand(game, round, one, domain.Rock, tt.nonce); !errors.Is(err, domain.ErrInvalidNonce) {
+				t.Fatalf("RevealHand() error = %v, want %v", err, domain.ErrInvalidNonce)
+			}
+			if !round.PlayerOneHand.IsNone() || round.PlayerOneNonce != "" {
+				t.Fatalf("round after a rejected reveal = %+v", round)
+			}
+		})
+	}
+}
+
+func TestCommitHandOutsideCommitReveal(t *testing.T) {
+	game := newGame()
+	round := newRound(game)
+	if err := service.CommitHand(game, round, one, domain.HandCommitment(domain.Rock, nonce1)); !errors.Is(err, domain.ErrNotCommitReveal) {
+		t.Fatalf("CommitHand() error = %v", err)
+	}
+	if err := service.RevealHand(game, round, one, domain.Rock, nonce1); !errors.Is(err, domain.ErrNotCommitReveal) {
+		t.Fatalf("RevealHand() error = %v", err)
+	}
+}
+
+func TestResolveRound(t *testing.T) {
+	rpsls, err := domain.NewRuleSet(domain.RuleSetRPSLS, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name     string
+		one, two domain.Hand
+		finished bool
+		winner   int
+	}{
+		{"waits for player two", domain.Rock, domain.NoHand, false, 0},
+		{"waits for player one", domain.NoHand, domain.Spock, false, 0},
+		{"player one wins", domain.Spock, domain.Scissors, true, one},
+		{"player two wins", domain.Spock, domain.Lizard, true, two},
+		{"tie", domain.Lizard, domain.Lizard, true, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			game := newGame()
+			round := newRound(game)
+			round.PlayerOneHand, round.PlayerTwoHand = tt.one, tt.two
+			service.ResolveRound(game, round, rpsls)
+			if round.Finished != tt.finished || round.Winner != tt.winner {
+				t.Fatalf("round finished=%v winner=%d, want finished=%v winner=%d", round.Finished, round.Winner, tt.finished, tt.winner)
+			}
+			if want := 1 + btoi(tt.finished); game.CurrentRound != want {
+				t.Fatalf("current_round = %d, want %d", game.CurrentRound, want)
+			}
+		})
+	}
+
+	// a finished round is only resolved once
+	game := newGame()
+	round := newRound(game)
+	round.PlayerOneHand, round.PlayerTwoHand = domain.Rock, domain.Scissors
+	service.ResolveRound(game, round, rpsls)
+	service.ResolveRound(game, round, rpsls)
+	if game.PlayerOneScore != 1 || game.CurrentRound != 2 {
+		t.Fatalf("game after resolving twice = %+v", game)
+	}
+}
+
+func TestRateGame(t *testing.T) {
+	game := newGame()
+	game.Ratings.PlayerOne = domain.DefaultPlayerRating()
+	game.Ratings.PlayerTwo = domain.DefaultPlayerRating()
+	elo, err := domain.NewRatingSystem(domain.RatingSystemElo, 32)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	service.RateGame(game, elo)
+	if game.Ratings.System != "" {
+		t.Fatalf("unfinished game was rated: %+v", game.Ratings)
+	}
+	game.Finished, game.Winner = true, one
+	service.RateGame(game, nil)
+	if game.Ratings.System != "" {
+		t.Fatalf("game rated without a system: %+v", game.Ratings)
+	}
+	service.RateGame(game, elo)
+	if game.Ratings.System != elo.Name() || game.Ratings.PlayerOne.Rating != 1516 || game.Ratings.PlayerTwo.Rating != 1484 {
+		t.Fatalf("ratings = %+v, want 1516/1484", game.Ratings)
+	}
+}
+
+func btoi(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
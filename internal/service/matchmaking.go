@@ -0,0 +1,195 @@
+package service
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/ellisbywater/http-rock-paper-scissors/internal/domain"
+	"github.com/ellisbywater/http-rock-paper-scissors/internal/events"
+)
+
+// MatchmakingService keeps the matchmaking queue in memory: a restart empties
+// it and players join again. MatchEvery pairs the queue in the background.
+type MatchmakingService struct {
+	games   *GameService
+	players domain.PlayerRepository
+	bus     events.Publisher
+
+	mu sync.Mutex
+	// queue is in joining order. Tickets stay in it while their game is
+	// created, as matching, so Join, Leave and Status keep seeing them.
+	queue []*domain.MatchTicket
+	// last is each player's last ticket out of the queue, matched or failed,
+	// until they join again
+	last map[int]domain.MatchTicket
+}
+
+// NewMatchmakingService creates matched games with games and publishes each
+// match to bus, which may be nil.
+func NewMatchmakingService(games *GameService, players domain.PlayerRepository, bus events.Publisher) *MatchmakingService {
+	return &MatchmakingService{games: games, players: players, bus: bus, last: make(map[int]domain.MatchTicket)}
+}
+
+// Join puts the player in the queue at their current rating.
+func (ms *MatchmakingService) Join(ctx context.Context, playerID int, req domain.MatchRequest) (*domain.MatchTicket, error) {
+	var ticket domain.MatchTicket
+	if err := req.Validate(); err != nil {
+		return &ticket, err
+	}
+	var player domain.PlayerResponse
+	if err := ms.players.Get(ctx, playerID, &player); err != nil {
+		return &ticket, err
+	}
+	now := time.Now().UTC()
+	ticket = domain.MatchTicket{
+		PlayerID: playerID,
+		Status:   domain.MatchStatusQueued,
+		Request:  req,
+		Rating:   player.Rating.Rating,
+		Window:   domain.InitialMatchWindow,
+		JoinedAt: now,
+	}
+
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	if ms.indexOf(playerID) >= 0 {
+		return &ticket, domain.ErrAlreadyQueued
+	}
+	delete(ms.last, playerID)
+	queued := ticket
+	ms.queue = append(ms.queue, &queued)
+	return &ticket, nil
+}
+
+// Leave takes the player out of the queue. It is too late once they have
+// been paired and their game is being created.
+func (ms *MatchmakingService) Leave(ctx context.Context, playerID int) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	i := ms.indexOf(playerID)
+	if i < 0 {
+		return domain.ErrNotQueued
+	}
+	if ms.queue[i].Status == domain.MatchStatusMatching {
+		return domain.ErrMatchInProgress
+	}
+	ms.queue = append(ms.queue[:i], ms.queue[i+1:]...)
+	return nil
+}
+
+// Status returns the player's ticket: queued with their current rating
+// window, matching while their game is created, or their last match, or
+// failed with the reason their game could not be created.
+func (ms *MatchmakingService) Status(ctx context.Context, playerID int) (*domain.MatchTicket, error) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	if i := ms.indexOf(playerID); i >= 0 {
+		ticket := *ms.queue[i]
+		if ticket.Status == domain.MatchStatusQueued {
+			ticket.Window = domain.MatchWindow(ticket.JoinedAt, time.Now().UTC())
+		}
+		return &ticket, nil
+	}
+	if ticket, ok := ms.last[playerID]; ok {
+		return &ticket, nil
+	}
+	return &domain.MatchTicket{}, domain.ErrNotQueued
+}
+
+// indexOf is the player's position in the queue, or -1. Callers hold ms.mu.
+func (ms *MatchmakingService) indexOf(playerID int) int {
+	for i, ticket := range ms.queue {
+		if ticket.PlayerID == playerID {
+			return i
+		}
+	}
+	return -1
+}
+
+// Match pairs the queue as of now and creates a game for every pair. Paired
+// tickets are matching until their game is created; a pair whose game cannot
+// be created is queued again, until it has failed MaxMatchFailures times and
+// is taken out of the queue as failed.
+func (ms *MatchmakingService) Match(ctx context.Context, now time.Time) error {
+	ms.mu.Lock()
+	pairs := domain.PairTickets(ms.queue, now)
+	for _, pair := range pairs {
+		pair[0].Status, pair[1].Status = domain.MatchStatusMatching, domain.MatchStatusMatching
+	}
+	ms.mu.Unlock()
+
+	var failed error
+	for _, pair := range pairs {
+		game, err := ms.games.NewGame(ctx, pair[0].GameRequest(pair[1]))
+		if err != nil {
+			failed = err
+			ms.mu.Lock()
+			for _, ticket := range pair {
+				ms.fail(ticket, err)
+			}
+			ms.mu.Unlock()
+			continue
+		}
+		matchedAt := time.Now().UTC()
+		ms.mu.Lock()
+		for i, ticket := range pair {
+			ticket.Status = domain.MatchStatusMatched
+			ticket.Window = 0
+			ticket.GameID = game.ID
+			ticket.OpponentID = pair[1-i].PlayerID
+			ticket.MatchedAt = matchedAt
+			ms.last[ticket.PlayerID] = *ticket
+			ms.remove(ticket)
+		}
+		ms.mu.Unlock()
+		publish(ctx, ms.bus, events.MatchFound{Game: *game, Time: matchedAt})
+	}
+	return failed
+}
+
+// fail records that the ticket's game could not be created, and queues the
+// ticket again or gives it up. Only domain errors are shown to the player.
+// Callers hold ms.mu.
+func (ms *MatchmakingService) fail(ticket *domain.MatchTicket, err error) {
+	ticket.Failures++
+	ticket.Error = "the game could not be created"
+	if _, ok := domain.AsError(err); ok {
+		ticket.Error = err.Error()
+	}
+	if ticket.Failures < domain.MaxMatchFailures {
+		ticket.Status = domain.MatchStatusQueued
+		return
+	}
+	ticket.Status = domain.MatchStatusFailed
+	ticket.Window = 0
+	ms.last[ticket.PlayerID] = *ticket
+	ms.remove(ticket)
+}
+
+// remove takes the ticket out of the queue. Callers hold ms.mu.
+func (ms *MatchmakingService) remove(ticket *domain.MatchTicket) {
+	for i, queued := range ms.queue {
+		if queued == ticket {
+			ms.queue = append(ms.queue[:i], ms.queue[i+1:]...)
+			return
+		}
+	}
+}
+
+// MatchEvery pairs the queue every interval until ctx is done.
+func (ms *MatchmakingService) MatchEvery(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if err := ms.Match(ctx, now.UTC()); err != nil {
+				log.Printf("matchmaking: %v", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,260 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ellisbywater/http-rock-paper-scissors/internal/domain"
+	"github.com/ellisbywater/http-rock-paper-scissors/internal/repository/memory"
+	"github.com/ellisbywater/http-rock-paper-scissors/internal/service"
+)
+
+// newMatchmaking returns matchmaking over an empty memory store whose games
+// are created by games, or the store's own repository when nil, and the ids
+// of players a, b and c.
+func newMatchmaking(t *testing.T, games func(domain.GameRepository) domain.GameRepository) (*service.MatchmakingService, domain.GameRepository, [3]int) {
+	t.Helper()
+	store := memory.New()
+	players := memory.NewPlayerRepository(store)
+	var gameRepo domain.GameRepository = memory.NewGameRepository(store)
+	if games != nil {
+		gameRepo = games(gameRepo)
+	}
+	var ids [3]int
+	for i, name := range []string{"a", "b", "c"} {
+		var player domain.PlayerResponse
+		if err := players.Create(context.Background(), domain.PlayerCreateRequest{UserName: name}, &player); err != nil {
+			t.Fatal(err)
+		}
+		ids[i] = player.ID
+	}
+	return service.NewMatchmakingService(service.NewGameService(gameRepo, nil), players, nil), gameRepo, ids
+}
+
+func TestMatchmakingJoinLeaveStatus(t *testing.T) {
+	ctx := context.Background()
+	mm, _, ids := newMatchmaking(t, nil)
+	a := ids[0]
+
+	if _, err := mm.Join(ctx, a, domain.MatchRequest{TotalRounds: -1}); !errors.Is(err, domain.ErrInvalidMatchRequest) {
+		t.Fatalf("Join with a bad request: err = %v", err)
+	}
+	if _, err := mm.Join(ctx, 4242, domain.MatchRequest{}); !errors.Is(err, domain.ErrPlayerNotFound) {
+		t.Fatalf("Join of an unknown player: err = %v", err)
+	}
+	ticket, err := mm.Join(ctx, a, domain.MatchRequest{RuleSet: "RPSLS"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ticket.Status != domain.MatchStatusQueued || ticket.Rating != domain.DefaultRating ||
+		ticket.Window != domain.InitialMatchWindow || ticket.Request.RuleSet != domain.RuleSetRPSLS {
+		t.Fatalf("ticket = %+v", ticket)
+	}
+	if _, err := mm.Join(ctx, a, domain.MatchRequest{}); !errors.Is(err, domain.ErrAlreadyQueued) {
+		t.Fatalf("second Join: err = %v", err)
+	}
+	status, err := mm.Status(ctx, a)
+	if err != nil || status.Status != domain.MatchStatusQueued || status.PlayerID != a {
+		t.Fatalf("Status = %+v, %v", status, err)
+	}
+
+	if err := mm.Leave(ctx, a); err != nil {
+		t.Fatal(err)
+	}
+	if err := mm.Leave(ctx, a); !errors.Is(err, domain.ErrNotQueued) {
+		t.Fatalf("second Leave: err = %v", err)
+	}
+	if _, err := mm.Status(ctx, a); !errors.Is(err, domain.ErrNotQueued) {
+		t.Fatalf("Status after Leave: err = %v", err)
+	}
+}
+
+func TestMatchmakingMatch(t *testing.T) {
+	ctx := context.Background()
+	mm, games, ids := newMatchmaking(t, nil)
+	a, b, c := ids[0], ids[1], ids[2]
+	for _, join := range []struct {
+		id  int
+		req domain.MatchRequest
+	}{{a, domain.MatchRequest{TotalRounds: 5}}, {b, domain.MatchRequest{}}, {c, domain.MatchRequest{TotalRounds: 3}}} {
+		if _, err := mm.Join(ctx, join.id, join.req); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := mm.Match(ctx, time.Now().UTC()); err != nil {
+		t.Fatal(err)
+	}
+	one, err := mm.Status(ctx, a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	two, err := mm.Status(ctx, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if one.Status != domain.MatchStatusMatched || one.OpponentID != b || one.GameID == 0 || one.MatchedAt.IsZero() ||
+		two.Status != domain.MatchStatusMatched || two.OpponentID != a || two.GameID != one.GameID {
+		t.Fatalf("tickets after Match = %+v, %+v", one, two)
+	}
+	var game domain.GameResponse
+	if err := games.Get(ctx, one.GameID, &game); err != nil {
+		t.Fatal(err)
+	}
+	if game.PlayerOneId != a || game.PlayerTwoId != b || game.TotalRounds != 5 {
+		t.Fatalf("matched game = %+v, want a against b over 5 rounds", game)
+	}
+	// c wants 3 rounds, a 5, and b was taken
+	if status, err := mm.Status(ctx, c); err != nil || status.Status != domain.MatchStatusQueued {
+		t.Fatalf("c after Match = %+v, %v", status, err)
+	}
+
+	// matched players may queue again
+	if err := mm.Leave(ctx, a); !errors.Is(err, domain.ErrNotQueued) {
+		t.Fatalf("Leave after the match: err = %v", err)
+	}
+	if _, err := mm.Join(ctx, a, domain.MatchRequest{}); err != nil {
+		t.Fatal(err)
+	}
+	if status, err := mm.Status(ctx, a); err != nil || status.Status != domain.MatchStatusQueued || status.GameID != 0 {
+		t.Fatalf("a after joining again = %+v, %v", status, err)
+	}
+}
+
+// slowGames blocks Create until release is closed, after telling creating.
+type slowGames struct {
+	domain.GameRepository
+	creating chan struct{}
+	release  chan struct{}
+	err      error
+}
+
+func (g *slowGames) Create(ctx context.Context, req domain.GameCreateRequest, res *domain.GameCreateResponse) error {
+	g.creating <- struct{}{}
+	<-g.release
+	if g.err != nil {
+		return g.err
+	}
+	return g.GameRepository.Create(ctx, req, res)
+}
+
+func TestMatchmakingWhileTheGameIsCreated(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		err  error
+		// the status of both players once Create returns
+		want string
+	}{
+		{"created", nil, domain.MatchStatusMatched},
+		{"failed", errors.New("boom"), domain.MatchStatusQueued},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			games := &slowGames{creating: make(chan struct{}), release: make(chan struct{}), err: tt.err}
+			mm, _, ids := newMatchmaking(t, func(repo domain.GameRepository) domain.GameRepository {
+				games.GameRepository = repo
+				return games
+			})
+			a, b := ids[0], ids[1]
+			for _, id := range []int{a, b} {
+				if _, err := mm.Join(ctx, id, domain.MatchRequest{}); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			matched := make(chan error)
+			go func() { matched <- mm.Match(ctx, time.Now().UTC()) }()
+			<-games.creating
+
+			for _, id := range []int{a, b} {
+				if status, err := mm.Status(ctx, id); err != nil || status.Status != domain.MatchStatusMatching {
+					t.Fatalf("Status of %d while the game is created = %+v, %v", id, status, err)
+				}
+			}
+			if err := mm.Leave(ctx, a); !errors.Is(err, domain.ErrMatchInProgress) {
+				t.Fatalf("Leave while the game is created: err = %v", err)
+			}
+			if _, err := mm.Join(ctx, a, domain.MatchRequest{}); !errors.Is(err, domain.ErrAlreadyQueued) {
+				t.Fatalf("Join while the game is created: err = %v", err)
+			}
+			// a second run leaves the pair alone
+			if err := mm.Match(ctx, time.Now().UTC()); err != nil {
+				t.Fatal(err)
+			}
+
+			close(games.release)
+			if err := <-matched; !errors.Is(err, tt.err) {
+				t.Fatalf("Match() error = %v, want %v", err, tt.err)
+			}
+			for _, id := range []int{a, b} {
+				if status, err := mm.Status(ctx, id); err != nil || status.Status != tt.want {
+					t.Fatalf("Status of %d after Create = %+v, %v; want %s", id, status, err, tt.want)
+				}
+			}
+			if tt.err != nil {
+				if err := mm.Leave(ctx, a); err != nil {
+					t.Fatalf("Leave after a failed match: %v", err)
+				}
+			}
+		})
+	}
+}
+
+// failingGames fails every game it is asked to create.
+type failingGames struct {
+	domain.GameRepository
+}
+
+func (failingGames) Create(ctx context.Context, req domain.GameCreateRequest, res *domain.GameCreateResponse) error {
+	return errors.New("connection refused")
+}
+
+func TestMatchmakingGivesUpFailingMatches(t *testing.T) {
+	ctx := context.Background()
+	mm, _, ids := newMatchmaking(t, func(repo domain.GameRepository) domain.GameRepository {
+		return failingGames{repo}
+	})
+	a, b := ids[0], ids[1]
+	for _, id := range []int{a, b} {
+		if _, err := mm.Join(ctx, id, domain.MatchRequest{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for failures := 1; failures <= domain.MaxMatchFailures; failures++ {
+		if err := mm.Match(ctx, time.Now().UTC()); err == nil {
+			t.Fatal("Match() error = nil, want the repository's")
+		}
+		want := domain.MatchStatusQueued
+		if failures == domain.MaxMatchFailures {
+			want = domain.MatchStatusFailed
+		}
+		for _, id := range []int{a, b} {
+			status, err := mm.Status(ctx, id)
+			if err != nil || status.Status != want || status.Failures != failures {
+				t.Fatalf("Status of %d after %d failures = %+v, %v; want %s", id, failures, status, err, want)
+			}
+			// the driver's error stays in the log
+			if status.Error == "" || strings.Contains(status.Error, "connection refused") {
+				t.Fatalf("Status of %d reports error %q", id, status.Error)
+			}
+		}
+	}
+
+	// given up tickets are out of the queue
+	if err := mm.Match(ctx, time.Now().UTC()); err != nil {
+		t.Fatalf("Match() of an empty queue: %v", err)
+	}
+	if err := mm.Leave(ctx, a); !errors.Is(err, domain.ErrNotQueued) {
+		t.Fatalf("Leave after giving up: err = %v", err)
+	}
+	if _, err := mm.Join(ctx, a, domain.MatchRequest{}); err != nil {
+		t.Fatal(err)
+	}
+	if status, err := mm.Status(ctx, a); err != nil || status.Status != domain.MatchStatusQueued || status.Failures != 0 || status.Error != "" {
+		t.Fatalf("a after joining again = %+v, %v", status, err)
+	}
+}
@@ -2,33 +2,74 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log"
+	"strings"
+	"time"
 
 	"github.com/ellisbywater/http-rock-paper-scissors/internal/domain"
+	"github.com/ellisbywater/http-rock-paper-scissors/internal/events"
 )
 
 type GameService struct {
 	repo domain.GameRepository
+	bus  events.Publisher
 }
 
-func NewGameService(repo domain.GameRepository) *GameService {
-	return &GameService{repo: repo}
+// NewGameService publishes the games it creates to bus, which may be nil.
+func NewGameService(repo domain.GameRepository, bus events.Publisher) *GameService {
+	return &GameService{repo: repo, bus: bus}
 }
 
-func (gs *GameService) NewGame(ctx context.Context, total_rounds int, player_one_id int, player_two_id int) (*domain.GameCreateResponse, error) {
-	game_req := domain.GameCreateRequest{
-		TotalRounds: total_rounds,
-		PlayerOneID: player_one_id,
-		PlayerTwoID: player_two_id,
+// publish sends events to bus unless it is nil. Callers publish only after
+// the change the events describe is committed.
+func publish(ctx context.Context, bus events.Publisher, evs ...events.Event) {
+	if bus != nil {
+		bus.Publish(ctx, evs...)
 	}
+}
+
+func (gs *GameService) NewGame(ctx context.Context, game_req domain.GameCreateRequest) (*domain.GameCreateResponse, error) {
 	var game_res domain.GameCreateResponse
-	err := gs.repo.Create(ctx, game_req, &game_res)
+	if err := game_req.Validate(); err != nil {
+		return &game_res, err
+	}
+	rules, err := domain.NewRuleSet(game_req.RuleSet, game_req.Weapons)
 	if err != nil {
 		return &game_res, err
 	}
+	// store the resolved rule set so every round is judged the same way
+	game_req.RuleSet = rules.Name()
+	game_req.Weapons = rules.Hands()
+	err = gs.repo.Create(ctx, game_req, &game_res)
+	if err != nil {
+		return &game_res, err
+	}
+	publish(ctx, gs.bus, events.GameCreated{Game: game_res, Time: time.Now().UTC()})
 	return &game_res, nil
 }
 
+// ListGames returns a page of games. The repository is asked for one game
+// more than the page holds to learn whether another page follows.
+func (gs *GameService) ListGames(ctx context.Context, filter domain.GameFilter) (*domain.GamePage, error) {
+	page := domain.GamePage{Games: []domain.GameResponse{}}
+	if err := filter.Validate(); err != nil {
+		return &page, err
+	}
+	limit := filter.Limit
+	filter.Limit++
+	if err := gs.repo.List(ctx, filter, &page.Games); err != nil {
+		return &page, err
+	}
+	if len(page.Games) > limit {
+		page.Games = page.Games[:limit]
+		last := page.Games[limit-1]
+		page.NextCursor = domain.EncodeCursor(domain.Cursor{CreatedAt: last.CreatedAt, ID: last.ID})
+	}
+	return &page, nil
+}
+
 func (gs *GameService) GetGame(ctx context.Context, id int) (*domain.GameResponse, error) {
 	var game domain.GameResponse
 	err := gs.repo.Get(ctx, id, &game)
@@ -39,19 +80,50 @@ func (gs *GameService) GetGame(ctx context.Context, id int) (*domain.GameRespons
 }
 
 type PlayerService struct {
-	repo domain.PlayerRepository
+	repo  domain.PlayerRepository
+	games *GameService
+	bus   events.Publisher
 }
 
-func NewPlayerService(repo domain.PlayerRepository) *PlayerService {
-	return &PlayerService{repo: repo}
+// NewPlayerService publishes the players it creates to bus, which may be nil.
+func NewPlayerService(repo domain.PlayerRepository, games *GameService, bus events.Publisher) *PlayerService {
+	return &PlayerService{repo: repo, games: games, bus: bus}
 }
 
-func (ps *PlayerService) CreatePlayer(ctx context.Context, username string) (*domain.PlayerResponse, error) {
+// CreatePlayer registers a player and issues their API token. Only the hash
+// is stored, so the returned token cannot be recovered later.
+func (ps *PlayerService) CreatePlayer(ctx context.Context, username string) (*domain.PlayerCreateResponse, error) {
 	player_req := domain.PlayerCreateRequest{
-		UserName: username,
+		UserName: strings.TrimSpace(username),
 	}
+	var player domain.PlayerCreateResponse
+	if player_req.UserName == "" {
+		return &player, fmt.Errorf("%w: username cannot be blank", domain.ErrInvalidUsername)
+	}
+	token, hash, err := domain.NewToken()
+	if err != nil {
+		return &player, err
+	}
+	player_req.TokenHash = hash
+	err = ps.repo.Create(ctx, player_req, &player.PlayerResponse)
+	if err != nil {
+		return &player, err
+	}
+	player.Token = token
+	publish(ctx, ps.bus, events.PlayerCreated{Player: player.PlayerResponse, Time: time.Now().UTC()})
+	return &player, nil
+}
+
+// Authenticate resolves an API token to its player.
+func (ps *PlayerService) Authenticate(ctx context.Context, token string) (*domain.PlayerResponse, error) {
 	var player domain.PlayerResponse
-	err := ps.repo.Create(ctx, player_req, &player)
+	if token == "" {
+		return &player, domain.ErrUnauthenticated
+	}
+	err := ps.repo.GetByTokenHash(ctx, domain.HashToken(token), &player)
+	if errors.Is(err, domain.ErrPlayerNotFound) {
+		return &player, domain.ErrUnauthenticated
+	}
 	if err != nil {
 		return &player, err
 	}
@@ -67,22 +139,100 @@ func (ps *PlayerService) GetPlayer(ctx context.Context, id int) (*domain.PlayerR
 	return &player, nil
 }
 
-func (ps *PlayerService) GetPlayerGames(ctx context.Context, id int) (*[]domain.GameResponse, error) {
-	var games []domain.GameResponse
-	err := ps.repo.GetGames(ctx, id, &games)
+// ListPlayers returns a page of players ordered by id.
+func (ps *PlayerService) ListPlayers(ctx context.Context, filter domain.PlayerFilter) (*domain.PlayerPage, error) {
+	page := domain.PlayerPage{Players: []domain.PlayerResponse{}}
+	if err := filter.Validate(); err != nil {
+		return &page, err
+	}
+	limit := filter.Limit
+	filter.Limit++
+	if err := ps.repo.List(ctx, filter, &page.Players); err != nil {
+		return &page, err
+	}
+	if len(page.Players) > limit {
+		page.Players = page.Players[:limit]
+		page.NextCursor = domain.EncodeCursor(domain.Cursor{ID: page.Players[limit-1].ID})
+	}
+	return &page, nil
+}
+
+// GetPlayerGames lists the player's games; filter.PlayerID is set to id.
+func (ps *PlayerService) GetPlayerGames(ctx context.Context, id int, filter domain.GameFilter) (*domain.GamePage, error) {
+	var player domain.PlayerResponse
+	if err := ps.repo.Get(ctx, id, &player); err != nil {
+		return &domain.GamePage{Games: []domain.GameResponse{}}, err
+	}
+	filter.PlayerID = id
+	return ps.games.ListGames(ctx, filter)
+}
+
+func (ps *PlayerService) GetStats(ctx context.Context, id int) (*domain.PlayerStats, error) {
+	var stats domain.PlayerStats
+	var player domain.PlayerResponse
+	if err := ps.repo.Get(ctx, id, &player); err != nil {
+		return &stats, err
+	}
+	if err := ps.repo.GetStats(ctx, id, 0, &stats); err != nil {
+		return &stats, err
+	}
+	return &stats, nil
+}
+
+// HeadToHead summarises every game between the two players, with one page
+// of those games selected by filter.
+func (ps *PlayerService) HeadToHead(ctx context.Context, id int, opponentID int, filter domain.GameFilter) (*domain.HeadToHead, error) {
+	var h2h domain.HeadToHead
+	if id == opponentID {
+		return &h2h, fmt.Errorf("%w: a player has no record against themselves", domain.ErrInvalidPlayers)
+	}
+	var player domain.PlayerResponse
+	for _, pid := range []int{id, opponentID} {
+		if err := ps.repo.Get(ctx, pid, &player); err != nil {
+			return &h2h, err
+		}
+	}
+	filter.PlayerID = id
+	filter.OpponentID = opponentID
+	games, err := ps.games.ListGames(ctx, filter)
 	if err != nil {
-		return &games, err
+		return &h2h, err
 	}
-	fmt.Println("Player Games: ", &games)
-	return &games, nil
+	var player_stats, opponent_stats domain.PlayerStats
+	if err := ps.repo.GetStats(ctx, id, opponentID, &player_stats); err != nil {
+		return &h2h, err
+	}
+	if err := ps.repo.GetStats(ctx, opponentID, id, &opponent_stats); err != nil {
+		return &h2h, err
+	}
+	h2h = domain.NewHeadToHead(player_stats, opponent_stats, *games)
+	return &h2h, nil
+}
+
+// GetRatings returns the player's current rating and rating history.
+func (ps *PlayerService) GetRatings(ctx context.Context, id int) (*domain.PlayerRatings, error) {
+	ratings := domain.PlayerRatings{PlayerID: id, History: []domain.RatingChange{}}
+	var player domain.PlayerResponse
+	if err := ps.repo.Get(ctx, id, &player); err != nil {
+		return &ratings, err
+	}
+	ratings.Current = player.Rating
+	if err := ps.repo.ListRatingHistory(ctx, id, &ratings.History); err != nil {
+		return &ratings, err
+	}
+	return &ratings, nil
 }
 
 type RoundService struct {
-	repo domain.RoundRepository
+	repo    domain.RoundRepository
+	ratings domain.RatingSystem
+	bus     events.Publisher
 }
 
-func NewRoundService(repo domain.RoundRepository) *RoundService {
-	return &RoundService{repo: repo}
+// NewRoundService plays rounds with repo; games are rated with ratings when
+// they finish. Rounds and moves are published to bus, which may be nil.
+func NewRoundService(repo domain.RoundRepository, ratings domain.RatingSystem, bus events.Publisher) *RoundService {
+	return &RoundService{repo: repo, ratings: ratings, bus: bus}
 }
 
 func (rs *RoundService) Create(ctx context.Context, req domain.RoundContext) (*domain.RoundContext, error) {
@@ -90,6 +240,7 @@ func (rs *RoundService) Create(ctx context.Context, req domain.RoundContext) (*d
 	if err != nil {
 		return &req, err
 	}
+	publish(ctx, rs.bus, events.RoundCreated{Round: req, Time: time.Now().UTC()})
 	return &req, nil
 }
 
@@ -102,11 +253,237 @@ func (rs *RoundService) Get(ctx context.Context, id int) (*domain.RoundContext,
 	return &round_res, nil
 }
 
-func (rs *RoundService) UpdateHand(ctx context.Context, hand string, req domain.RoundContext) (*domain.RoundContext, error) {
-	err := rs.repo.UpdateHand(ctx, hand, &req)
-	fmt.Println("RoundService >> GameID:  ", &req.GameID)
+// GetInGame returns the round only if it belongs to the game, so a round id
+// cannot be read through another game's URL.
+func (rs *RoundService) GetInGame(ctx context.Context, gameID int, roundID int) (*domain.RoundContext, error) {
+	round, err := rs.Get(ctx, roundID)
+	if err != nil {
+		return round, err
+	}
+	if round.GameID != gameID {
+		return &domain.RoundContext{}, domain.NotFound(domain.ErrRoundNotFound, roundID)
+	}
+	return round, nil
+}
+
+func (rs *RoundService) ListByGame(ctx context.Context, gameID int) (*[]domain.RoundContext, error) {
+	rounds := []domain.RoundContext{}
+	err := rs.repo.ListByGame(ctx, gameID, &rounds)
+	if err != nil {
+		return &rounds, err
+	}
+	return &rounds, nil
+}
+
+// UpdateHand plays hand for req.CurrentPlayer. In commit-reveal games it is
+// the reveal and nonce must open the player's commitment; otherwise nonce is
+// ignored.
+func (rs *RoundService) UpdateHand(ctx context.Context, hand domain.Hand, nonce string, req domain.RoundContext) (*domain.RoundContext, error) {
+	playerID := req.CurrentPlayer
+	var saved domain.GameResponse
+	err := rs.repo.Update(ctx, req.GameID, req.ID, func(game *domain.GameResponse, round *domain.RoundContext) error {
+		var err error
+		if game.CommitReveal {
+			err = RevealHand(game, round, playerID, hand, nonce)
+		} else {
+			err = PlayHand(game, round, playerID, hand)
+		}
+		if err != nil {
+			return err
+		}
+		RateGame(game, rs.ratings)
+		saved, req = *game, *round
+		return nil
+	})
+	if err != nil {
+		return &req, err
+	}
+	now := time.Now().UTC()
+	evs := []events.Event{events.HandPlayed{Game: saved, Round: req, PlayerID: playerID, Time: now}}
+	if req.Finished {
+		evs = append(evs, events.RoundResolved{Game: saved, Round: req, Time: now})
+	}
+	if saved.Finished {
+		evs = append(evs, events.GameFinished{Game: saved, Time: now})
+	}
+	publish(ctx, rs.bus, evs...)
+	return &req, nil
+}
+
+// CommitHand stores req.CurrentPlayer's commitment for the round.
+func (rs *RoundService) CommitHand(ctx context.Context, commitment string, req domain.RoundContext) (*domain.RoundContext, error) {
+	playerID := req.CurrentPlayer
+	var saved domain.GameResponse
+	err := rs.repo.Update(ctx, req.GameID, req.ID, func(game *domain.GameResponse, round *domain.RoundContext) error {
+		if err := CommitHand(game, round, playerID, commitment); err != nil {
+			return err
+		}
+		saved, req = *game, *round
+		return nil
+	})
 	if err != nil {
 		return &req, err
 	}
+	publish(ctx, rs.bus, events.HandCommitted{Game: saved, Round: req, PlayerID: playerID, Time: time.Now().UTC()})
 	return &req, nil
 }
+
+type GameEventService struct {
+	repo domain.GameEventRepository
+}
+
+func NewGameEventService(repo domain.GameEventRepository) *GameEventService {
+	return &GameEventService{repo: repo}
+}
+
+// ListByGame returns the game's events numbered after afterSeq.
+func (es *GameEventService) ListByGame(ctx context.Context, gameID int, afterSeq int) (*[]domain.GameEvent, error) {
+	events := []domain.GameEvent{}
+	if err := es.repo.ListByGame(ctx, gameID, afterSeq, &events); err != nil {
+		return &events, err
+	}
+	return &events, nil
+}
+
+// ListByPlayer returns the events of the player's games recorded after the
+// event afterID.
+func (es *GameEventService) ListByPlayer(ctx context.Context, playerID int, afterID int) (*[]domain.GameEvent, error) {
+	events := []domain.GameEvent{}
+	if err := es.repo.ListByPlayer(ctx, playerID, afterID, &events); err != nil {
+		return &events, err
+	}
+	return &events, nil
+}
+
+type WebhookService struct {
+	repo domain.WebhookRepository
+}
+
+func NewWebhookService(repo domain.WebhookRepository) *WebhookService {
+	return &WebhookService{repo: repo}
+}
+
+// CreateWebhook registers a webhook for req.PlayerID. The secret its
+// deliveries are signed with is only returned here.
+func (ws *WebhookService) CreateWebhook(ctx context.Context, req domain.WebhookCreateRequest) (*domain.WebhookCreateResponse, error) {
+	var webhook domain.WebhookCreateResponse
+	if err := req.Validate(); err != nil {
+		return &webhook, err
+	}
+	secret, err := domain.NewWebhookSecret()
+	if err != nil {
+		return &webhook, err
+	}
+	req.Secret = secret
+	if err := ws.repo.Create(ctx, req, &webhook.Webhook); err != nil {
+		return &webhook, err
+	}
+	webhook.Secret = secret
+	return &webhook, nil
+}
+
+func (ws *WebhookService) ListWebhooks(ctx context.Context, playerID int) (*[]domain.Webhook, error) {
+	webhooks := []domain.Webhook{}
+	if err := ws.repo.ListByPlayer(ctx, playerID, &webhooks); err != nil {
+		return &webhooks, err
+	}
+	return &webhooks, nil
+}
+
+// GetWebhook returns the player's webhook. Other players' webhooks are
+// reported as not found, so their ids are not revealed.
+func (ws *WebhookService) GetWebhook(ctx context.Context, playerID int, id int) (*domain.Webhook, error) {
+	var webhook domain.Webhook
+	if err := ws.repo.Get(ctx, id, &webhook); err != nil {
+		return &webhook, err
+	}
+	if webhook.PlayerID != playerID {
+		return &domain.Webhook{}, domain.NotFound(domain.ErrWebhookNotFound, id)
+	}
+	return &webhook, nil
+}
+
+// DeleteWebhook removes the player's webhook along with its deliveries.
+func (ws *WebhookService) DeleteWebhook(ctx context.Context, playerID int, id int) error {
+	if _, err := ws.GetWebhook(ctx, playerID, id); err != nil {
+		return err
+	}
+	return ws.repo.Delete(ctx, id)
+}
+
+// ListDeliveries returns a page of the player's webhook's deliveries, newest
+// first.
+func (ws *WebhookService) ListDeliveries(ctx context.Context, playerID int, id int, filter domain.WebhookDeliveryFilter) (*domain.WebhookDeliveryPage, error) {
+	page := domain.WebhookDeliveryPage{Deliveries: []domain.WebhookDelivery{}}
+	if err := filter.Validate(); err != nil {
+		return &page, err
+	}
+	if _, err := ws.GetWebhook(ctx, playerID, id); err != nil {
+		return &page, err
+	}
+	limit := filter.Limit
+	filter.Limit++
+	if err := ws.repo.ListDeliveries(ctx, id, filter, &page.Deliveries); err != nil {
+		return &page, err
+	}
+	if len(page.Deliveries) > limit {
+		page.Deliveries = page.Deliveries[:limit]
+		page.NextCursor = domain.EncodeCursor(domain.Cursor{ID: page.Deliveries[limit-1].ID})
+	}
+	return &page, nil
+}
+
+type LeaderboardService struct {
+	repo     domain.LeaderboardRepository
+	minGames int
+}
+
+// NewLeaderboardService ranks players by win rate once they have minGames
+// finished games in a window.
+func NewLeaderboardService(repo domain.LeaderboardRepository, minGames int) *LeaderboardService {
+	return &LeaderboardService{repo: repo, minGames: minGames}
+}
+
+// Refresh rebuilds the leaderboard from the games finished so far.
+func (ls *LeaderboardService) Refresh(ctx context.Context) error {
+	return ls.repo.Refresh(ctx, time.Now().UTC(), ls.minGames)
+}
+
+// RefreshEvery refreshes the leaderboard every interval until ctx is done. A
+// failed refresh is logged and the previous leaderboard stays up.
+func (ls *LeaderboardService) RefreshEvery(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := ls.Refresh(ctx); err != nil {
+				log.Printf("refresh leaderboard: %v", err)
+			}
+		}
+	}
+}
+
+// List returns a page of the leaderboard, best first.
+func (ls *LeaderboardService) List(ctx context.Context, filter domain.LeaderboardFilter) (*domain.LeaderboardPage, error) {
+	page := domain.LeaderboardPage{Entries: []domain.LeaderboardEntry{}}
+	if err := filter.Validate(); err != nil {
+		return &page, err
+	}
+	page.Sort, page.Window = filter.Sort, filter.Window
+	limit := filter.Limit
+	filter.Limit++
+	if err := ls.repo.List(ctx, filter, &page.Entries); err != nil {
+		return &page, err
+	}
+	if len(page.Entries) > 0 {
+		page.RefreshedAt = page.Entries[0].RefreshedAt
+	}
+	if len(page.Entries) > limit {
+		page.Entries = page.Entries[:limit]
+		page.NextCursor = domain.EncodeCursor(domain.Cursor{ID: page.Entries[limit-1].Rank})
+	}
+	return &page, nil
+}
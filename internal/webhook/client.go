@@ -0,0 +1,70 @@
+package webhook
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"syscall"
+	"time"
+)
+
+// errNotPublic fails a connection to an address webhooks may not reach.
+var errNotPublic = errors.New("address is not public")
+
+// nonPublic are the ranges outside those the net/netip methods in isPublic
+// cover that do not lead to the internet.
+var nonPublic = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),     // this network
+	netip.MustParsePrefix("100.64.0.0/10"), // carrier-grade NAT
+	netip.MustParsePrefix("192.0.0.0/24"),  // IETF protocol assignments
+	netip.MustParsePrefix("198.18.0.0/15"), // benchmarking
+	netip.MustParsePrefix("240.0.0.0/4"),   // reserved, and broadcast
+}
+
+// NewClient returns the client deliveries are made with. Webhook URLs are
+// chosen by players, so unless allowPrivate is set, for trying webhooks out
+// locally, the client refuses to connect to loopback, private, link-local
+// and other addresses that are not on the internet. The check is made on
+// the address dialled, after the name was resolved and for every redirect,
+// so a public name cannot lead to the server's own network. Proxies from the
+// environment are ignored for the same reason.
+func NewClient(timeout time.Duration, allowPrivate bool) *http.Client {
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	if !allowPrivate {
+		dialer.Control = refuseNonPublic
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{Timeout: timeout, Transport: transport}
+}
+
+// refuseNonPublic is a net.Dialer Control that fails connections to
+// addresses that are not public.
+func refuseNonPublic(network string, address string, _ syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return err
+	}
+	if !isPublic(addrPort.Addr()) {
+		return fmt.Errorf("%w: %s", errNotPublic, addrPort.Addr())
+	}
+	return nil
+}
+
+// isPublic reports whether addr is on the internet. Global unicast excludes
+// loopback, link-local, multicast and unspecified addresses.
+func isPublic(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.IsGlobalUnicast() || addr.IsPrivate() {
+		return false
+	}
+	for _, prefix := range nonPublic {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
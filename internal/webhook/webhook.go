@@ -0,0 +1,201 @@
+// Package webhook POSTs game events to the webhooks players registered.
+//
+// Every delivery is a JSON domain.GameEvent with these headers:
+//
+//	X-RPS-Event       the event type
+//	X-RPS-Delivery    the delivery id, the same on every retry
+//	X-RPS-Timestamp   Unix time of the attempt
+//	X-RPS-Signature   sha256=<Sign(secret, timestamp, body)>
+//
+// Deliveries are retried with exponential backoff and are not ordered; the
+// event's seq orders the events of a game.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ellisbywater/http-rock-paper-scissors/internal/domain"
+)
+
+const (
+	EventHeader     = "X-RPS-Event"
+	DeliveryHeader  = "X-RPS-Delivery"
+	TimestampHeader = "X-RPS-Timestamp"
+	SignatureHeader = "X-RPS-Signature"
+
+	// dueBatch is how many due deliveries are loaded at a time.
+	dueBatch = 50
+	// maxBackoff caps the wait between attempts.
+	maxBackoff = 6 * time.Hour
+	// enqueueTimeout bounds queueing an event's deliveries.
+	enqueueTimeout = 5 * time.Second
+	// maxResponseBody is how much of a response is read before it is closed.
+	maxResponseBody = 64 << 10
+)
+
+// Sign returns the hex HMAC-SHA256, keyed with the webhook's secret, of the
+// timestamp, a dot and the body. Receivers recompute it to check that a
+// delivery is genuine and recent.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Dispatcher queues a delivery of each game event it is given to every
+// webhook that wants it, and works through the queue.
+type Dispatcher struct {
+	repo        domain.WebhookRepository
+	client      *http.Client
+	maxAttempts int
+	backoff     time.Duration
+	wake        chan struct{}
+}
+
+// NewDispatcher makes up to maxAttempts attempts at each delivery, waiting
+// backoff after the first failure and twice as long after each one after
+// that. backoff must be positive.
+func NewDispatcher(repo domain.WebhookRepository, client *http.Client, maxAttempts int, backoff time.Duration) *Dispatcher {
+	return &Dispatcher{
+		repo:        repo,
+		client:      client,
+		maxAttempts: maxAttempts,
+		backoff:     backoff,
+		wake:        make(chan struct{}, 1),
+	}
+}
+
+// PublishGameEvent queues the event's deliveries and wakes Run.
+func (d *Dispatcher) PublishGameEvent(event domain.GameEvent) {
+	ctx, cancel := context.WithTimeout(context.Background(), enqueueTimeout)
+	defer cancel()
+	if err := d.repo.Enqueue(ctx, event, time.Now().UTC()); err != nil {
+		log.Printf("queue webhook deliveries: %v", err)
+		return
+	}
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run delivers what is due whenever an event is queued, and every poll for
+// the retries, until ctx is done.
+func (d *Dispatcher) Run(ctx context.Context, poll time.Duration) {
+	ticker := time.NewTicker(poll)
+	defer ticker.Stop()
+	for {
+		if err := d.DeliverDue(ctx, time.Now().UTC()); err != nil && ctx.Err() == nil {
+			log.Printf("deliver webhooks: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-d.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// DeliverDue makes one attempt at every delivery due by now. Retries are
+// scheduled from now.
+func (d *Dispatcher) DeliverDue(ctx context.Context, now time.Time) error {
+	webhooks := make(map[int]*domain.Webhook)
+	for {
+		var due []domain.WebhookDelivery
+		if err := d.repo.ListDue(ctx, now, dueBatch, &due); err != nil {
+			return err
+		}
+		for _, delivery := range due {
+			webhook, ok := webhooks[delivery.WebhookID]
+			if !ok {
+				webhook = &domain.Webhook{}
+				err := d.repo.Get(ctx, delivery.WebhookID, webhook)
+				// a webhook deleted since takes its deliveries with it
+				if errors.Is(err, domain.ErrWebhookNotFound) {
+					continue
+				}
+				if err != nil {
+					return err
+				}
+				webhooks[delivery.WebhookID] = webhook
+			}
+			if err := d.attempt(ctx, webhook, delivery, now); err != nil {
+				return err
+			}
+		}
+		if len(due) < dueBatch {
+			return nil
+		}
+	}
+}
+
+// attempt POSTs the delivery once and records the outcome. A request that
+// cannot even be built, say for a URL saved before it was validated, fails
+// the delivery for good: retrying cannot fix it.
+func (d *Dispatcher) attempt(ctx context.Context, webhook *domain.Webhook, delivery domain.WebhookDelivery, now time.Time) error {
+	started := time.Now()
+	attempt := domain.WebhookAttempt{Attempt: delivery.Attempts + 1, AttemptedAt: started.UTC()}
+	req, err := newRequest(ctx, webhook, delivery, started)
+	permanent := err != nil
+	var resp *http.Response
+	if err == nil {
+		resp, err = d.client.Do(req)
+	}
+	if err != nil {
+		attempt.Error = err.Error()
+	} else {
+		io.Copy(io.Discard, io.LimitReader(resp.Body, maxResponseBody))
+		resp.Body.Close()
+		attempt.StatusCode = resp.StatusCode
+	}
+	attempt.DurationMS = int(time.Since(started).Milliseconds())
+	if ctx.Err() != nil {
+		// shutting down: leave the delivery due for the next run
+		return ctx.Err()
+	}
+
+	delivery.Attempts++
+	delivery.NextAttemptAt = time.Time{}
+	switch {
+	case err == nil && resp.StatusCode >= 200 && resp.StatusCode < 300:
+		delivery.Status = domain.DeliverySucceeded
+	case permanent || delivery.Attempts >= d.maxAttempts:
+		delivery.Status = domain.DeliveryFailed
+	default:
+		wait := d.backoff
+		for i := 1; i < delivery.Attempts && wait < maxBackoff; i++ {
+			wait *= 2
+		}
+		delivery.NextAttemptAt = now.Add(min(wait, maxBackoff))
+	}
+	return d.repo.RecordAttempt(ctx, delivery, attempt)
+}
+
+// newRequest builds the signed POST of the delivery.
+func newRequest(ctx context.Context, webhook *domain.Webhook, delivery domain.WebhookDelivery, started time.Time) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return nil, err
+	}
+	timestamp := started.Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "rps-webhooks")
+	req.Header.Set(EventHeader, delivery.EventType)
+	req.Header.Set(DeliveryHeader, strconv.Itoa(delivery.ID))
+	req.Header.Set(TimestampHeader, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(SignatureHeader, "sha256="+Sign(webhook.Secret, timestamp, delivery.Payload))
+	return req, nil
+}
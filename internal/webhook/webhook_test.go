@@ -0,0 +1,220 @@
+package webhook_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ellisbywater/http-rock-paper-scissors/internal/domain"
+	"github.com/ellisbywater/http-rock-paper-scissors/internal/repository/memory"
+	"github.com/ellisbywater/http-rock-paper-scissors/internal/webhook"
+)
+
+// receiver answers each delivery with the next status and checks its
+// signature.
+type receiver struct {
+	t        *testing.T
+	secret   string
+	mu       sync.Mutex
+	statuses []int
+	bodies   []string
+}
+
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	timestamp, err := strconv.ParseInt(r.Header.Get(webhook.TimestampHeader), 10, 64)
+	if err != nil {
+		rc.t.Errorf("bad timestamp header %q", r.Header.Get(webhook.TimestampHeader))
+	}
+	if got, want := r.Header.Get(webhook.SignatureHeader), "sha256="+webhook.Sign(rc.secret, timestamp, body); got != want {
+		rc.t.Errorf("signature %q, want %q", got, want)
+	}
+	if got := r.Header.Get(webhook.EventHeader); got != domain.EventGameFinished {
+		rc.t.Errorf("event header %q", got)
+	}
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.bodies = append(rc.bodies, string(body))
+	status := rc.statuses[0]
+	rc.statuses = rc.statuses[1:]
+	w.WriteHeader(status)
+}
+
+func TestDispatcherRetriesUntilDelivered(t *testing.T) {
+	ctx := context.Background()
+	store := memory.New()
+	players := memory.NewPlayerRepository(store)
+	repo := memory.NewWebhookRepository(store)
+	var one, two domain.PlayerResponse
+	if err := players.Create(ctx, domain.PlayerCreateRequest{UserName: "one"}, &one); err != nil {
+		t.Fatal(err)
+	}
+	if err := players.Create(ctx, domain.PlayerCreateRequest{UserName: "two"}, &two); err != nil {
+		t.Fatal(err)
+	}
+
+	rc := &receiver{t: t, secret: "shh", statuses: []int{http.StatusInternalServerError, http.StatusServiceUnavailable, http.StatusNoContent}}
+	server := httptest.NewServer(rc)
+	defer server.Close()
+	var hook domain.Webhook
+	req := domain.WebhookCreateRequest{PlayerID: one.ID, URL: server.URL, Events: domain.WebhookEvents{domain.EventGameFinished}, Secret: rc.secret}
+	if err := repo.Create(ctx, req, &hook); err != nil {
+		t.Fatal(err)
+	}
+
+	dispatcher := webhook.NewDispatcher(repo, webhook.NewClient(time.Second, true), 5, time.Minute)
+	// only game_finished is wanted
+	dispatcher.PublishGameEvent(domain.GameEvent{ID: 1, Type: domain.EventHandPlayed, GameID: 1, PlayerOneID: one.ID, PlayerTwoID: two.ID})
+	dispatcher.PublishGameEvent(domain.GameEvent{ID: 2, Type: domain.EventGameFinished, GameID: 1, PlayerOneID: one.ID, PlayerTwoID: two.ID, Winner: two.ID})
+
+	now := time.Now().UTC()
+	// 500 now, 503 a minute on, then 204 after the doubled wait; nothing is
+	// due in between
+	for _, at := range []time.Duration{0, 30 * time.Second, time.Minute, 2 * time.Minute, 3 * time.Minute} {
+		if err := dispatcher.DeliverDue(ctx, now.Add(at)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(rc.bodies) != 3 {
+		t.Fatalf("received %d deliveries, want 3", len(rc.bodies))
+	}
+
+	var deliveries []domain.WebhookDelivery
+	if err := repo.ListDeliveries(ctx, hook.ID, domain.WebhookDeliveryFilter{Limit: 10}, &deliveries); err != nil {
+		t.Fatal(err)
+	}
+	if len(deliveries) != 1 {
+		t.Fatalf("deliveries = %+v, want one", deliveries)
+	}
+	d := deliveries[0]
+	if d.Status != domain.DeliverySucceeded || d.Attempts != 3 || d.EventID != 2 || string(d.Payload) != rc.bodies[2] {
+		t.Fatalf("delivery = %+v", d)
+	}
+	var codes []int
+	for _, attempt := range d.History {
+		codes = append(codes, attempt.StatusCode)
+	}
+	if len(codes) != 3 || codes[0] != 500 || codes[1] != 503 || codes[2] != 204 {
+		t.Fatalf("attempt status codes = %v", codes)
+	}
+}
+
+func TestDispatcherGivesUp(t *testing.T) {
+	ctx := context.Background()
+	store := memory.New()
+	players := memory.NewPlayerRepository(store)
+	repo := memory.NewWebhookRepository(store)
+	var one domain.PlayerResponse
+	if err := players.Create(ctx, domain.PlayerCreateRequest{UserName: "one"}, &one); err != nil {
+		t.Fatal(err)
+	}
+	// nothing listens here
+	server := httptest.NewServer(http.NotFoundHandler())
+	url := server.URL
+	server.Close()
+	var hook domain.Webhook
+	if err := repo.Create(ctx, domain.WebhookCreateRequest{PlayerID: one.ID, URL: url, Secret: "shh"}, &hook); err != nil {
+		t.Fatal(err)
+	}
+
+	dispatcher := webhook.NewDispatcher(repo, webhook.NewClient(time.Second, true), 2, time.Second)
+	dispatcher.PublishGameEvent(domain.GameEvent{ID: 1, Type: domain.EventGameFinished, PlayerOneID: one.ID, PlayerTwoID: 99})
+	now := time.Now().UTC()
+	for _, at := range []time.Duration{0, time.Second, time.Hour} {
+		if err := dispatcher.DeliverDue(ctx, now.Add(at)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var deliveries []domain.WebhookDelivery
+	if err := repo.ListDeliveries(ctx, hook.ID, domain.WebhookDeliveryFilter{Limit: 10}, &deliveries); err != nil {
+		t.Fatal(err)
+	}
+	if len(deliveries) != 1 || deliveries[0].Status != domain.DeliveryFailed || len(deliveries[0].History) != 2 {
+		t.Fatalf("deliveries = %+v, want one failed after 2 attempts", deliveries)
+	}
+	if attempt := deliveries[0].History[1]; attempt.StatusCode != 0 || attempt.Error == "" {
+		t.Fatalf("attempt without a response = %+v", attempt)
+	}
+}
+
+func TestDispatcherFailsUnbuildableRequests(t *testing.T) {
+	ctx := context.Background()
+	store := memory.New()
+	players := memory.NewPlayerRepository(store)
+	repo := memory.NewWebhookRepository(store)
+	var one domain.PlayerResponse
+	if err := players.Create(ctx, domain.PlayerCreateRequest{UserName: "one"}, &one); err != nil {
+		t.Fatal(err)
+	}
+	rc := &receiver{t: t, secret: "shh", statuses: []int{http.StatusNoContent}}
+	server := httptest.NewServer(rc)
+	defer server.Close()
+	// the broken webhook's delivery comes first; saved straight to the
+	// repository, its URL was never validated
+	var broken, working domain.Webhook
+	if err := repo.Create(ctx, domain.WebhookCreateRequest{PlayerID: one.ID, URL: "://no-scheme", Secret: "shh"}, &broken); err != nil {
+		t.Fatal(err)
+	}
+	if err := repo.Create(ctx, domain.WebhookCreateRequest{PlayerID: one.ID, URL: server.URL, Secret: rc.secret}, &working); err != nil {
+		t.Fatal(err)
+	}
+
+	dispatcher := webhook.NewDispatcher(repo, webhook.NewClient(time.Second, true), 5, time.Minute)
+	dispatcher.PublishGameEvent(domain.GameEvent{ID: 1, Type: domain.EventGameFinished, PlayerOneID: one.ID, PlayerTwoID: 99})
+	if err := dispatcher.DeliverDue(ctx, time.Now().UTC()); err != nil {
+		t.Fatalf("DeliverDue() error = %v, want the broken delivery recorded", err)
+	}
+	if len(rc.bodies) != 1 {
+		t.Fatalf("received %d deliveries, want the working webhook's", len(rc.bodies))
+	}
+
+	var deliveries []domain.WebhookDelivery
+	if err := repo.ListDeliveries(ctx, broken.ID, domain.WebhookDeliveryFilter{Limit: 10}, &deliveries); err != nil {
+		t.Fatal(err)
+	}
+	if len(deliveries) != 1 || deliveries[0].Status != domain.DeliveryFailed || len(deliveries[0].History) != 1 || deliveries[0].History[0].Error == "" {
+		t.Fatalf("broken deliveries = %+v, want one failed for good after an attempt with an error", deliveries)
+	}
+}
+
+func TestDispatcherRefusesPrivateAddresses(t *testing.T) {
+	ctx := context.Background()
+	store := memory.New()
+	players := memory.NewPlayerRepository(store)
+	repo := memory.NewWebhookRepository(store)
+	var one domain.PlayerResponse
+	if err := players.Create(ctx, domain.PlayerCreateRequest{UserName: "one"}, &one); err != nil {
+		t.Fatal(err)
+	}
+	rc := &receiver{t: t, secret: "shh", statuses: []int{http.StatusNoContent}}
+	server := httptest.NewServer(rc)
+	defer server.Close()
+	// a public name would resolve to the loopback address just the same
+	var hook domain.Webhook
+	if err := repo.Create(ctx, domain.WebhookCreateRequest{PlayerID: one.ID, URL: server.URL, Secret: rc.secret}, &hook); err != nil {
+		t.Fatal(err)
+	}
+
+	dispatcher := webhook.NewDispatcher(repo, webhook.NewClient(time.Second, false), 5, time.Minute)
+	dispatcher.PublishGameEvent(domain.GameEvent{ID: 1, Type: domain.EventGameFinished, PlayerOneID: one.ID, PlayerTwoID: 99})
+	if err := dispatcher.DeliverDue(ctx, time.Now().UTC()); err != nil {
+		t.Fatal(err)
+	}
+	if len(rc.bodies) != 0 {
+		t.Fatalf("received %d deliveries at a loopback address", len(rc.bodies))
+	}
+	var deliveries []domain.WebhookDelivery
+	if err := repo.ListDeliveries(ctx, hook.ID, domain.WebhookDeliveryFilter{Limit: 10}, &deliveries); err != nil {
+		t.Fatal(err)
+	}
+	if len(deliveries) != 1 || len(deliveries[0].History) != 1 || !strings.Contains(deliveries[0].History[0].Error, "not public") {
+		t.Fatalf("deliveries = %+v, want an attempt refused as not public", deliveries)
+	}
+}